@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"path"
 	"sync"
 	"time"
 )
@@ -37,6 +38,9 @@ func try(x interface{}, err error) interface{} {
 
 var gitMutex sync.Mutex
 
+// 提交更新时持有，常规更新优先于全量回填
+var updateLock = newPriorityLock()
+
 func addFileAndCommit(fileList map[string][]byte, problemsetName string) error {
 	gitMutex.Lock()
 	defer gitMutex.Unlock()
@@ -147,14 +151,19 @@ func (s *server) GetProblemlist(c context.Context, req *rpc.Info) (*rpc.GetProbl
 	}
 	l := make([]*rpc.ProblemlistData, 0)
 	for _, i := range x {
-		l = append(l, &rpc.ProblemlistData{Pid: i.Pid, Title: i.Title})
+		l = append(l, &rpc.ProblemlistData{Pid: i.Pid, Title: i.Title, Fetched: i.Fetched, Changed: i.Changed, Hash: i.Hash, Updated: i.Updated, UpstreamHash: i.UpstreamHash})
 	}
 	return &rpc.GetProblemlistReply{Ok: true, Data: l}, nil
 }
 
 func (s *server) Update(c context.Context, req *rpc.UpdateRequest) (*rpc.UpdateReply, error) {
 	log.Println("Update is called:", req.Info.Name)
-	err := addFileAndCommit(req.File, req.Info.Id)
+	err := updateLock.Lock(c, !req.Backfill, backfillMaxWait)
+	if err != nil {
+		return nil, err
+	}
+	defer updateLock.Unlock()
+	err = addFileAndCommit(req.File, req.Info.Id)
 	if err != nil {
 		log.Println("git error:", err)
 		currentBranch, err := gitRepo.Head()
@@ -180,6 +189,18 @@ func (s *server) Update(c context.Context, req *rpc.UpdateRequest) (*rpc.UpdateR
 	return &rpc.UpdateReply{Ok: true}, nil
 }
 
+func (s *server) GetFile(c context.Context, req *rpc.GetFileRequest) (*rpc.GetFileReply, error) {
+	p := path.Clean("/" + req.Path)
+	b, err := ioutil.ReadFile(sourcePath + "/" + path.Clean("/"+req.Info.Id) + p)
+	if err != nil {
+		if debugMode {
+			log.Println(err)
+		}
+		return &rpc.GetFileReply{Ok: false}, nil
+	}
+	return &rpc.GetFileReply{Ok: true, Data: b}, nil
+}
+
 func parseFlag() {
 	flag.BoolVar(&debugMode, "debug", false, "Debug Mode")
 	flag.StringVar(&sourcePath, "source", "../source", "source repository Path")
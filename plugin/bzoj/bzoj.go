@@ -4,19 +4,12 @@ import (
 	"context"
 	. "crawler/plugin/public"
 	"crawler/rpc"
-	"encoding/json"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
-	"google.golang.org/grpc"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"net/http/cookiejar"
-	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 )
 
 var client rpc.APIClient
@@ -25,61 +18,48 @@ const PID = "bzoj"
 const NAME = "BZOJ"
 const homePath = PID + "/"
 
+// 题库的网址，测试时可替换为 fakeoj 的地址
+var baseUrl = "https://lydsy.com/JudgeOnline"
+
 var info *rpc.Info
 var debugMode bool
 
-type config struct {
-	Username string
-	Password string
-}
+// 账号从 DefaultSecrets 读取，即环境变量 CRAWLER_BZOJ_USERNAME、CRAWLER_BZOJ_PASSWORD 或 ./config/secrets.json 中的 "bzoj"
+// 都未设置时读取旧版本使用的 ./config/bzoj.json
+var secrets Secrets = SecretsChain{DefaultSecrets, &LegacySecrets{
+	Id:     PID,
+	Path:   "./config/bzoj.json",
+	Fields: map[string]string{"username": "Username", "password": "Password"},
+}}
 
-var cfg config
+// 登录后的 cookie 保存在此文件中，下次运行时若未过期则不再登录
+var cookiePath = "./cookies/bzoj.json"
 
-func login(c *HttpConfig) error {
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return err
-	}
-	c.Client.Jar = jar
-	b, err := PostFormAndRead(c, "https://lydsy.com/JudgeOnline/login.php", url.Values{"user_id": {cfg.Username}, "password": {cfg.Password}})
-	if err != nil {
-		return err
-	}
-	if strings.Contains(string(b), "alert") {
-		return fmt.Errorf("Login error:%s", string(b))
-	}
-	return nil
-}
+var session *Session
 
-type addUATransport struct {
-	T http.RoundTripper
+// 登录 BZOJ：密码错误时返回 alert，未登录时导航栏中有登录链接 loginpage.php
+func newSession(c *HttpConfig) *Session {
+	s := NewSession(PID, c, baseUrl+"/login.php")
+	s.Fields = map[string]string{"user_id": "username", "password": "password"}
+	s.Check = BodyNotContains("alert")
+	s.ExpiredMarker = "loginpage.php"
+	s.CookiePath = cookiePath
+	s.Secrets = secrets
+	return s
 }
 
-func (adt *addUATransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Add("User-Agent", `User-Agent: Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Ubuntu Chromium/76.0.3809.87 Chrome/76.0.3809.87 Safari/537.36`)
-	return adt.T.RoundTrip(req)
-}
+var oldPList OldProblemList
 
-func newAddUATransport(T http.RoundTripper) *addUATransport {
-	if T == nil {
-		T = http.DefaultTransport
-	}
-	return &addUATransport{T}
-}
-
-var oldPList map[string]string
+// config/proxy.json 中本题库的代理设置
+var proxyConfig *ProxyConfig
 
 func Start() error {
-	oldPList = make(map[string]string)
+	oldPList = make(OldProblemList)
 	err := InitPList(oldPList, info, client)
 	if err != nil {
 		return err
 	}
-	b, err := ioutil.ReadFile("./config/bzoj.json")
-	if err != nil {
-		return err
-	}
-	err = json.Unmarshal(b, &cfg)
+	proxyConfig, err = LoadProxyConfig(info.Id)
 	if err != nil {
 		return err
 	}
@@ -87,22 +67,28 @@ func Start() error {
 	return nil
 }
 
-var fileList map[string][]byte
+var fileList *FileList
 
-func Update() (FileList, error) {
+// BZOJ 的图片中有不少体积很大的 bmp，转换为 png 并限制尺寸以减小归档体积
+var imageConfig = &ImageConfig{MaxSize: DefaultImageConfig.MaxSize, Transcode: true, Recompress: true, MaxWidth: 2000, MaxHeight: 2000}
+
+// 同时爬取 4 道题目，总请求频率由 Limits 限制
+var downloadConfig = &DownloadConfig{Workers: 4}
+
+func Update() (map[string][]byte, error) {
 	log.Println("Updating BZOJ")
 	limit := 200
 	if debugMode {
 		limit = 5
 	}
-	fileList = make(map[string][]byte)
-	client := &http.Client{Transport: newAddUATransport(nil)}
-	c := &HttpConfig{Client: client, SleepTime: 100 * time.Millisecond}
-	err := login(c)
+	fileList = NewFileList()
+	c := &HttpConfig{Image: imageConfig, Limits: map[string]*HostLimit{"*": {Rate: 10, Burst: 4}}, Proxy: proxyConfig}
+	session = newSession(c)
+	err := session.Open()
 	if err != nil {
 		return nil, err
 	}
-	problemPage, err := GetDocument(c, "https://lydsy.com/JudgeOnline/problemset.php")
+	problemPage, err := session.GetDocument(baseUrl + "/problemset.php")
 	if err != nil {
 		return nil, err
 	}
@@ -130,7 +116,7 @@ func Update() (FileList, error) {
 	}
 	newPList := make([]ProblemListItem, 0)
 	for i := 1; i <= maxPage; i++ {
-		problemListPage, err := GetDocument(c, fmt.Sprintf("https://lydsy.com/JudgeOnline/problemset.php?page=%d", i))
+		problemListPage, err := session.GetDocument(fmt.Sprintf("%s/problemset.php?page=%d", baseUrl, i))
 		if err != nil {
 			return nil, err
 		}
@@ -154,12 +140,12 @@ func Update() (FileList, error) {
 			newPList = append(newPList, p)
 		})
 	}
-	DownloadProblems(newPList, oldPList, limit, func(i *ProblemListItem) (err error) {
+	getProblem := func(i *ProblemListItem) (err error) {
 		if debugMode {
 			log.Println("start getting problem ", i.Pid)
 		}
 		i.Data = nil
-		page, err := GetDocument(c, `https://lydsy.com/JudgeOnline/problem.php?id=`+i.Pid)
+		page, err := session.GetDocument(baseUrl + "/problem.php?id=" + i.Pid)
 		if err != nil {
 			log.Printf("解析题目%s时产生错误：下载题面失败", i.Pid)
 			return err
@@ -190,52 +176,50 @@ func Update() (FileList, error) {
 			i.Data.Judge = "传统 Special Judge"
 		}
 
-		i.Data.Url = `https://lydsy.com/JudgeOnline/problem.php?id=` + i.Pid
+		i.Data.Url = baseUrl + "/problem.php?id=" + i.Pid
 		i.Data.Title = i.Title
-		i.Data.Description = fmt.Sprintf(`
-# Description
-
-%s
-
-# Input
-
-%s
-
-# Output
-
-%s
-
-# Sample Input
-
-%s
-
-# Sample Output
-
-%s
-
-# Hint
-
-%s
-
-# Source
-
-%s
-
-`, Node2html(t[0]), Node2html(t[1]), Node2html(t[2]), Node2html(t[3]), Node2html(t[4]), Node2html(t[5]), Node2html(t[6]))
 		r := regexp.MustCompile(`<p>[\s]*`)
-		i.Data.Description = r.ReplaceAllString(i.Data.Description, `<p>`)
-		i.Data.Description = strings.ReplaceAll(i.Data.Description, "<br>\n", "<br>")
-		d2, err := DownloadImage(c, i.Data.Description, homePath+i.Pid+"/img/", fileList, "https://lydsy.com/JudgeOnline/", "https://lydsy.com")
-		if err == nil {
-			i.Data.Description = d2
+		content := make([]string, len(t))
+		for k, j := range t {
+			content[k] = r.ReplaceAllString(Node2html(j), `<p>`)
+			content[k] = strings.ReplaceAll(content[k], "<br>\n", "<br>")
+		}
+		i.Data.Samples = ExtractSamples(fmt.Sprintf("# Sample Input\n\n%s\n\n# Sample Output\n\n%s\n", content[3], content[4]))
+		b := NewStatementBuilder().
+			Add(SectionDescription, content[0]).
+			Add(SectionInput, content[1]).
+			Add(SectionOutput, content[2])
+		if len(i.Data.Samples) == 0 {
+			b.Add(SectionSamples, content[3]+"\n\n"+content[4])
+		}
+		b.Add(SectionHint, content[5]).
+			Add(SectionSource, content[6]).
+			Build(i.Data)
+		err = ToMarkdown(i.Data)
+		if err != nil {
+			return err
+		}
+		err = DownloadProblemImage(c, i.Data, homePath, fileList, baseUrl+"/", "https://lydsy.com")
+		if err != nil {
+			log.Printf("下载题目%s的图片时出现错误:%v", i.Pid, err)
+		}
+		err = DownloadAttachments(c, nil, i.Data, homePath+i.Pid+"/files/", fileList, baseUrl+"/", "https://lydsy.com")
+		if err != nil {
+			log.Printf("下载题目%s的附件时出现错误:%v", i.Pid, err)
 		}
 		return nil
-	})
+	}
+	if BackfillMode {
+		b := NewBackfill(info, client)
+		b.Download = downloadConfig
+		return nil, b.Run(fileList, newPList, oldPList, getProblem)
+	}
+	DownloadProblems(downloadConfig, newPList, oldPList, limit, getProblem)
 	err = WriteFiles(newPList, fileList, homePath)
 	if err != nil {
 		return nil, err
 	}
-	return fileList, nil
+	return fileList.Files(), nil
 }
 
 func runUpdate() {
@@ -244,6 +228,10 @@ func runUpdate() {
 		log.Println("Update Error")
 		return
 	}
+	if BackfillMode {
+		log.Println("Backfill finished")
+		return
+	}
 	r, err := client.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: file})
 	if err != nil {
 		log.Printf("Submit update failed: %v", err)
@@ -253,16 +241,19 @@ func runUpdate() {
 		log.Println("Submit update failed")
 		return
 	}
+	CommitAssets(homePath, file)
 	log.Println("Submit update successfully")
 }
 func main() {
-	conn, err := grpc.Dial("127.0.0.1:27381", grpc.WithInsecure())
+	ParseFlags()
+	var err error
+	var closeConn func() error
+	client, closeConn, err = Connect()
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	defer conn.Close()
+	defer closeConn()
 	info = &rpc.Info{Id: PID, Name: NAME}
-	client = rpc.NewAPIClient(conn)
 	err = Start()
 	if err != nil {
 		log.Panicln(err)
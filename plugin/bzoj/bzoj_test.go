@@ -0,0 +1,148 @@
+package main
+
+import (
+	. "crawler/plugin/public"
+	"crawler/plugin/public/fakeoj"
+	"crawler/plugin/public/vcr"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	rec, err := vcr.New("testdata/fixtures", vcr.ModeFromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefaultHttpConfig.Client = rec.Client()
+	Now = func() time.Time { return time.Unix(1600000000, 0) }
+	defer func() { DefaultHttpConfig.Client, Now = nil, time.Now }()
+	defer func(x string) { secrets, cookiePath = DefaultSecrets, x }(cookiePath)
+	secrets, cookiePath = MapSecrets{"bzoj": {"username": "test", "password": "test"}}, ""
+	oldPList = make(OldProblemList)
+	files, err := Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcr.CheckGolden(t, "testdata/golden", files)
+}
+
+func TestFakeOJ(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	defer func(x string) { secrets, cookiePath = DefaultSecrets, x }(cookiePath)
+	cookiePath = ""
+	problems := []fakeoj.Problem{
+		{Id: "1000", Title: "A+B Problem", Description: "<p>Calculate a+b</p>", Samples: []fakeoj.Sample{{Input: "1 2", Output: "3"}}, TimeLimit: 1000, MemoryLimit: 128},
+		{Id: "1001", Title: "出错的题目"},
+		{Id: "1002", Title: "损坏的题目"},
+		{Id: "1003", Title: "狼抓兔子", Description: "<p>求最小割。</p>", TimeLimit: 15000, MemoryLimit: 162, SpecialJudge: true},
+	}
+	for _, i := range []struct {
+		name     string
+		password string
+		setup    func(f *fakeoj.Server)
+		err      bool
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:     "problem errors",
+			password: "secret",
+			setup: func(f *fakeoj.Server) {
+				f.Errors["/problem.php?id=1001"] = 404
+				f.Broken["/problem.php?id=1002"] = true
+			},
+			want:    []string{"bzoj/problemlist.json", "bzoj/1000/main.json", "bzoj/1000/samples/1.in", "bzoj/1003/main.json"},
+			notWant: []string{"bzoj/1001/main.json", "bzoj/1002/main.json"},
+		},
+		{name: "wrong password", password: "wrong", setup: func(f *fakeoj.Server) {}, err: true},
+		{name: "maxPage too large", password: "secret", setup: func(f *fakeoj.Server) { f.MaxPage = 500 }, err: true},
+	} {
+		t.Run(i.name, func(t *testing.T) {
+			f := fakeoj.NewHUSTOJ(problems...)
+			defer f.Close()
+			f.PerPage = 2
+			f.Password = "secret"
+			i.setup(f)
+			old := baseUrl
+			baseUrl = f.URL
+			defer func() { baseUrl = old }()
+			secrets = MapSecrets{"bzoj": {"username": "test", "password": i.password}}
+			oldPList = make(OldProblemList)
+			files, err := Update()
+			if i.err {
+				if err == nil {
+					t.Error("Update succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range i.want {
+				if _, ok := files[k]; !ok {
+					t.Errorf("%s missing", k)
+				}
+			}
+			for _, k := range i.notWant {
+				if _, ok := files[k]; ok {
+					t.Errorf("unexpected %s", k)
+				}
+			}
+			p := &Problem{}
+			if err := json.Unmarshal(files["bzoj/1003/main.json"], p); err != nil || p.Judge != "传统 Special Judge" || p.Time != 15000 || p.Memory != 162 {
+				t.Errorf("bzoj/1003/main.json = %s", files["bzoj/1003/main.json"])
+			}
+		})
+	}
+}
+
+// 保存的 cookie 失效时重新登录，之后的运行使用新保存的 cookie
+func TestSession(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	dir, err := ioutil.TempDir("", "bzoj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(x string) { secrets, cookiePath = DefaultSecrets, x }(cookiePath)
+	secrets = MapSecrets{"bzoj": {"username": "test", "password": "secret"}}
+	cookiePath = filepath.Join(dir, "cookies", "bzoj.json")
+	if err := os.MkdirAll(filepath.Dir(cookiePath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cookiePath, []byte(`[{"name":"PHPSESSID","value":"expired"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f := fakeoj.NewHUSTOJ(fakeoj.Problem{Id: "1000", Title: "A+B Problem", Description: "<p>Calculate a+b</p>", TimeLimit: 1000, MemoryLimit: 128})
+	defer f.Close()
+	f.Password = "secret"
+	old := baseUrl
+	baseUrl = f.URL
+	defer func() { baseUrl = old }()
+	logins := func() int {
+		n := 0
+		for _, i := range f.Requests() {
+			if i == "/login.php" {
+				n++
+			}
+		}
+		return n
+	}
+	for k := 0; k < 2; k++ {
+		oldPList = make(OldProblemList)
+		files, err := Update()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := files["bzoj/1000/main.json"]; !ok {
+			t.Errorf("bzoj/1000/main.json missing")
+		}
+		if n := logins(); n != 1 {
+			t.Errorf("logged in %d times after %d runs, want 1", n, k+1)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	. "crawler/plugin/public"
 	"crawler/rpc"
-	"google.golang.org/grpc"
 	"log"
 )
 
@@ -15,21 +14,28 @@ const NAME = "Example OJ" //TODO: 题库全名
 
 var info *rpc.Info
 
-var fileList map[string][]byte
+var fileList = NewFileList()
 
 var debugMode bool
 
+// 发出请求时请使用此设置，如 GetDocument(httpConfig, url)
+var httpConfig = &HttpConfig{}
+
 // 该组件启动时被调用一次
 // TODO: 在此方法中编写初始化代码
 func Start() error {
-	return nil
+	// 读取 config/proxy.json 中本题库的代理设置
+	var err error
+	httpConfig.Proxy, err = LoadProxyConfig(info.Id)
+	return err
 }
 
 // 每次更新时被调用
-// FileList: map[string][]byte,表示此次要提交更新的文件列表，key表示文件完整路径名，value表示文件内容
+// 返回值表示此次要提交更新的文件列表，key表示文件完整路径名，value表示文件内容
+// 爬取时请写入 fileList（可被多个 goroutine 同时写入），最后用 fileList.Files() 取出
 // TODO: 在此方法中编写爬虫程序
-func Update() (FileList, error) {
-	return fileList, nil
+func Update() (map[string][]byte, error) {
+	return fileList.Files(), nil
 }
 
 // 组件结束运行时被调用
@@ -54,12 +60,13 @@ func runUpdate() {
 
 func main() {
 	info = &rpc.Info{Id: PID, Name: NAME}
-	conn, err := grpc.Dial("127.0.0.1:27381", grpc.WithInsecure())
+	var err error
+	var closeConn func() error
+	client, closeConn, err = Connect()
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	defer conn.Close()
-	client = rpc.NewAPIClient(conn)
+	defer closeConn()
 	err = Start()
 	if err != nil {
 		log.Panicln(err)
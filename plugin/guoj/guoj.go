@@ -1,6 +1,7 @@
 package main
 
 import (
+	. "crawler/plugin/public"
 	"crawler/plugin/syzoj"
 	"crawler/rpc"
 	"log"
@@ -13,6 +14,7 @@ func Stop() {
 }
 
 func main() {
+	ParseFlags()
 	c = &syzoj.SYZOJ{}
 	err := c.Start(&rpc.Info{Id: "guoj", Name: "GuOJ"}, "https://guoj.icu")
 	if err != nil {
@@ -6,7 +6,6 @@ import (
 	"crawler/rpc"
 	"encoding/json"
 	"fmt"
-	"google.golang.org/grpc"
 	"log"
 	"strconv"
 )
@@ -15,14 +14,24 @@ var client rpc.APIClient
 
 var debugMode bool
 
-var oldPList map[string]string
+var oldPList OldProblemList
+
+// JoyOI 与 CodeVS 两个题库都从同一域名爬取，共用一组访问限制
+var httpConfig = &HttpConfig{Limits: map[string]*HostLimit{
+	"api.oj.joyoi.cn": {Rate: 4, Burst: 2, MaxConns: 2},
+	"www.joyoi.cn":    {Rate: 4, Burst: 2, MaxConns: 2},
+}}
 
 func Start(info *rpc.Info) error {
-	oldPList = make(map[string]string)
+	oldPList = make(OldProblemList)
 	err := InitPList(oldPList, info, client)
 	if err != nil {
 		return err
 	}
+	httpConfig.Proxy, err = LoadProxyConfig(info.Id)
+	if err != nil {
+		return err
+	}
 	log.Println(info.Name + " crawler started")
 	return nil
 }
@@ -65,16 +74,16 @@ type SampleResponse struct {
 	} `json:"data"`
 }
 
-var fileList map[string][]byte
+var fileList *FileList
 
-func Update(info *rpc.Info, src string) (FileList, error) {
+func Update(info *rpc.Info, src string) (map[string][]byte, error) {
 	log.Println("Updating " + info.Name)
 	limit := 100
 	if debugMode {
 		limit = 5
 	}
-	fileList = make(map[string][]byte)
-	b, err := Download(nil, "http://api.oj.joyoi.cn/api/problem/all?tag=&title=&page=1")
+	fileList = NewFileList()
+	b, err := Download(httpConfig, "http://api.oj.joyoi.cn/api/problem/all?tag=&title=&page=1")
 	check(err)
 	plRes := &ProblemListResponse{}
 	err = json.Unmarshal(b, plRes)
@@ -91,7 +100,7 @@ func Update(info *rpc.Info, src string) (FileList, error) {
 	}
 	newPList := make([]ProblemListItem, 0)
 	for i := 1; i <= maxPage; i++ {
-		b, err = Download(nil, "http://api.oj.joyoi.cn/api/problem/all?tag=&title=&page="+strconv.Itoa(i))
+		b, err = Download(httpConfig, "http://api.oj.joyoi.cn/api/problem/all?tag=&title=&page="+strconv.Itoa(i))
 		check(err)
 		plRes = &ProblemListResponse{}
 		err = json.Unmarshal(b, plRes)
@@ -102,34 +111,24 @@ func Update(info *rpc.Info, src string) (FileList, error) {
 			}
 		}
 	}
-	uList := ChooseUpdateProblem(newPList, oldPList, limit)
-	for k := range newPList {
-		i := &newPList[k]
-		if _, ok := uList[i.Pid]; !ok {
-			continue
-		}
+	getProblem := func(i *ProblemListItem) error {
 		if debugMode {
 			log.Println("start getting problem ", i.Pid)
 		}
-		b, err = Download(nil, "http://api.oj.joyoi.cn/api/problem/"+i.Pid)
+		b, err := Download(httpConfig, "http://api.oj.joyoi.cn/api/problem/"+i.Pid)
 		if err != nil {
-			log.Println("error when parsing problem ", i.Pid, " :", err)
-			continue
+			return err
 		}
 		res := &ProblemResponse{}
 		err = json.Unmarshal(b, res)
 		if err != nil {
-			log.Println("error when parsing problem ", i.Pid, " :", err)
-			continue
+			return err
 		}
 		if res.Code != 200 {
-			if debugMode {
-				log.Printf("Download Problem %s Error: code = %d, Msg = %s", i.Pid, res.Code, res.Msg)
-			}
-			continue
+			return fmt.Errorf("code = %d, Msg = %s", res.Code, res.Msg)
 		}
 		if res.Data.Source != src || !res.Data.IsVisible {
-			continue
+			return nil
 		}
 		i.Data = &Problem{}
 		i.Data.Time = res.Data.TimeLimitationPerCaseInMs
@@ -138,47 +137,49 @@ func Update(info *rpc.Info, src string) (FileList, error) {
 		i.Data.Url = "http://www.joyoi.cn/problem/" + i.Pid
 		if src == "Local" {
 			i.Data.DescriptionType = "markdown"
-			i.Data.Description = res.Data.Body
-			if len(i.Data.Description) > 0 && i.Data.Description[0] != '#' {
-				i.Data.Description = "# \n" + i.Data.Description
-			}
-			b, err = Download(nil, "http://api.oj.joyoi.cn/api/problem/"+i.Pid+"/testcase/all?type=Sample&showContent=true&contestId=")
+			b, err = Download(httpConfig, "http://api.oj.joyoi.cn/api/problem/"+i.Pid+"/testcase/all?type=Sample&showContent=true&contestId=")
 			if err == nil {
 				spRes := &SampleResponse{}
 				err = json.Unmarshal(b, spRes)
 				if err == nil && spRes.Code == 200 && len(spRes.Data) > 0 {
-					sample := `# 样例数据
-<style>
-        table,table tr th, table tr td { border:1px solid #0094ff; }
-        table { width: 200px; min-height: 25px; line-height: 25px; text-align: center; border-collapse: collapse;}   
-    </style>
-<table>
-	<tr>
-		<td>输入样例</td>
-		<td>输出样例</td>
-	</tr>
-`
 					for _, j := range spRes.Data {
-						sample += fmt.Sprintf("<tr><td>%s</td><td>%s</td></tr>", j.Input, j.Output)
+						i.Data.Samples = append(i.Data.Samples, Sample{Input: j.Input, Output: j.Output})
 					}
-					sample += "</table>\n"
-					i.Data.Description += sample
 				}
 			}
+			sb := NewStatementBuilder()
+			titles, contents := SplitSections(res.Data.Body)
+			for k, title := range titles {
+				if title == "" {
+					sb.Add(SectionDescription, contents[k])
+				} else {
+					sb.AddTitled(title, contents[k])
+				}
+			}
+			sb.Build(i.Data)
 		} else {
 			i.Data.DescriptionType = "html_final"
 			i.Data.Description = res.Data.Body
 		}
-		d2, err := DownloadImage(nil, i.Data.Description, info.Id+"/"+i.Pid+"/img/", fileList, "http://www.joyoi.cn/problem/"+i.Pid+"/", "http://www.joyoi.cn")
-		if err == nil {
-			i.Data.Description = d2
+		err = DownloadProblemImage(httpConfig, i.Data, info.Id+"/", fileList, "http://www.joyoi.cn/problem/"+i.Pid+"/", "http://www.joyoi.cn")
+		if err != nil {
+			log.Printf("下载题目%s的图片时出现错误:%v", i.Pid, err)
+		}
+		err = DownloadAttachments(httpConfig, nil, i.Data, info.Id+"/"+i.Pid+"/files/", fileList, "http://www.joyoi.cn/problem/"+i.Pid+"/", "http://www.joyoi.cn")
+		if err != nil {
+			log.Printf("下载题目%s的附件时出现错误:%v", i.Pid, err)
 		}
+		return nil
+	}
+	if BackfillMode {
+		return nil, NewBackfill(info, client).Run(fileList, newPList, oldPList, getProblem)
 	}
+	DownloadProblems(nil, newPList, oldPList, limit, getProblem)
 	err = WriteFiles(newPList, fileList, info.Id+"/")
 	if err != nil {
 		return nil, err
 	}
-	return fileList, nil
+	return fileList.Files(), nil
 }
 
 func runUpdate(info *rpc.Info, src string) {
@@ -187,6 +188,10 @@ func runUpdate(info *rpc.Info, src string) {
 		log.Println("Update Error")
 		return
 	}
+	if BackfillMode {
+		log.Println("Backfill finished")
+		return
+	}
 	r, err := client.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: file})
 	if err != nil {
 		log.Printf("Submit update failed: %v", err)
@@ -196,6 +201,7 @@ func runUpdate(info *rpc.Info, src string) {
 		log.Println("Submit update failed")
 		return
 	}
+	CommitAssets(info.Id+"/", file)
 	log.Println("Submit update successfully")
 }
 func runOJ(info *rpc.Info, src string) {
@@ -212,12 +218,14 @@ func runOJ(info *rpc.Info, src string) {
 	runUpdate(info, src)
 }
 func main() {
-	conn, err := grpc.Dial("127.0.0.1:27381", grpc.WithInsecure())
+	ParseFlags()
+	var err error
+	var closeConn func() error
+	client, closeConn, err = Connect()
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	defer conn.Close()
-	client = rpc.NewAPIClient(conn)
+	defer closeConn()
 	runOJ(&rpc.Info{Id: "joyoi", Name: "JoyOI"}, "Local")
 	runOJ(&rpc.Info{Id: "codevs", Name: "CodeVS"}, "CodeVS")
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	. "crawler/plugin/public"
+	"crawler/plugin/public/vcr"
+	"crawler/rpc"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	rec, err := vcr.New("testdata/fixtures", vcr.ModeFromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefaultHttpConfig.Client = rec.Client()
+	Now = func() time.Time { return time.Unix(1600000000, 0) }
+	defer func() { DefaultHttpConfig.Client, Now = nil, time.Now }()
+	files := make(map[string][]byte)
+	for _, i := range []struct {
+		info *rpc.Info
+		src  string
+	}{
+		{&rpc.Info{Id: "joyoi", Name: "JoyOI"}, "Local"},
+		{&rpc.Info{Id: "codevs", Name: "CodeVS"}, "CodeVS"},
+	} {
+		oldPList = make(OldProblemList)
+		f, err := Update(i.info, i.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range f {
+			files[k] = v
+		}
+	}
+	vcr.CheckGolden(t, "testdata/golden", files)
+}
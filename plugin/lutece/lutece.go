@@ -6,7 +6,6 @@ import (
 	"crawler/rpc"
 	"encoding/json"
 	"fmt"
-	"google.golang.org/grpc"
 	"log"
 	"time"
 )
@@ -17,17 +16,24 @@ const PID = "lutece"
 const NAME = "Lutece"
 const homePath = PID + "/"
 
+// 题库的网址，测试时可替换为 fakeoj 的地址
+var baseUrl = "https://acm.uestc.edu.cn"
+
 var info *rpc.Info
 var debugMode bool
 
-var oldPList map[string]string
+var oldPList OldProblemList
 
 func Start() error {
-	oldPList = make(map[string]string)
+	oldPList = make(OldProblemList)
 	err := InitPList(oldPList, info, client)
 	if err != nil {
 		return err
 	}
+	httpConfig.Proxy, err = LoadProxyConfig(info.Id)
+	if err != nil {
+		return err
+	}
 	log.Println(NAME + " crawler started")
 	return nil
 }
@@ -77,16 +83,18 @@ type ProblemResponse struct {
 	}
 }
 
-var fileList map[string][]byte
+var fileList *FileList
 
-func Update() (FileList, error) {
+var httpConfig = &HttpConfig{Client: nil, SleepTime: 500 * time.Millisecond}
+
+func Update() (map[string][]byte, error) {
 	log.Println("Updating " + NAME)
 	limit := 200
 	if debugMode {
 		limit = 5
 	}
-	c := &HttpConfig{Client: nil, SleepTime: 500 * time.Millisecond}
-	fileList = make(map[string][]byte)
+	c := httpConfig
+	fileList = NewFileList()
 	plReq := Request{OperationName: "ProblemListGQL", Query: `query ProblemListGQL($page: Int!, $filter: String) {
   problemList(page: $page, filter: $filter) {
     maxPage
@@ -96,14 +104,14 @@ func Update() (FileList, error) {
 	plReq.Variables.Page = 1
 	b, err := json.Marshal(plReq)
 	check(err)
-	b, err = PostAndRead(c, "https://acm.uestc.edu.cn/graphql", "application/json", b)
+	b, err = PostAndRead(c, baseUrl+"/graphql", "application/json", b)
 	check(err)
 	plRes := &ProblemListResponse{}
 	err = json.Unmarshal(b, plRes)
 	check(err)
 	maxPage := plRes.Data.ProblemList.MaxPage
 	if maxPage <= 0 || maxPage > 1000 {
-		log.Panicln("maxPage error: ", maxPage)
+		return nil, fmt.Errorf("maxPage error: %d", maxPage)
 	}
 	if debugMode {
 		maxPage = 2
@@ -122,7 +130,7 @@ func Update() (FileList, error) {
 		plReq.Variables.Page = i
 		b, err = json.Marshal(plReq)
 		check(err)
-		b, err = PostAndRead(c, "https://acm.uestc.edu.cn/graphql", "application/json", b)
+		b, err = PostAndRead(c, baseUrl+"/graphql", "application/json", b)
 		check(err)
 		plRes = &ProblemListResponse{}
 		err = json.Unmarshal(b, plRes)
@@ -131,12 +139,7 @@ func Update() (FileList, error) {
 			newPList = append(newPList, ProblemListItem{Pid: j.Slug, Title: j.Title})
 		}
 	}
-	uList := ChooseUpdateProblem(newPList, oldPList, limit)
-	for k := range newPList {
-		i := &newPList[k]
-		if _, ok := uList[i.Pid]; !ok {
-			continue
-		}
+	getProblem := func(i *ProblemListItem) error {
 		if debugMode {
 			log.Println("start getting problem ", i.Pid)
 		}
@@ -164,80 +167,54 @@ func Update() (FileList, error) {
 		req.Variables.Slug = i.Pid
 		b, err := json.Marshal(req)
 		if err != nil {
-			log.Println("error when parsing problem ", i.Pid, " :", err)
-			continue
+			return err
 		}
-		b, err = PostAndRead(c, "https://acm.uestc.edu.cn/graphql", "application/json", b)
+		b, err = PostAndRead(c, baseUrl+"/graphql", "application/json", b)
 		if err != nil {
-			log.Println("error when parsing problem ", i.Pid, " :", err)
-			continue
+			return err
 		}
 		res := &ProblemResponse{}
 		err = json.Unmarshal(b, res)
 		if err != nil {
-			log.Println("error when parsing problem ", i.Pid, " :", err)
-			continue
+			return err
 		}
 		i.Data = &Problem{}
 		i.Data.Time = res.Data.Problem.Limitation.TimeLimit
 		i.Data.Memory = res.Data.Problem.Limitation.MemoryLimit
 		i.Data.Title = i.Title
-		i.Data.Url = fmt.Sprintf("https://acm.uestc.edu.cn/problem/%s/description", i.Pid)
+		i.Data.Url = fmt.Sprintf("%s/problem/%s/description", baseUrl, i.Pid)
 		i.Data.Judge = "传统"
-		sample := `<style>
-        table,table tr th, table tr td { border:1px solid #0094ff; }
-        table { width: 200px; min-height: 25px; line-height: 25px; text-align: center; border-collapse: collapse;}   
-    </style>
-<table>
-	<tr>
-		<td>Input</td>
-		<td>Output</td>
-	</tr>
-`
 		for _, j := range res.Data.Problem.Samples.SampleList {
-			sample += fmt.Sprintf("<tr><td>%s</td><td>%s</td></tr>", j.InputContent, j.OutputContent)
+			i.Data.Samples = append(i.Data.Samples, Sample{Input: j.InputContent, Output: j.OutputContent})
 		}
-		sample += "</table>\n"
 		i.Data.DescriptionType = "markdown"
-		i.Data.Description = fmt.Sprintf(`
-# Content
-
-%s
-
-# Standard Input
-
-%s
-
-# Standard Output
-
-%s
-
-# Samples
-
-%s
-
-# Constraints
-
-%s
-
-# Note
-
-%s
-
-# Source
-
-%s
-`, res.Data.Problem.Content, res.Data.Problem.StandardInput, res.Data.Problem.StandardOutput, sample, res.Data.Problem.Constraints, res.Data.Problem.Note, res.Data.Problem.Source)
-		d2, err := DownloadImage(c, i.Data.Description, homePath+i.Pid+"/img/", fileList, "https://acm.uestc.edu.cn/problem/"+i.Pid+"/description/", "https://acm.uestc.edu.cn")
-		if err == nil {
-			i.Data.Description = d2
+		NewStatementBuilder().
+			Add(SectionDescription, res.Data.Problem.Content).
+			Add(SectionInput, res.Data.Problem.StandardInput).
+			Add(SectionOutput, res.Data.Problem.StandardOutput).
+			Add(SectionConstraints, res.Data.Problem.Constraints).
+			Add(SectionHint, res.Data.Problem.Note).
+			Add(SectionSource, res.Data.Problem.Source).
+			Build(i.Data)
+		err = DownloadProblemImage(c, i.Data, homePath, fileList, baseUrl+"/problem/"+i.Pid+"/description/", baseUrl)
+		if err != nil {
+			log.Printf("下载题目%s的图片时出现错误:%v", i.Pid, err)
+		}
+		err = DownloadAttachments(c, nil, i.Data, homePath+i.Pid+"/files/", fileList, baseUrl+"/problem/"+i.Pid+"/description/", baseUrl)
+		if err != nil {
+			log.Printf("下载题目%s的附件时出现错误:%v", i.Pid, err)
 		}
+		return nil
 	}
+	if BackfillMode {
+		return nil, NewBackfill(info, client).Run(fileList, newPList, oldPList, getProblem)
+	}
+	DownloadProblems(nil, newPList, oldPList, limit, getProblem)
 	err = WriteFiles(newPList, fileList, homePath)
 	if err != nil {
 		return nil, err
 	}
-	return fileList, nil
+	return fileList.Files(), nil
 }
 
 func runUpdate() {
@@ -246,6 +223,10 @@ func runUpdate() {
 		log.Println("Update Error")
 		return
 	}
+	if BackfillMode {
+		log.Println("Backfill finished")
+		return
+	}
 	r, err := client.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: file})
 	if err != nil {
 		log.Printf("Submit update failed: %v", err)
@@ -255,16 +236,19 @@ func runUpdate() {
 		log.Println("Submit update failed")
 		return
 	}
+	CommitAssets(homePath, file)
 	log.Println("Submit update successfully")
 }
 func main() {
-	conn, err := grpc.Dial("127.0.0.1:27381", grpc.WithInsecure())
+	ParseFlags()
+	var err error
+	var closeConn func() error
+	client, closeConn, err = Connect()
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	defer conn.Close()
+	defer closeConn()
 	info = &rpc.Info{Id: PID, Name: NAME}
-	client = rpc.NewAPIClient(conn)
 	err = Start()
 	if err != nil {
 		log.Panicln(err)
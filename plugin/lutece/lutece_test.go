@@ -0,0 +1,86 @@
+package main
+
+import (
+	. "crawler/plugin/public"
+	"crawler/plugin/public/fakeoj"
+	"crawler/plugin/public/vcr"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	rec, err := vcr.New("testdata/fixtures", vcr.ModeFromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefaultHttpConfig.Client = rec.Client()
+	Now = func() time.Time { return time.Unix(1600000000, 0) }
+	defer func() { DefaultHttpConfig.Client, Now = nil, time.Now }()
+	oldPList = make(OldProblemList)
+	files, err := Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcr.CheckGolden(t, "testdata/golden", files)
+}
+
+func TestFakeOJ(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	sleep := httpConfig.SleepTime
+	httpConfig.SleepTime = 0
+	defer func() { httpConfig.SleepTime = sleep }()
+	problems := []fakeoj.Problem{
+		{Id: "1", Title: "A + B Problem", Description: "输入 $a, b$，输出 $a + b$。", Samples: []fakeoj.Sample{{Input: "1 2\n", Output: "3\n"}}, TimeLimit: 1000, MemoryLimit: 64},
+		{Id: "2", Title: "出错的题目"},
+		{Id: "3", Title: "损坏的题目"},
+	}
+	for _, i := range []struct {
+		name    string
+		setup   func(f *fakeoj.Server)
+		err     bool
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "problem errors",
+			setup: func(f *fakeoj.Server) {
+				f.Errors["/graphql?problem=2"] = 500
+				f.Broken["/graphql?problem=3"] = true
+			},
+			want:    []string{"lutece/problemlist.json", "lutece/1/main.json", "lutece/1/samples/1.in"},
+			notWant: []string{"lutece/2/main.json", "lutece/3/main.json"},
+		},
+		{name: "maxPage too large", setup: func(f *fakeoj.Server) { f.MaxPage = 1001 }, err: true},
+	} {
+		t.Run(i.name, func(t *testing.T) {
+			f := fakeoj.NewLutece(problems...)
+			defer f.Close()
+			f.PerPage = 2
+			i.setup(f)
+			old := baseUrl
+			baseUrl = f.URL
+			defer func() { baseUrl = old }()
+			oldPList = make(OldProblemList)
+			files, err := Update()
+			if i.err {
+				if err == nil {
+					t.Error("Update succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range i.want {
+				if _, ok := files[k]; !ok {
+					t.Errorf("%s missing", k)
+				}
+			}
+			for _, k := range i.notWant {
+				if _, ok := files[k]; ok {
+					t.Errorf("unexpected %s", k)
+				}
+			}
+		})
+	}
+}
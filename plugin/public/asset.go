@@ -0,0 +1,461 @@
+package public
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 资源在题面中的引用方式
+const (
+	AssetHtmlAttr    = "html"     // <img src>、<source src> 等属性
+	AssetSrcset      = "srcset"   // srcset 属性中的一项
+	AssetCss         = "css"      // style 属性或 <style> 中的 url()
+	AssetMarkdown    = "markdown" // ![alt](url)
+	AssetMarkdownRef = "ref"      // ![alt][label] 对应的 [label]: url
+)
+
+// AssetRef 为题面中对一个资源的引用
+type AssetRef struct {
+	Start int    // 链接在原文中的起始位置
+	End   int    // 链接在原文中的结束位置（不含）
+	Url   string // 链接内容，html 属性中的实体已被反转义
+	Kind  string
+	Html  bool // 链接位于 html 属性中，改写时需要转义
+}
+
+var (
+	// 会被当作图片下载的属性，data-src 等用于图片懒加载
+	assetAttrs      = toSet("src", "data-src", "data-original")
+	assetTags       = toSet("img", "source")
+	cssUrlRule      = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+	mdImageRule     = regexp.MustCompile(`!\[(?:[^\[\]]|\[[^\[\]]*\])*\]\(\s*(?:<([^<>\n]*)>|([^\s()]+(?:\([^\s()]*\)[^\s()]*)*))(?:\s+(?:"[^"]*"|'[^']*'|\([^()]*\)))?\s*\)`)
+	mdImageRefRule  = regexp.MustCompile(`!\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\[([^\[\]]*)\]`)
+	mdLinkDefRule   = regexp.MustCompile(`(?m)^[ ]{0,3}\[([^\[\]]+)\]:[ \t]*(?:<([^<>\n]*)>|(\S+))`)
+	assetSpaceRule  = regexp.MustCompile(`\s+`)
+	rawAttrNameRule = regexp.MustCompile(`^[^\s"'>/=]+`)
+	inlineCodeRule  = regexp.MustCompile("``[^`]+?``|`[^`\n]+`")
+)
+
+// 原始标签文本中的一个属性
+type rawAttr struct {
+	key        string
+	start, end int // 属性值在标签文本中的位置
+}
+
+// 解析原始标签文本中的属性
+func rawAttrs(raw string) (res []rawAttr) {
+	i := 1
+	for i < len(raw) && !strings.ContainsRune(" \t\r\n\f/>", rune(raw[i])) {
+		i++
+	}
+	for i < len(raw) {
+		for i < len(raw) && strings.ContainsRune(" \t\r\n\f/", rune(raw[i])) {
+			i++
+		}
+		if i >= len(raw) || raw[i] == '>' {
+			return
+		}
+		name := rawAttrNameRule.FindString(raw[i:])
+		if name == "" {
+			i++
+			continue
+		}
+		i += len(name)
+		j := i
+		for j < len(raw) && strings.ContainsRune(" \t\r\n\f", rune(raw[j])) {
+			j++
+		}
+		if j >= len(raw) || raw[j] != '=' {
+			continue
+		}
+		j++
+		for j < len(raw) && strings.ContainsRune(" \t\r\n\f", rune(raw[j])) {
+			j++
+		}
+		if j >= len(raw) {
+			return
+		}
+		start, end := j, j
+		if raw[j] == '"' || raw[j] == '\'' {
+			k := strings.IndexByte(raw[j+1:], raw[j])
+			if k < 0 {
+				return
+			}
+			start, end = j+1, j+1+k
+			i = end + 1
+		} else {
+			for end < len(raw) && !strings.ContainsRune(" \t\r\n\f>", rune(raw[end])) {
+				end++
+			}
+			i = end
+		}
+		res = append(res, rawAttr{strings.ToLower(name), start, end})
+	}
+	return
+}
+
+// 解析 srcset 属性，返回其中各链接相对于属性值开头的位置
+func srcsetUrls(x string) [][2]int {
+	res := make([][2]int, 0)
+	i := 0
+	for i < len(x) {
+		for i < len(x) && (x[i] == ',' || strings.ContainsRune(" \t\r\n\f", rune(x[i]))) {
+			i++
+		}
+		if i >= len(x) {
+			break
+		}
+		j := i
+		for j < len(x) && !strings.ContainsRune(" \t\r\n\f", rune(x[j])) {
+			j++
+		}
+		end := j
+		for end > i && x[end-1] == ',' {
+			end--
+		}
+		res = append(res, [2]int{i, end})
+		if end < j {
+			i = j
+			continue
+		}
+		for j < len(x) && x[j] != ',' {
+			j++
+		}
+		i = j
+	}
+	return res
+}
+
+func cssAssets(css string, offset int, inHtml bool) []AssetRef {
+	res := make([]AssetRef, 0)
+	for _, m := range cssUrlRule.FindAllStringSubmatchIndex(css, -1) {
+		for g := 1; g <= 3; g++ {
+			if m[2*g] < 0 || m[2*g] == m[2*g+1] {
+				continue
+			}
+			u := css[m[2*g]:m[2*g+1]]
+			if inHtml {
+				u = strings.Trim(html.UnescapeString(u), `"'`)
+			}
+			res = append(res, AssetRef{Start: offset + m[2*g], End: offset + m[2*g+1], Url: u, Kind: AssetCss, Html: inHtml})
+		}
+	}
+	return res
+}
+
+// 将代码与公式替换为等长的空白，使其中的内容不被当作图片，同时保持各位置不变
+func maskCodeAndMath(text string) string {
+	b := []byte(text)
+	mask := func(start, end int) {
+		for i := start; i < end; i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+	for _, i := range fencedBlocks(text) {
+		mask(i[0], i[1])
+	}
+	for _, i := range inlineCodeRule.FindAllStringIndex(string(b), -1) {
+		mask(i[0], i[1])
+	}
+	for _, i := range FindMath(string(b)) {
+		mask(i.Start, i.End)
+	}
+	return string(b)
+}
+
+// ExtractAssets 找出题面中引用的所有图片，按在原文中的位置排序
+// 支持 <img>/<source> 的 src、srcset 属性，style 属性与 <style> 中的 url()，
+// 以及 markdown 的行内图片与引用式图片；代码与公式中的内容会被跳过
+func ExtractAssets(text string) []AssetRef {
+	text = maskCodeAndMath(text)
+	res := make([]AssetRef, 0)
+	var tags [][]int
+	z := html.NewTokenizer(strings.NewReader(text))
+	pos := 0
+	inStyle := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := string(z.Raw())
+		start := pos
+		pos += len(raw)
+		switch tt {
+		case html.TextToken:
+			if inStyle {
+				res = append(res, cssAssets(raw, start, false)...)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			inStyle = tag == "style" && tt == html.StartTagToken
+			tags = append(tags, []int{start, pos})
+			for _, a := range rawAttrs(raw) {
+				v := raw[a.start:a.end]
+				switch {
+				case a.key == "style":
+					res = append(res, cssAssets(v, start+a.start, true)...)
+				case a.key == "srcset" && assetTags[tag]:
+					for _, s := range srcsetUrls(v) {
+						res = append(res, AssetRef{Start: start + a.start + s[0], End: start + a.start + s[1], Url: html.UnescapeString(v[s[0]:s[1]]), Kind: AssetSrcset, Html: true})
+					}
+				case assetAttrs[a.key] && assetTags[tag]:
+					if u := strings.TrimSpace(html.UnescapeString(v)); u != "" {
+						res = append(res, AssetRef{Start: start + a.start, End: start + a.end, Url: u, Kind: AssetHtmlAttr, Html: true})
+					}
+				}
+			}
+		case html.EndTagToken:
+			inStyle = false
+		}
+	}
+
+	skip := func(pos int) bool {
+		for _, i := range tags {
+			if pos >= i[0] && pos < i[1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, m := range mdImageRule.FindAllStringSubmatchIndex(text, -1) {
+		if skip(m[0]) {
+			continue
+		}
+		g := 2
+		if m[2] < 0 {
+			g = 4
+		}
+		if m[g] == m[g+1] {
+			continue
+		}
+		res = append(res, AssetRef{Start: m[g], End: m[g+1], Url: text[m[g]:m[g+1]], Kind: AssetMarkdown})
+	}
+	labels := make(map[string]bool)
+	for _, m := range mdImageRefRule.FindAllStringSubmatch(text, -1) {
+		label := m[2]
+		if label == "" {
+			label = m[1]
+		}
+		labels[normalizeLabel(label)] = true
+	}
+	if len(labels) > 0 {
+		for _, m := range mdLinkDefRule.FindAllStringSubmatchIndex(text, -1) {
+			if skip(m[0]) || !labels[normalizeLabel(text[m[2]:m[3]])] {
+				continue
+			}
+			g := 4
+			if m[4] < 0 {
+				g = 6
+			}
+			res = append(res, AssetRef{Start: m[g], End: m[g+1], Url: text[m[g]:m[g+1]], Kind: AssetMarkdownRef})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Start < res[j].Start })
+	return res
+}
+
+func normalizeLabel(x string) string {
+	return strings.ToLower(assetSpaceRule.ReplaceAllString(strings.TrimSpace(x), " "))
+}
+
+// RewriteAssets 将题面中的资源链接替换为 replace[ref.Url]，不在 replace 中的链接保持不变
+func RewriteAssets(text string, refs []AssetRef, replace map[string]string) string {
+	var b strings.Builder
+	last := 0
+	for _, i := range refs {
+		to, ok := replace[i.Url]
+		if !ok || i.Start < last {
+			continue
+		}
+		b.WriteString(text[last:i.Start])
+		if i.Html {
+			to = html.EscapeString(to)
+		}
+		b.WriteString(to)
+		last = i.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// ResolveUrl 将题面中的链接 ref 解析为完整的 url，base 为题面所在页面的链接
+func ResolveUrl(base string, ref string) (*url.URL, error) {
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, err
+	}
+	if base == "" || r.IsAbs() {
+		return r, nil
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	return b.ResolveReference(r), nil
+}
+
+// 解析 data: 链接，返回其中的内容及媒体类型
+func decodeDataUrl(x string) ([]byte, string, error) {
+	k := strings.IndexByte(x, ',')
+	if !strings.HasPrefix(x, "data:") || k < 0 {
+		return nil, "", fmt.Errorf("invalid data url")
+	}
+	meta, data := x[5:k], x[k+1:]
+	mediaType := strings.Split(meta, ";")[0]
+	if strings.HasSuffix(meta, ";base64") {
+		data = assetSpaceRule.ReplaceAllString(data, "")
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			b, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+		}
+		return b, mediaType, err
+	}
+	s, err := url.PathUnescape(data)
+	return []byte(s), mediaType, err
+}
+
+// 下载一张图片并校验，按内容哈希保存至 fileList 中题库目录 homePath 下，返回其在文件系统中的路径
+func downloadAsset(c *HttpConfig, u *url.URL, homePath string, fileList *FileList) (string, error) {
+	if c == nil {
+		c = DefaultHttpConfig
+	}
+	index := GetAssetIndex(homePath)
+	if e, ok := index.lookup(u.String(), fileList, homePath); ok {
+		return homePath + e.File, nil
+	}
+	ic := c.Image
+	if ic == nil {
+		ic = DefaultImageConfig
+	}
+	var file []byte
+	var contentType string
+	var err error
+	if u.Scheme == "data" {
+		file, contentType, err = decodeDataUrl(u.String())
+	} else {
+		var res *http.Response
+		res, err = SafeGet(c, u.String())
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		contentType = res.Header.Get("Content-Type")
+		if ic.MaxSize > 0 && res.ContentLength > ic.MaxSize {
+			return "", fmt.Errorf("file is too large: %d bytes", res.ContentLength)
+		}
+		var body io.Reader = res.Body
+		if ic.MaxSize > 0 {
+			body = io.LimitReader(res.Body, ic.MaxSize+1)
+		}
+		file, err = ioutil.ReadAll(body)
+	}
+	if err != nil {
+		return "", err
+	}
+	ext, err := ic.Check(contentType, file)
+	if err != nil {
+		return "", err
+	}
+	e := AssetEntry{}
+	res, newExt, err := ic.Process(file, ext)
+	if err != nil {
+		log.Printf("处理图片%s时出现错误，保留原图:%v", u.Host+u.Path, err)
+	}
+	if newExt != ext || !bytes.Equal(res, file) {
+		e.OriginalHash, e.OriginalExt = CalcMD5(string(file)), ext
+		file, ext = res, newExt
+	}
+	h := CalcMD5(string(file))
+	e.File = AssetDir + h[:2] + "/" + h + "." + ext
+	fileList.Set(homePath+e.File, file)
+	if u.Scheme != "data" {
+		index.stage(u.String(), e)
+	}
+	return homePath + e.File, nil
+}
+
+// 下载 text 中的图片，返回替换链接后的文本及未能保存的图片的说明
+func downloadImages(c *HttpConfig, text string, homePath string, fileList *FileList, base string) (string, []string) {
+	refs := ExtractAssets(text)
+	replace := make(map[string]string)
+	failed := make(map[string]bool)
+	warnings := make([]string, 0)
+	for _, i := range refs {
+		if _, ok := replace[i.Url]; ok || failed[i.Url] || len(i.Url) > 1000 && !strings.HasPrefix(i.Url, "data:") {
+			continue
+		}
+		failed[i.Url] = true
+		u, err := ResolveUrl(base, i.Url)
+		if err == nil && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "data" {
+			err = fmt.Errorf("unsupported url")
+		}
+		if err == nil {
+			var p string
+			p, err = downloadAsset(c, u, homePath, fileList)
+			if err == nil {
+				delete(failed, i.Url)
+				replace[i.Url] = "/source/" + p
+				continue
+			}
+		}
+		link := i.Url
+		if len(link) > 100 {
+			link = link[:100] + "..."
+		}
+		warnings = append(warnings, fmt.Sprintf("图片 %s 未能保存：%v", link, err))
+	}
+	return RewriteAssets(text, refs, replace), warnings
+}
+
+// 解析文档中的图片，下载后按内容哈希保存至 fileList 中题库目录下的 _assets 中，链接与文件的对应关系记录在题库的 AssetIndex 中。
+// c http实例，不需要可置nil; text: 待解析的文档; homePath: 题库目录，如 "uoj/";
+// fileList: 文件表; url1,url2: 文档链接和域名链接，用于相对路径的处理，url1 为空时使用 url2，若都为空则只处理完整链接
+// 返回替换图片链接后的文档，下载失败或未通过校验的图片保留原链接
+func DownloadImage(c *HttpConfig, text string, homePath string, fileList *FileList, url1 string, url2 string) (string, error) {
+	base := url1
+	if base == "" {
+		base = url2
+	}
+	res, warnings := downloadImages(c, text, homePath, fileList, base)
+	for _, i := range warnings {
+		log.Printf("Problem %s : %s", base, i)
+	}
+	return res, nil
+}
+
+// 解析题目 p 中的图片，下载后保存至 fileList 中，并替换题面、各节及原始 html 题面中的图片链接
+// 未能保存的图片记录在 p.Warnings 中；参数含义同 DownloadImage
+func DownloadProblemImage(c *HttpConfig, p *Problem, homePath string, fileList *FileList, url1 string, url2 string) error {
+	base := url1
+	if base == "" {
+		base = url2
+	}
+	seen := make(map[string]bool)
+	for _, i := range p.Warnings {
+		seen[i] = true
+	}
+	return p.RewriteText(func(x string) (string, error) {
+		res, warnings := downloadImages(c, x, homePath, fileList, base)
+		for _, i := range warnings {
+			if !seen[i] {
+				seen[i] = true
+				p.Warnings = append(p.Warnings, i)
+			}
+		}
+		return res, nil
+	})
+}
@@ -0,0 +1,147 @@
+package public
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata/assets 中每个 .txt 为一段题面，.urls 为应当找出的链接，
+// .golden 为将第 k 个不同的链接替换为 #k 后的结果
+func TestAssetFixtures(t *testing.T) {
+	files, err := filepath.Glob("testdata/assets/*.txt")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(f, ".txt")
+		text, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls, err := ioutil.ReadFile(name + ".urls")
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := ioutil.ReadFile(name + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refs := ExtractAssets(string(text))
+		got := make([]string, 0)
+		replace := make(map[string]string)
+		for _, i := range refs {
+			got = append(got, i.Url)
+			if _, ok := replace[i.Url]; !ok {
+				replace[i.Url] = fmt.Sprintf("#%d", len(replace)+1)
+			}
+		}
+		want := strings.Split(strings.TrimSpace(string(urls)), "\n")
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: ExtractAssets = %q, want %q", f, got, want)
+		}
+		if res := RewriteAssets(string(text), refs, replace); res != string(golden) {
+			t.Errorf("%s: RewriteAssets =\n%s\nwant\n%s", f, res, golden)
+		}
+	}
+}
+
+func TestResolveUrl(t *testing.T) {
+	tests := []struct{ base, ref, want string }{
+		{"http://uoj.ac/problem/1/", "img/a.png", "http://uoj.ac/problem/1/img/a.png"},
+		{"http://uoj.ac/problem/1/", "/upload/a.png", "http://uoj.ac/upload/a.png"},
+		{"http://uoj.ac/problem/1/", "../../a.png?v=1", "http://uoj.ac/a.png?v=1"},
+		{"https://lydsy.com/JudgeOnline/", "//cdn.example.com/a.png", "https://cdn.example.com/a.png"},
+		{"https://lydsy.com/JudgeOnline/", "http://example.com/a.png", "http://example.com/a.png"},
+		{"", "http://example.com/a.png", "http://example.com/a.png"},
+	}
+	for _, i := range tests {
+		u, err := ResolveUrl(i.base, i.ref)
+		if err != nil || u.String() != i.want {
+			t.Errorf("ResolveUrl(%q, %q) = %v, %v, want %q", i.base, i.ref, u, err, i.want)
+		}
+	}
+}
+
+func TestDownloadImage(t *testing.T) {
+	files := map[string]string{
+		"/problem/1/img/a.png": "\x89PNG\r\n\x1a\n",
+		"/upload/b":            "\xff\xd8\xff\xe0",
+		"/c.gif":               "GIF89a",
+		"/login.png":           "<html><body>请先登录</body></html>",
+		"/empty.png":           "",
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		f, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(f))
+	}))
+	defer server.Close()
+
+	c := &HttpConfig{Client: server.Client()}
+	// data: 链接中的图片与 a.png 内容相同，只保存一份
+	text := `![a](img/a.png) <img src="/upload/b"> <img srcset="../../c.gif 2x"> ![missing](missing.png) ![data](data:image/png;base64,iVBORw0KGgo=) ![login](/login.png) ![empty](/empty.png)`
+	fl := NewFileList()
+	p := &Problem{Description: text}
+	err := DownloadProblemImage(c, p, "test-download/", fl, server.URL+"/problem/1/", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileList := fl.Files()
+	exts := map[string]string{"\x89PNG\r\n\x1a\n": ".png", "\xff\xd8\xff\xe0": ".jpg", "GIF89a": ".gif"}
+	if len(fileList) != 3 {
+		t.Errorf("downloaded %d files, want 3: %v", len(fileList), fileList)
+	}
+	for k, v := range fileList {
+		h := CalcMD5(string(v))
+		if want := "test-download/_assets/" + h[:2] + "/" + h + exts[string(v)]; k != want {
+			t.Errorf("file %q is saved as %s, want %s", v, k, want)
+		}
+		if !strings.Contains(p.Description, "/source/"+k) {
+			t.Errorf("file %s is not referenced in %s", k, p.Description)
+		}
+	}
+	for _, i := range []string{"![missing](missing.png)", "![login](/login.png)", "![empty](/empty.png)"} {
+		if !strings.Contains(p.Description, i) {
+			t.Errorf("failed image should be kept: %s", i)
+		}
+	}
+	if len(p.Warnings) != 3 {
+		t.Errorf("got warnings %q, want 3", p.Warnings)
+	}
+
+	// 文件尚未提交时，索引项只对同一文件表有效
+	img := `![a](` + server.URL + `/problem/1/img/a.png)`
+	requests = 0
+	if _, err := DownloadImage(c, img, "test-download/", fl, "", ""); err != nil || requests != 0 {
+		t.Errorf("image in the same file list is downloaded again: %d requests, %v", requests, err)
+	}
+	other := NewFileList()
+	if err := WriteAssetIndex(other, "test-download/"); err != nil || other.Len() != 0 {
+		t.Errorf("uncommitted assets are written to another file list: %v, %v", other.Files(), err)
+	}
+	if _, err := DownloadImage(c, img, "test-download/", other, "", ""); err != nil || requests != 1 || other.Len() != 1 {
+		t.Errorf("uncommitted image is not downloaded again: %d requests, %v", requests, err)
+	}
+
+	// 提交后已在索引中的图片不再下载
+	CommitAssets("test-download/", fileList)
+	requests = 0
+	res, err := DownloadImage(c, img, "test-download/", NewFileList(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 || !strings.Contains(res, "/source/test-download/_assets/") {
+		t.Errorf("indexed image is downloaded again: %d requests, %s", requests, res)
+	}
+}
@@ -0,0 +1,150 @@
+package public
+
+import (
+	"context"
+	"crawler/rpc"
+	"encoding/json"
+	"sync"
+)
+
+// 图片按内容哈希保存在题库目录下的 _assets/ab/abcdef....ext 中
+const (
+	AssetDir       = "_assets/"
+	AssetIndexFile = AssetDir + "index.json"
+)
+
+// AssetEntry 为资源索引中的一项
+type AssetEntry struct {
+	File string `json:"file"` // 相对于题库目录的路径，如 _assets/ab/abcdef.png
+	// 图片经过转换、压缩或缩小时，原图的哈希与扩展名
+	OriginalHash string `json:"original_hash,omitempty"`
+	OriginalExt  string `json:"original_ext,omitempty"`
+}
+
+// AssetIndex 记录一个题库中图片链接与归档文件的对应关系，保存在 <题库>/_assets/index.json 中
+// 已在索引中的链接不会被重复下载；下载图片时新增的项先暂存，文件提交成功后由 CommitAssets 记入索引
+type AssetIndex struct {
+	mu     sync.Mutex
+	assets map[string]AssetEntry
+	// 文件尚未提交的项
+	pending map[string]AssetEntry
+}
+
+var (
+	assetIndexes   = make(map[string]*AssetIndex)
+	assetIndexesMu sync.Mutex
+)
+
+// GetAssetIndex 返回题库的资源索引，homePath 为题库目录，如 "uoj/"
+func GetAssetIndex(homePath string) *AssetIndex {
+	assetIndexesMu.Lock()
+	defer assetIndexesMu.Unlock()
+	a, ok := assetIndexes[homePath]
+	if !ok {
+		a = &AssetIndex{assets: make(map[string]AssetEntry), pending: make(map[string]AssetEntry)}
+		assetIndexes[homePath] = a
+	}
+	return a
+}
+
+func (a *AssetIndex) Get(url string) (AssetEntry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.assets[url]
+	return e, ok
+}
+
+func (a *AssetIndex) Set(url string, e AssetEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.assets[url] = e
+}
+
+// 暂存 url 对应的项，其文件随 fileList 提交后才记入索引
+func (a *AssetIndex) stage(url string, e AssetEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending[url] = e
+}
+
+// 查找 url 对应的项：暂存的项仅当其文件在 fileList 中、会随之一起提交时返回
+func (a *AssetIndex) lookup(url string, fileList *FileList, homePath string) (AssetEntry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e, ok := a.assets[url]; ok {
+		return e, true
+	}
+	if e, ok := a.pending[url]; ok {
+		if _, ok := fileList.Get(homePath + e.File); ok {
+			return e, true
+		}
+	}
+	return AssetEntry{}, false
+}
+
+// 返回随 fileList 提交的索引：已记入索引的项及文件在 fileList 中的暂存项
+func (a *AssetIndex) entries(fileList *FileList, homePath string) map[string]AssetEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	x := make(map[string]AssetEntry, len(a.assets)+len(a.pending))
+	for k, v := range a.assets {
+		x[k] = v
+	}
+	for k, v := range a.pending {
+		if _, ok := fileList.Get(homePath + v.File); ok {
+			x[k] = v
+		}
+	}
+	return x
+}
+
+// CommitAssets 在 files 提交成功后调用，将文件已随 files 提交的暂存项记入题库 homePath 的资源索引
+// 提交失败时不要调用，暂存项对应的文件未被提交，之后的下载不会信任这些项
+func CommitAssets(homePath string, files map[string][]byte) {
+	a := GetAssetIndex(homePath)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, v := range a.pending {
+		if _, ok := files[homePath+v.File]; ok {
+			a.assets[k] = v
+			delete(a.pending, k)
+		}
+	}
+}
+
+func (a *AssetIndex) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.assets)
+}
+
+func (a *AssetIndex) MarshalJSON() ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return json.Marshal(a.assets)
+}
+
+func (a *AssetIndex) UnmarshalJSON(b []byte) error {
+	x := make(map[string]AssetEntry)
+	if err := json.Unmarshal(b, &x); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, v := range x {
+		a.assets[k] = v
+	}
+	return nil
+}
+
+// 从主服务读取题库已有的资源索引，索引不存在时不做任何事
+func loadAssetIndex(info *rpc.Info, client rpc.APIClient) error {
+	res, err := client.GetFile(context.Background(), &rpc.GetFileRequest{Info: info, Path: AssetIndexFile})
+	if err != nil {
+		return err
+	}
+	if !res.Ok {
+		return nil
+	}
+	return json.Unmarshal(res.Data, GetAssetIndex(info.Id+"/"))
+}
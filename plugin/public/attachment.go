@@ -0,0 +1,265 @@
+package public
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Attachment 为题目的一个附件，如 pdf 题面、样例压缩包、提交答案题的输入文件与交互题的头文件
+type Attachment struct {
+	Name string `json:"name"` // 文件名
+	File string `json:"file"` // 在文件系统中的路径
+	Url  string `json:"url"`  // 原始链接
+	Size int    `json:"size"`
+}
+
+// AttachmentConfig 决定哪些链接会被当作附件下载
+type AttachmentConfig struct {
+	// 链接的文件扩展名（小写，不含 .）在其中时下载
+	Extensions map[string]bool
+	// 链接的域名在其中时下载，不论扩展名
+	Hosts map[string]bool
+	// 单个附件的大小上限，超出时不下载，单位为字节，不大于 0 时不限制
+	MaxSize int64
+	// 一道题所有附件的大小上限，单位为字节，不大于 0 时不限制
+	MaxTotalSize int64
+}
+
+var DefaultAttachmentConfig = &AttachmentConfig{
+	Extensions: toSet(
+		"pdf", "doc", "docx", "ppt", "pptx", "zip", "rar", "7z", "tar", "gz", "tgz", "bz2", "xz",
+		"in", "out", "ans", "txt", "h", "hpp", "c", "cc", "cpp", "pas", "py", "java",
+	),
+	Hosts:        make(map[string]bool),
+	MaxSize:      32 << 20,
+	MaxTotalSize: 128 << 20,
+}
+
+// 链接在题面中的引用方式
+const (
+	LinkHtml        = "html"     // <a href>
+	LinkMarkdown    = "markdown" // [text](url)
+	LinkMarkdownRef = "ref"      // [text][label] 对应的 [label]: url
+)
+
+var (
+	mdLinkRule      = regexp.MustCompile(`\[(?:[^\[\]]|\[[^\[\]]*\])*\]\(\s*(?:<([^<>\n]*)>|([^\s()]+(?:\([^\s()]*\)[^\s()]*)*))(?:\s+(?:"[^"]*"|'[^']*'|\([^()]*\)))?\s*\)`)
+	mdLinkRefRule   = regexp.MustCompile(`\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\[([^\[\]]*)\]`)
+	fileNameIllegal = regexp.MustCompile(`[\x00-\x20/\\:*?"<>|]+`)
+)
+
+// ExtractLinks 找出题面中的超链接（不含图片），按在原文中的位置排序，代码与公式中的内容会被跳过
+func ExtractLinks(text string) []AssetRef {
+	text = maskCodeAndMath(text)
+	res := make([]AssetRef, 0)
+	var tags [][]int
+	z := html.NewTokenizer(strings.NewReader(text))
+	pos := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := string(z.Raw())
+		start := pos
+		pos += len(raw)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tags = append(tags, []int{start, pos})
+		if name, _ := z.TagName(); string(name) != "a" {
+			continue
+		}
+		for _, a := range rawAttrs(raw) {
+			if a.key != "href" {
+				continue
+			}
+			if u := strings.TrimSpace(html.UnescapeString(raw[a.start:a.end])); u != "" {
+				res = append(res, AssetRef{Start: start + a.start, End: start + a.end, Url: u, Kind: LinkHtml, Html: true})
+			}
+		}
+	}
+
+	skip := func(pos int) bool {
+		if pos > 0 && text[pos-1] == '!' {
+			return true
+		}
+		for _, i := range tags {
+			if pos >= i[0] && pos < i[1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, m := range mdLinkRule.FindAllStringSubmatchIndex(text, -1) {
+		if skip(m[0]) {
+			continue
+		}
+		g := 2
+		if m[2] < 0 {
+			g = 4
+		}
+		if m[g] == m[g+1] {
+			continue
+		}
+		res = append(res, AssetRef{Start: m[g], End: m[g+1], Url: text[m[g]:m[g+1]], Kind: LinkMarkdown})
+	}
+	labels := make(map[string]bool)
+	for _, m := range mdLinkRefRule.FindAllStringSubmatchIndex(text, -1) {
+		if skip(m[0]) {
+			continue
+		}
+		label := text[m[4]:m[5]]
+		if label == "" {
+			label = text[m[2]:m[3]]
+		}
+		labels[normalizeLabel(label)] = true
+	}
+	if len(labels) > 0 {
+		for _, m := range mdLinkDefRule.FindAllStringSubmatchIndex(text, -1) {
+			if !labels[normalizeLabel(text[m[2]:m[3]])] {
+				continue
+			}
+			g := 4
+			if m[4] < 0 {
+				g = 6
+			}
+			res = append(res, AssetRef{Start: m[g], End: m[g+1], Url: text[m[g]:m[g+1]], Kind: LinkMarkdownRef})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Start < res[j].Start })
+	return res
+}
+
+// 判断链接是否应当作为附件下载
+func (ac *AttachmentConfig) match(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if ac.Hosts[strings.ToLower(u.Hostname())] {
+		return true
+	}
+	return ac.Extensions[strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), "."))]
+}
+
+// 由链接及响应头得到附件的文件名
+func attachmentName(u *url.URL, disposition string) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	name = strings.Trim(fileNameIllegal.ReplaceAllString(path.Base(name), "_"), "._")
+	if name == "" {
+		name = CalcMD5(u.String())
+	}
+	return name
+}
+
+// DownloadAttachment 下载链接 link 对应的附件，保存至 fileList 的 prefix 目录下，并加入 p.Attachments
+// ac 为 nil 时使用 DefaultAttachmentConfig，仅使用其中的大小限制；返回附件在文件系统中的路径
+func DownloadAttachment(c *HttpConfig, ac *AttachmentConfig, p *Problem, prefix string, fileList *FileList, link string) (string, error) {
+	if ac == nil {
+		ac = DefaultAttachmentConfig
+	}
+	for _, i := range p.Attachments {
+		if i.Url == link {
+			return i.File, nil
+		}
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	total := int64(0)
+	for _, i := range p.Attachments {
+		total += int64(i.Size)
+	}
+	limit := int64(-1)
+	if ac.MaxSize > 0 {
+		limit = ac.MaxSize
+	}
+	if rest := ac.MaxTotalSize - total; ac.MaxTotalSize > 0 && (limit < 0 || rest < limit) {
+		limit = rest
+		if limit < 0 {
+			limit = 0
+		}
+	}
+	res, err := SafeGet(c, link)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if limit >= 0 && res.ContentLength > limit {
+		return "", fmt.Errorf("attachment %s is too large: %d bytes", link, res.ContentLength)
+	}
+	var body io.Reader = res.Body
+	if limit >= 0 {
+		body = io.LimitReader(res.Body, limit+1)
+	}
+	file, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if limit >= 0 && int64(len(file)) > limit {
+		return "", fmt.Errorf("attachment %s is too large", link)
+	}
+	name := attachmentName(u, res.Header.Get("Content-Disposition"))
+	p1 := prefix + name
+	for _, i := range p.Attachments {
+		if i.File == p1 {
+			// 同名文件，加上链接的哈希区分
+			name = CalcMD5(link)[:8] + "_" + name
+			p1 = prefix + name
+			break
+		}
+	}
+	fileList.Set(p1, file)
+	p.Attachments = append(p.Attachments, Attachment{Name: name, File: p1, Url: link, Size: len(file)})
+	return p1, nil
+}
+
+// DownloadAttachments 下载题目 p 题面中链接的附件，保存至 fileList 的 prefix 目录下，改写链接并加入 p.Attachments
+// ac 为 nil 时使用 DefaultAttachmentConfig；prefix 一般为 "<题库>/<pid>/files/"；url1,url2 的含义同 DownloadImage
+func DownloadAttachments(c *HttpConfig, ac *AttachmentConfig, p *Problem, prefix string, fileList *FileList, url1 string, url2 string) error {
+	if ac == nil {
+		ac = DefaultAttachmentConfig
+	}
+	base := url1
+	if base == "" {
+		base = url2
+	}
+	failed := make(map[string]bool)
+	return p.RewriteText(func(text string) (string, error) {
+		refs := ExtractLinks(text)
+		replace := make(map[string]string)
+		for _, i := range refs {
+			if _, ok := replace[i.Url]; ok || failed[i.Url] {
+				continue
+			}
+			u, err := ResolveUrl(base, i.Url)
+			if err != nil || !ac.match(u) {
+				continue
+			}
+			f, err := DownloadAttachment(c, ac, p, prefix, fileList, u.String())
+			if err != nil {
+				log.Printf("Problem %s : download attachment %s error: %v", base, i.Url, err)
+				failed[i.Url] = true
+				continue
+			}
+			replace[i.Url] = "/source/" + f
+		}
+		return RewriteAssets(text, refs, replace), nil
+	})
+}
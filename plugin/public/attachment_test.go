@@ -0,0 +1,62 @@
+package public
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	text := "<a href=\"a.pdf\">题面</a> [样例](down/sample.zip) ![图](img.png) [数据][d] `[x](code.zip)`\n\n[d]: data.zip\n"
+	want := []string{"a.pdf", "down/sample.zip", "data.zip"}
+	got := ExtractLinks(text)
+	if len(got) != len(want) {
+		t.Fatalf("ExtractLinks found %+v, want %q", got, want)
+	}
+	for k, i := range got {
+		if i.Url != want[k] {
+			t.Errorf("link %d = %q, want %q", k, i.Url, want[k])
+		}
+	}
+}
+
+func TestDownloadAttachments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/problem/1/a.pdf":
+			_, _ = w.Write([]byte("pdf"))
+		case "/download/1":
+			w.Header().Set("Content-Disposition", `attachment; filename="grader.h"`)
+			_, _ = w.Write([]byte("header"))
+		case "/big.zip":
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := &HttpConfig{Client: server.Client()}
+	ac := &AttachmentConfig{Extensions: toSet("pdf", "zip"), Hosts: make(map[string]bool), MaxSize: 10}
+	p := &Problem{Description: `<a href="a.pdf">题面</a> [压缩包](/big.zip) [主页](/index.html)`}
+	fl := NewFileList()
+	err := DownloadAttachments(c, ac, p, "1/files/", fl, server.URL+"/problem/1/", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DownloadAttachment(c, ac, p, "1/files/", fl, server.URL+"/download/1"); err != nil {
+		t.Fatal(err)
+	}
+	want := `<a href="/source/1/files/a.pdf">题面</a> [压缩包](/big.zip) [主页](/index.html)`
+	if p.Description != want {
+		t.Errorf("Description = %q, want %q", p.Description, want)
+	}
+	fileList := fl.Files()
+	if string(fileList["1/files/a.pdf"]) != "pdf" || string(fileList["1/files/grader.h"]) != "header" || len(fileList) != 2 {
+		t.Errorf("unexpected files: %v", fileList)
+	}
+	if len(p.Attachments) != 2 || p.Attachments[1].Name != "grader.h" || p.Attachments[1].Size != 6 {
+		t.Errorf("unexpected attachments: %+v", p.Attachments)
+	}
+}
@@ -0,0 +1,157 @@
+package public
+
+import (
+	"context"
+	"crawler/rpc"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 是否以全量回填模式运行，由 ParseFlags 从命令行参数 -backfill 读取
+var BackfillMode bool
+
+var parseFlagsOnce sync.Once
+
+// ParseFlags 解析组件的命令行参数，在组件的 main 开头调用
+func ParseFlags() {
+	parseFlagsOnce.Do(func() {
+		flag.BoolVar(&BackfillMode, "backfill", false, "重新爬取题库中的所有题目，分批提交")
+		flag.Parse()
+	})
+}
+
+// Backfill 为全量回填：不受每次更新的题目数限制，重新爬取题目列表中的所有题目，用于组件的解析改进后重新生成整个题库
+// 题目分批爬取，每批完成后提交一次并暂停 Pause，让出主服务给其他组件的常规更新；进度保存在检查点中，中断后重新运行时从中断处继续
+type Backfill struct {
+	HomePath string
+	// 保存进度的检查点文件
+	CheckpointPath string
+	// 每批爬取的题目数，不大于 0 时视为 1
+	BatchSize int
+	// 每批提交后的等待时间
+	Pause time.Duration
+	// 爬取题目时的设置，为 nil 时使用 DefaultDownloadConfig
+	Download *DownloadConfig
+	// 提交一批文件的函数
+	Submit func(files map[string][]byte) error
+}
+
+// NewBackfill 返回向主服务提交的全量回填，检查点保存在 ./checkpoint/<题库>-backfill.json 中
+func NewBackfill(info *rpc.Info, client rpc.APIClient) *Backfill {
+	return &Backfill{
+		HomePath:       info.Id + "/",
+		CheckpointPath: "./checkpoint/" + info.Id + "-backfill.json",
+		BatchSize:      50,
+		Pause:          30 * time.Second,
+		Submit: func(files map[string][]byte) error {
+			r, err := client.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: files, Backfill: true})
+			if err != nil {
+				return err
+			}
+			if !r.Ok {
+				return errors.New("submit update failed")
+			}
+			return nil
+		},
+	}
+}
+
+// Run 分批爬取 newPList 中尚未完成的题目并提交，getProblem 的含义同 DownloadProblems
+// getProblem 写入的文件表须为 fileList；中间提交的 problemlist.json 保持 newPList 的顺序
+// 有题目爬取失败时保留检查点并返回错误，重新运行时只爬取失败及剩余的题目
+func (b *Backfill) Run(fileList *FileList, newPList ProblemList, oldPList OldProblemList, getProblem func(*ProblemListItem) error) error {
+	cp, err := OpenCheckpoint(b.CheckpointPath, b.HomePath, oldPList)
+	if err != nil {
+		return err
+	}
+	cp.Files = fileList
+	cp.Submit = b.Submit
+	cp.Problems = newPList
+	dc := b.Download
+	if dc == nil {
+		dc = DefaultDownloadConfig
+	}
+	batchSize := b.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	oldPList.CopyTo(newPList)
+	tasks := make([]int, 0)
+	for k := range newPList {
+		if !cp.Done(newPList[k].Pid) {
+			// 忽略上次的原始数据哈希，使 getProblem 重新生成题面
+			newPList[k].UpstreamHash = ""
+			tasks = append(tasks, k)
+		}
+	}
+	p := newBackfillProgress(len(newPList), len(newPList)-len(tasks))
+	for len(tasks) > 0 {
+		n := batchSize
+		if n > len(tasks) {
+			n = len(tasks)
+		}
+		batch := tasks[:n]
+		tasks = tasks[n:]
+		errs := dc.download(newPList, batch, getProblem)
+		for _, k := range batch {
+			if errs[k] != nil && !errors.Is(errs[k], ErrUnchanged) {
+				p.failed++
+				continue
+			}
+			if err := cp.Add(&newPList[k]); err != nil {
+				log.Printf("记录题目%s时出现错误:%v", newPList[k].Pid, err)
+				p.failed++
+				continue
+			}
+			p.done++
+		}
+		if err := cp.Flush(); err != nil {
+			return err
+		}
+		log.Println(p)
+		if len(tasks) > 0 {
+			time.Sleep(b.Pause)
+		}
+	}
+	if p.failed > 0 {
+		return fmt.Errorf("%d 道题目回填失败，请重新运行以重试", p.failed)
+	}
+	return cp.Finish()
+}
+
+// 回填的进度，用于输出进度与预计剩余时间
+type backfillProgress struct {
+	total int
+	// 之前的运行中已完成的题目数
+	resumed int
+	done    int
+	failed  int
+	start   time.Time
+}
+
+func newBackfillProgress(total int, resumed int) *backfillProgress {
+	return &backfillProgress{total: total, resumed: resumed, start: time.Now()}
+}
+
+// 按本次运行的速度估计剩余时间
+func (p *backfillProgress) eta() time.Duration {
+	n := p.done + p.failed
+	if n == 0 {
+		return 0
+	}
+	rest := p.total - p.resumed - n
+	return time.Duration(float64(time.Since(p.start)) / float64(n) * float64(rest))
+}
+
+func (p *backfillProgress) String() string {
+	done := p.resumed + p.done
+	percent := 100.0
+	if p.total > 0 {
+		percent = float64(done) * 100 / float64(p.total)
+	}
+	return fmt.Sprintf("回填进度：%d/%d（%.1f%%），失败 %d 道，预计剩余 %v", done, p.total, percent, p.failed, p.eta().Round(time.Second))
+}
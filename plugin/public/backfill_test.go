@@ -0,0 +1,122 @@
+package public
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBackfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint", "oj-backfill.json")
+	old := OldProblemList{}
+	for _, pid := range []string{"1", "2", "3", "4", "5"} {
+		old[pid] = OldProblem{Title: pid, Fetched: 100, UpstreamHash: "h" + pid}
+	}
+	mu := sync.Mutex{}
+	fetched := make(map[string]int)
+	submitted := make([]map[string][]byte, 0)
+	broken := true
+	run := func() error {
+		fileList := NewFileList()
+		newPList := make(ProblemList, 0)
+		for _, pid := range []string{"1", "2", "3", "4", "5"} {
+			newPList = append(newPList, ProblemListItem{Pid: pid, Title: pid})
+		}
+		b := &Backfill{
+			HomePath:       "oj/",
+			CheckpointPath: path,
+			BatchSize:      2,
+			Download:       &DownloadConfig{Workers: 2},
+			Submit: func(files map[string][]byte) error {
+				submitted = append(submitted, files)
+				return nil
+			},
+		}
+		return b.Run(fileList, newPList, old, func(i *ProblemListItem) error {
+			mu.Lock()
+			fetched[i.Pid]++
+			mu.Unlock()
+			if i.UpstreamHash != "" {
+				return ErrUnchanged
+			}
+			if i.Pid == "3" && broken {
+				return errors.New("broken")
+			}
+			i.Data = &Problem{Title: i.Title, Description: "题面" + i.Pid}
+			fileList.Set("oj/"+i.Pid+"/img.png", []byte("png"))
+			return nil
+		})
+	}
+
+	if err := run(); err == nil {
+		t.Error("Run should fail when a problem fails")
+	}
+	if len(submitted) != 3 {
+		t.Fatalf("got %d submissions, want one per batch", len(submitted))
+	}
+	for k, pid := range []string{"1", "3", "5"} {
+		_, ok := submitted[k]["oj/"+pid+"/main.json"]
+		if ok == (pid == "3") {
+			t.Errorf("unexpected files in batch %d: %v", k, keys(submitted[k]))
+		}
+	}
+	if string(submitted[0]["oj/2/img.png"]) != "png" {
+		t.Errorf("files written by getProblem are not submitted")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("checkpoint is not kept after failure: %v", err)
+	}
+
+	broken = false
+	submitted = submitted[:0]
+	if err := run(); err != nil {
+		t.Fatal(err)
+	}
+	if fetched["1"] != 1 || fetched["3"] != 2 {
+		t.Errorf("finished problems are fetched again: %v", fetched)
+	}
+	if len(submitted) != 1 {
+		t.Fatalf("got %d submissions, want 1", len(submitted))
+	}
+	list := ProblemList{}
+	if err := json.Unmarshal(submitted[0]["oj/problemlist.json"], &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 5 {
+		t.Errorf("unexpected problem list: %+v", list)
+	}
+	for _, i := range list {
+		if i.Fetched == 100 || i.UpstreamHash == "h"+i.Pid {
+			t.Errorf("problem %s is not refetched: %+v", i.Pid, i)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint is not removed: %v", err)
+	}
+}
+
+func TestBackfillProgress(t *testing.T) {
+	p := newBackfillProgress(10, 4)
+	p.done, p.failed = 2, 1
+	if s := p.String(); !strings.Contains(s, "6/10（60.0%）") || !strings.Contains(s, "失败 1 道") {
+		t.Errorf("unexpected progress: %s", s)
+	}
+}
+
+func keys(m map[string][]byte) []string {
+	x := make([]string, 0, len(m))
+	for k := range m {
+		x = append(x, k)
+	}
+	return x
+}
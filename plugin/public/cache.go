@@ -0,0 +1,184 @@
+package public
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/PuerkitoBio/goquery"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrUnchanged 表示服务器返回 304，内容自上次缓存后未变化
+var ErrUnchanged = errors.New("not modified")
+
+// 大于此值的响应不缓存
+const cacheMaxSize = 32 << 20
+
+// CacheDir 为各题库磁盘缓存所在的目录，组件使用 NewDiskCache(CacheDir + 题库 id)
+var CacheDir = "./cache/"
+
+// DiskCache 将带有 ETag 或 Last-Modified 的 GET 响应保存在磁盘上，下次请求时发送条件请求
+type DiskCache struct {
+	Dir string
+}
+
+func NewDiskCache(dir string) *DiskCache {
+	return &DiskCache{Dir: dir}
+}
+
+type cacheMeta struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// 缓存内容的 MD5，用于发现损坏的缓存
+	MD5  string    `json:"md5,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// 返回缓存文件的路径，不含扩展名
+func (d *DiskCache) path(url string) string {
+	h := CalcMD5(url)
+	return filepath.Join(d.Dir, h[:2], h)
+}
+
+// 读取 url 的缓存信息，不存在时返回 nil
+func (d *DiskCache) load(url string) *cacheMeta {
+	b, err := ioutil.ReadFile(d.path(url) + ".json")
+	if err != nil {
+		return nil
+	}
+	m := &cacheMeta{}
+	if json.Unmarshal(b, m) != nil || m.Url != url {
+		return nil
+	}
+	return m
+}
+
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// 保存响应，返回 Body 可重新读取的响应；响应没有 ETag 与 Last-Modified 时不保存
+func (d *DiskCache) store(url string, res *http.Response) (*http.Response, error) {
+	m := &cacheMeta{Url: url, ETag: res.Header.Get("ETag"), LastModified: res.Header.Get("Last-Modified"), Time: time.Now()}
+	if m.ETag == "" && m.LastModified == "" || res.ContentLength > cacheMaxSize {
+		return res, nil
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if len(b) > cacheMaxSize {
+		return res, nil
+	}
+	// 缓存写入失败不影响本次请求
+	p := d.path(url)
+	m.MD5 = CalcMD5(string(b))
+	meta, err := json.Marshal(m)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+	}
+	if err == nil {
+		err = writeFileAtomic(p+".body", b, 0644)
+	}
+	if err == nil {
+		err = writeFileAtomic(p+".json", meta, 0644)
+	}
+	if err != nil {
+		log.Printf("写入缓存%s时出现错误:%v", url, err)
+	}
+	return res, nil
+}
+
+// 为条件请求设置请求头
+func (m *cacheMeta) setHeader(req *http.Request) {
+	if m.ETag != "" {
+		req.Header.Set("If-None-Match", m.ETag)
+	}
+	if m.LastModified != "" {
+		req.Header.Set("If-Modified-Since", m.LastModified)
+	}
+}
+
+// 服务器返回 304 时，用缓存的内容构造响应，状态码仍为 304
+// 缓存的内容丢失或损坏时删除缓存并返回 false，此时需不带条件请求头重新请求
+func (d *DiskCache) notModified(url string, m *cacheMeta, res *http.Response) (*http.Response, bool) {
+	p := d.path(url)
+	b, err := ioutil.ReadFile(p + ".body")
+	res.Body.Close()
+	if err == nil && m.MD5 != "" && CalcMD5(string(b)) != m.MD5 {
+		err = errors.New("checksum mismatch")
+	}
+	if err != nil {
+		log.Printf("缓存%s已损坏，重新下载:%v", url, err)
+		_ = os.Remove(p + ".json")
+		_ = os.Remove(p + ".body")
+		return nil, false
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	return res, true
+}
+
+// IsUnchanged 判断响应是否为内容未变化、来自缓存的响应
+func IsUnchanged(res *http.Response) bool {
+	return res.StatusCode == http.StatusNotModified
+}
+
+// DownloadIfChanged 同 Download，但内容自上次缓存后未变化时返回 ErrUnchanged
+// c.Cache 为 nil 时与 Download 相同
+func DownloadIfChanged(c *HttpConfig, url string) ([]byte, error) {
+	res, err := SafeGet(c, url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if IsUnchanged(res) {
+		return nil, ErrUnchanged
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// GetProblemDocument 下载题目 i 的页面，页面的哈希记入 i.UpstreamHash
+// 服务器返回 304 且缓存的页面与 i 上次归档时的相同时返回 ErrUnchanged；上次下载的页面未能归档时仍返回缓存的页面，不会因此漏掉题目
+func GetProblemDocument(c *HttpConfig, url string, i *ProblemListItem) (*goquery.Document, error) {
+	res, err := SafeGet(c, url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	h := CalcMD5(string(b))
+	if IsUnchanged(res) && h == i.UpstreamHash {
+		return nil, ErrUnchanged
+	}
+	i.UpstreamHash = h
+	return goquery.NewDocumentFromReader(bytes.NewReader(b))
+}
+
+// GetDocumentIfChanged 同 GetDocument，但内容自上次缓存后未变化时返回 ErrUnchanged
+func GetDocumentIfChanged(c *HttpConfig, url string) (*goquery.Document, error) {
+	res, err := SafeGet(c, url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if IsUnchanged(res) {
+		return nil, ErrUnchanged
+	}
+	return goquery.NewDocumentFromReader(res.Body)
+}
@@ -0,0 +1,124 @@
+package public
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	body := "<html><body>v1</body></html>"
+	etag := `"v1"`
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			hits++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	c := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy, RobotsPermission: "test", Cache: NewDiskCache(dir)}
+
+	b, err := DownloadIfChanged(c, server.URL)
+	if err != nil || string(b) != body {
+		t.Fatalf("first request = %q, %v", b, err)
+	}
+	if _, err := DownloadIfChanged(c, server.URL); !errors.Is(err, ErrUnchanged) {
+		t.Errorf("second request: got %v, want ErrUnchanged", err)
+	}
+	// Download 与 GetDocument 在内容未变化时返回缓存的内容
+	if b, err := Download(c, server.URL); err != nil || string(b) != body {
+		t.Errorf("Download from cache = %q, %v", b, err)
+	}
+	if doc, err := GetDocument(c, server.URL); err != nil || doc.Find("body").Text() != "v1" {
+		t.Errorf("GetDocument from cache failed: %v", err)
+	}
+	if hits != 3 {
+		t.Errorf("got %d conditional hits, want 3", hits)
+	}
+	// 缓存的页面尚未归档时仍返回其内容，归档后返回 ErrUnchanged
+	i := &ProblemListItem{Pid: "1"}
+	if doc, err := GetProblemDocument(c, server.URL, i); err != nil || doc.Find("body").Text() != "v1" || i.UpstreamHash == "" {
+		t.Errorf("GetProblemDocument for an unarchived page = %v, upstream hash %q", err, i.UpstreamHash)
+	}
+	if _, err := GetProblemDocument(c, server.URL, i); !errors.Is(err, ErrUnchanged) {
+		t.Errorf("GetProblemDocument for an archived page: got %v, want ErrUnchanged", err)
+	}
+
+	body, etag = "<html><body>v2</body></html>", `"v2"`
+	if doc, err := GetDocumentIfChanged(c, server.URL); err != nil || doc.Find("body").Text() != "v2" {
+		t.Errorf("changed page is not fetched again: %v", err)
+	}
+}
+
+func TestDownloadProblemsUnchanged(t *testing.T) {
+	list := ProblemList{{Pid: "1", Title: "a"}, {Pid: "2", Title: "b"}, {Pid: "3", Title: "c"}}
+	old := OldProblemList{"3": {Title: "c", UpstreamHash: "old"}}
+	DownloadProblems(nil, list, old, 3, func(i *ProblemListItem) error {
+		i.Data = &Problem{}
+		i.UpstreamHash = "new"
+		switch i.Pid {
+		case "1":
+			return ErrUnchanged
+		case "3":
+			return errors.New("broken")
+		}
+		return nil
+	})
+	if list[0].Data != nil || list[1].Data == nil {
+		t.Errorf("unchanged problem should be skipped: %+v", list)
+	}
+	// 爬取失败的题目保留上次归档时的原始数据哈希
+	if list[2].Data != nil || list[2].UpstreamHash != "old" {
+		t.Errorf("failed problem = %+v, want upstream hash %q", list[2], "old")
+	}
+}
+
+func TestDiskCacheCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	body := "v1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	c := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy, RobotsPermission: "test", Cache: NewDiskCache(dir)}
+	p := c.Cache.path(server.URL)
+	// 缓存的内容被修改或删除时不带条件请求头重新下载
+	for _, damage := range []func() error{
+		func() error { return ioutil.WriteFile(p+".body", []byte("v0"), 0644) },
+		func() error { return os.Remove(p + ".body") },
+	} {
+		if b, err := Download(c, server.URL); err != nil || string(b) != body {
+			t.Fatalf("Download = %q, %v", b, err)
+		}
+		if err := damage(); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := DownloadIfChanged(c, server.URL); err != nil || string(b) != body {
+			t.Errorf("DownloadIfChanged with a damaged cache = %q, %v", b, err)
+		}
+		if _, err := DownloadIfChanged(c, server.URL); !errors.Is(err, ErrUnchanged) {
+			t.Errorf("cache is not restored: got %v, want ErrUnchanged", err)
+		}
+	}
+}
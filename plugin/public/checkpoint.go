@@ -0,0 +1,212 @@
+package public
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Checkpoint 将一次耗时较长的爬取的进度保存在本地文件中，组件中断后重新运行时从中断处继续
+// 完成的题目通过 Add 写入 Files，每完成 BatchSize 道题目通过 Submit 提交一次
+// 检查点文件只记录已提交的题目，文件本身由已提交的批次保存；未提交的题目在中断后重新爬取
+type Checkpoint struct {
+	// 每完成 BatchSize 道题目提交一次，不大于 0 时只在 Finish 时提交
+	BatchSize int
+	// 提交文件的函数，一般调用主服务的 Update，返回错误时文件保留在 Files 中，下次提交时重试
+	Submit func(files map[string][]byte) error
+	// 爬取时写入的文件，图片、附件等请直接写入此文件表，以便与题目一起提交
+	Files *FileList
+	// 题库当前的题目列表，设置后 problemlist.json 按其顺序生成：未完成的题目使用已归档的数据，新题目只含列表中的信息
+	// 为 nil 时 problemlist.json 为已完成的题目与已归档的题目按题号排序
+	Problems ProblemList
+
+	path     string
+	homePath string
+	old      OldProblemList
+	mu       sync.Mutex
+	// 已完成的题目，Data 已写入 Files 后置为 nil；前 submitted 道已提交
+	done      ProblemList
+	doneSet   map[string]bool
+	submitted int
+}
+
+// 检查点文件的内容
+type checkpointFile struct {
+	// 已提交的题目
+	Done ProblemList `json:"done"`
+}
+
+// OpenCheckpoint 打开保存在 path 中的检查点，文件不存在时创建新的检查点
+// homePath 为题库目录，如 "tsinsen/"；old 为已归档的题目列表，用于生成中间提交的 problemlist.json，可为 nil
+func OpenCheckpoint(path string, homePath string, old OldProblemList) (*Checkpoint, error) {
+	c := &Checkpoint{Files: NewFileList(), path: path, homePath: homePath, old: old, doneSet: make(map[string]bool)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	x := checkpointFile{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return nil, err
+	}
+	for _, i := range x.Done {
+		c.done = append(c.done, i)
+		c.doneSet[i.Pid] = true
+	}
+	c.submitted = len(c.done)
+	return c, nil
+}
+
+// Done 判断题目 pid 是否已在之前的运行中完成
+func (c *Checkpoint) Done(pid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.doneSet[pid]
+}
+
+// Len 返回已完成的题目数
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.done)
+}
+
+// Add 记录题目 i 已爬取完成：更新 Fetched 与 Hash，将其文件写入 Files，并按 BatchSize 提交
+// 写入题目的文件失败时返回错误且不记录该题目，其余情况下返回的错误仅表示提交或保存进度失败，题目已被记录
+func (c *Checkpoint) Add(i *ProblemListItem) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.old.markFetched(i, Now())
+	if i.Data != nil {
+		if err := WriteProblem(i, c.Files, c.homePath); err != nil {
+			return err
+		}
+	}
+	item := *i
+	item.Data = nil
+	c.done = append(c.done, item)
+	c.doneSet[i.Pid] = true
+	if c.BatchSize > 0 && len(c.done)-c.submitted >= c.BatchSize {
+		return c.flush()
+	}
+	return nil
+}
+
+// List 返回已完成的题目及其余题目，用于生成 problemlist.json
+func (c *Checkpoint) List() ProblemList {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.list()
+}
+
+func (c *Checkpoint) list() ProblemList {
+	done := make(map[string]ProblemListItem, len(c.done))
+	for _, i := range c.done {
+		done[i.Pid] = i
+	}
+	if c.Problems != nil {
+		res := make(ProblemList, 0, len(c.Problems))
+		for _, i := range c.Problems {
+			if d, ok := done[i.Pid]; ok {
+				res = append(res, d)
+				continue
+			}
+			x := ProblemListItem{Pid: i.Pid, Title: i.Title, Updated: i.Updated}
+			if o, ok := c.old[i.Pid]; ok {
+				x.Fetched, x.Changed, x.Hash, x.UpstreamHash = o.Fetched, o.Changed, o.Hash, o.UpstreamHash
+				if x.Updated == 0 {
+					x.Updated = o.Updated
+				}
+			}
+			res = append(res, x)
+		}
+		return res
+	}
+	pids := make([]string, 0, len(done)+len(c.old))
+	for k := range done {
+		pids = append(pids, k)
+	}
+	for k := range c.old {
+		if _, ok := done[k]; !ok {
+			pids = append(pids, k)
+		}
+	}
+	sort.Strings(pids)
+	res := make(ProblemList, 0, len(pids))
+	for _, k := range pids {
+		if d, ok := done[k]; ok {
+			res = append(res, d)
+			continue
+		}
+		i := c.old[k]
+		res = append(res, ProblemListItem{Pid: k, Title: i.Title, Fetched: i.Fetched, Changed: i.Changed, Hash: i.Hash, Updated: i.Updated, UpstreamHash: i.UpstreamHash})
+	}
+	return res
+}
+
+// 将已提交的题目写入磁盘
+func (c *Checkpoint) save() error {
+	b, err := json.Marshal(checkpointFile{Done: c.done[:c.submitted]})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, b, 0644)
+}
+
+// Flush 连同 problemlist.json 与资源索引提交尚未提交的文件，成功后将进度写入磁盘；Submit 为 nil 时不做任何事
+func (c *Checkpoint) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+func (c *Checkpoint) flush() error {
+	if c.Submit == nil || len(c.done) == c.submitted {
+		return nil
+	}
+	files := NewFileList()
+	submitted := c.Files.Files()
+	for k, v := range submitted {
+		files.Set(k, v)
+	}
+	if err := WriteProblemList(c.list(), files, c.homePath); err != nil {
+		return err
+	}
+	if err := WriteAssetIndex(files, c.homePath); err != nil {
+		return err
+	}
+	x := files.Files()
+	if err := c.Submit(x); err != nil {
+		return err
+	}
+	CommitAssets(c.homePath, x)
+	// 提交期间其他 goroutine 可能仍在写入 Files，只移除已提交的文件
+	for k := range submitted {
+		c.Files.Delete(k)
+	}
+	c.submitted = len(c.done)
+	return c.save()
+}
+
+// Finish 提交剩余的文件，成功后删除检查点文件
+// Submit 为 nil 时不提交，组件需在调用前自行使用 Files 与 List 生成要提交的文件
+func (c *Checkpoint) Finish() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.flush(); err != nil {
+		return err
+	}
+	err := os.Remove(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package public
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint", "oj.json")
+	old := OldProblemList{"0": {Title: "old"}, "2": {Title: "b"}}
+	submitted := make([]map[string][]byte, 0)
+	fail := false
+	open := func() *Checkpoint {
+		c, err := OpenCheckpoint(path, "oj/", old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.BatchSize = 2
+		c.Submit = func(files map[string][]byte) error {
+			if fail {
+				return errors.New("submit failed")
+			}
+			submitted = append(submitted, files)
+			return nil
+		}
+		return c
+	}
+	add := func(c *Checkpoint, pid string) {
+		i := &ProblemListItem{Pid: pid, Title: pid, Data: &Problem{Title: pid, Description: "题面" + pid}}
+		if err := c.Add(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := open()
+	add(c, "1")
+	add(c, "2")
+	if len(submitted) != 1 {
+		t.Fatalf("got %d submissions, want 1", len(submitted))
+	}
+	list := ProblemList{}
+	if err := json.Unmarshal(submitted[0]["oj/problemlist.json"], &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Pid != "0" || list[1].Pid != "1" || list[2].Pid != "2" || list[1].Fetched == 0 {
+		t.Errorf("unexpected problem list: %+v", list)
+	}
+	if _, ok := submitted[0]["oj/2/main.json"]; !ok || c.Files.Len() != 0 {
+		t.Errorf("submitted files are not removed from checkpoint: %v", c.Files.Files())
+	}
+	// 检查点文件只记录已提交的题目，不含文件
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("files")) {
+		t.Errorf("checkpoint file contains files: %s", b)
+	}
+	// 提交失败时返回错误，未提交的题目不写入检查点文件
+	fail = true
+	add(c, "3")
+	if err := c.Flush(); err == nil {
+		t.Error("Flush should return the submit error")
+	}
+
+	// 重新打开时从最后一次提交处继续
+	fail = false
+	c = open()
+	if !c.Done("1") || !c.Done("2") || c.Done("3") || c.Len() != 2 {
+		t.Errorf("submitted problems are not restored")
+	}
+	// problemlist.json 按题库的顺序生成，包含尚未爬取的新题目
+	c.Problems = ProblemList{{Pid: "3", Title: "c"}, {Pid: "2", Title: "b"}, {Pid: "0", Title: "new title"}, {Pid: "4", Title: "d"}, {Pid: "1"}}
+	add(c, "3")
+	c.Files.Set("oj/_assets/a.png", []byte("png"))
+	if err := c.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if len(submitted) != 2 || string(submitted[1]["oj/_assets/a.png"]) != "png" {
+		t.Fatalf("remaining files are not submitted: %d submissions", len(submitted))
+	}
+	list = ProblemList{}
+	if err := json.Unmarshal(submitted[1]["oj/problemlist.json"], &list); err != nil {
+		t.Fatal(err)
+	}
+	pids := make([]string, 0)
+	for _, i := range list {
+		pids = append(pids, i.Pid)
+	}
+	if strings.Join(pids, ",") != "3,2,0,4,1" || list[0].Fetched == 0 || list[2].Title != "new title" || list[3].Fetched != 0 || list[4].Fetched == 0 {
+		t.Errorf("unexpected problem list: %+v", list)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file is not removed: %v", err)
+	}
+}
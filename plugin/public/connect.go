@@ -0,0 +1,19 @@
+package public
+
+import (
+	"crawler/rpc"
+	"google.golang.org/grpc"
+)
+
+// 主服务监听的地址
+const ServerAddr = "127.0.0.1:27381"
+
+// Connect 连接主服务，返回 API 客户端与断开连接的函数
+// 测试时可替换为 testserver 中的进程内实现，组件不应直接调用 grpc.Dial
+var Connect = func() (rpc.APIClient, func() error, error) {
+	conn, err := grpc.Dial(ServerAddr, grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
+	}
+	return rpc.NewAPIClient(conn), conn.Close, nil
+}
@@ -0,0 +1,192 @@
+// Package fakeoj 提供基于 httptest 的假题库，用于在可控的输入下测试各组件的解析逻辑
+//
+// 每个假题库只实现对应组件用到的页面。通过 Errors 与 Broken 可以让指定的请求返回错误状态码或损坏的内容，
+// 请求以 key 区分：一般为路径与查询参数，如 "/problems?page=2"；Lutece 的 GraphQL 请求见 NewLutece。
+// 设置 ETag 后，UOJ 与 SYZOJ 的题目页面支持条件请求，用于测试组件的磁盘缓存。
+package fakeoj
+
+import (
+	"crawler/plugin/public"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Sample struct {
+	Input  string
+	Output string
+}
+
+// Problem 为假题库中的一道题，题面各节的格式（markdown 或 html）由对应的题库决定
+type Problem struct {
+	Id          string
+	Title       string
+	Description string
+	Input       string
+	Output      string
+	Hint        string
+	Samples     []Sample
+	TimeLimit   int // 毫秒
+	MemoryLimit int // MB
+	// 是否为 Special Judge 题目
+	SpecialJudge bool
+	// SYZOJ 的附加文件，为 nil 时没有附加文件
+	AdditionalFile []byte
+}
+
+// 损坏的网页与 JSON，用于模拟页面结构变化或传输中断
+const (
+	brokenHtml = `<html><body><div class="container"><table><tr><td>`
+	brokenJson = `{"success":true,"data":{"`
+)
+
+type Server struct {
+	*httptest.Server
+	Problems []Problem
+	// 每页的题目数，默认为 50
+	PerPage int
+	// 非 0 时作为题目列表中显示的总页数，可大于实际页数
+	MaxPage int
+	// 对 key 对应的请求返回的状态码
+	Errors map[string]int
+	// 对 key 对应的请求返回损坏的内容
+	Broken map[string]bool
+	// HUSTOJ 的登录密码，为空时接受任意密码
+	Password string
+	// 为题目页面设置 ETag，请求的 If-None-Match 与之相同时返回 304
+	ETag bool
+
+	mu          sync.Mutex
+	requests    []string
+	notModified int
+	serve       func(s *Server, w http.ResponseWriter, r *http.Request)
+}
+
+func newServer(problems []Problem, serve func(s *Server, w http.ResponseWriter, r *http.Request)) *Server {
+	s := &Server{Problems: problems, PerPage: 50, Errors: make(map[string]int), Broken: make(map[string]bool), serve: serve}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serve(s, w, r)
+	}))
+	return s
+}
+
+// Requests 按顺序返回已收到的请求的 key
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// 记录请求；若 key 设置了错误状态码则返回该状态码并返回 true
+func (s *Server) inject(w http.ResponseWriter, key string) bool {
+	s.mu.Lock()
+	s.requests = append(s.requests, key)
+	code := s.Errors[key]
+	s.mu.Unlock()
+	if code == 0 {
+		return false
+	}
+	http.Error(w, http.StatusText(code), code)
+	return true
+}
+
+// NotModified 返回已返回 304 的请求数
+func (s *Server) NotModified() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notModified
+}
+
+// 设置了 ETag 时为内容 body 设置 ETag；请求的 If-None-Match 与之相同时返回 304 并返回 true
+func (s *Server) checkETag(w http.ResponseWriter, r *http.Request, body string) bool {
+	if !s.ETag {
+		return false
+	}
+	tag := `"` + public.CalcMD5(body) + `"`
+	w.Header().Set("ETag", tag)
+	if r.Header.Get("If-None-Match") != tag {
+		return false
+	}
+	s.mu.Lock()
+	s.notModified++
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+func (s *Server) broken(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Broken[key]
+}
+
+// 题目列表显示的总页数
+func (s *Server) pages() int {
+	if s.MaxPage != 0 {
+		return s.MaxPage
+	}
+	n := (len(s.Problems) + s.PerPage - 1) / s.PerPage
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// 第 n 页的题目，页数超出范围时为空
+func (s *Server) page(n int) []Problem {
+	l, r := (n-1)*s.PerPage, n*s.PerPage
+	if n < 1 || l >= len(s.Problems) {
+		return nil
+	}
+	if r > len(s.Problems) {
+		r = len(s.Problems)
+	}
+	return s.Problems[l:r]
+}
+
+func (s *Server) problem(id string) *Problem {
+	for k := range s.Problems {
+		if s.Problems[k].Id == id {
+			return &s.Problems[k]
+		}
+	}
+	return nil
+}
+
+func writeHtml(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(body))
+}
+
+func writeJson(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(body)
+}
+
+// 请求的 page 参数，未提供时为 1
+func pageParam(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// 保证 x 以换行结尾，用于拼接代码块
+func line(x string) string {
+	if strings.HasSuffix(x, "\n") {
+		return x
+	}
+	return x + "\n"
+}
+
+// NoDelay 去掉 DefaultHttpConfig 的等待时间与 DefaultRetryPolicy 的重试，使针对假题库的测试更快，返回恢复原设置的函数
+func NoDelay() func() {
+	sleep, retry := public.DefaultHttpConfig.SleepTime, public.DefaultRetryPolicy
+	public.DefaultHttpConfig.SleepTime, public.DefaultRetryPolicy = 0, &public.RetryPolicy{MaxAttempts: 1}
+	return func() {
+		public.DefaultHttpConfig.SleepTime, public.DefaultRetryPolicy = sleep, retry
+	}
+}
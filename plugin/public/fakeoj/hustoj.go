@@ -0,0 +1,107 @@
+package fakeoj
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// NewHUSTOJ 启动假的 HUSTOJ（BZOJ 使用的系统），提供 login.php、problemset.php?page=N 与 problem.php?id=:id
+// 题面各节为 html；设置了 Password 时，密码错误的登录请求返回 alert，未登录时页面的导航栏中有登录链接 loginpage.php
+func NewHUSTOJ(problems ...Problem) *Server {
+	return newServer(problems, serveHUSTOJ)
+}
+
+const hustojNav = `<div id="wrapper"><div id="main"><table width="100%" class="toprow"><tr><td><a href="./">F.A.Qs</a></td></tr></table></div></div>`
+
+// 登录后的会话 cookie
+const hustojSession = "fakeoj"
+
+// 返回导航栏，设置了 Password 且请求未带有有效的会话 cookie 时带有登录链接
+func hustojNavbar(s *Server, r *http.Request) string {
+	if s.Password == "" {
+		return hustojNav
+	}
+	if c, err := r.Cookie("PHPSESSID"); err == nil && c.Value == hustojSession {
+		return hustojNav
+	}
+	return strings.Replace(hustojNav, `</td></tr>`, `</td><td><a href="loginpage.php">Login</a></td></tr>`, 1)
+}
+
+func serveHUSTOJ(s *Server, w http.ResponseWriter, r *http.Request) {
+	key := r.URL.RequestURI()
+	if s.inject(w, key) {
+		return
+	}
+	switch r.URL.Path {
+	case "/login.php":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if s.Password != "" && r.PostFormValue("password") != s.Password {
+			writeHtml(w, "<script language='javascript'>\nalert('UserName or Password Wrong!');\nhistory.go(-1);\n</script>")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: hustojSession})
+		writeHtml(w, "<script language='javascript'>\nhistory.go(-2);\n</script>")
+	case "/problemset.php":
+		if s.broken(key) {
+			writeHtml(w, brokenHtml)
+			return
+		}
+		writeHtml(w, hustojProblemset(s, hustojNavbar(s, r), pageParam(r)))
+	case "/problem.php":
+		p := s.problem(r.URL.Query().Get("id"))
+		switch {
+		case p == nil:
+			writeHtml(w, "<html><body>"+hustojNavbar(s, r)+"<title>Problem is not Available!!</title><h2>Problem is not Available!!</h2></body></html>")
+		case s.broken(key):
+			writeHtml(w, brokenHtml)
+		default:
+			writeHtml(w, hustojProblem(p, hustojNavbar(s, r)))
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func hustojProblemset(s *Server, nav string, page int) string {
+	var b strings.Builder
+	b.WriteString("<html><head><title>Problem Set</title></head><body>" + nav + `<center><h3 align="center">`)
+	for i := 1; i <= s.pages(); i++ {
+		fmt.Fprintf(&b, `<a href="problemset.php?page=%d">%d</a>&nbsp;`, i, i)
+	}
+	b.WriteString(`</h3><table id="problemset" width="90%" class="table table-striped"><tbody>`)
+	for k, i := range s.page(page) {
+		class := "evenrow"
+		if k%2 == 1 {
+			class = "oddrow"
+		}
+		fmt.Fprintf(&b, `<tr class="%s"><td></td><td>%s</td><td><a href="problem.php?id=%s">%s</a></td><td></td></tr>`, class, i.Id, i.Id, html.EscapeString(i.Title))
+	}
+	b.WriteString(`</tbody></table></center></body></html>`)
+	return b.String()
+}
+
+func hustojProblem(p *Problem, nav string) string {
+	var b strings.Builder
+	title := html.EscapeString(p.Id + ": " + p.Title)
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body>%s<title>%s</title><center><h2>%s</h2>", title, nav, title, title)
+	fmt.Fprintf(&b, `<span class="green">Time Limit: </span>%d Sec&nbsp;&nbsp;<span class="green">Memory Limit: </span>%d MB<br>`, (p.TimeLimit+999)/1000, p.MemoryLimit)
+	if p.SpecialJudge {
+		b.WriteString(`<span class="red">Special Judge</span>`)
+	}
+	b.WriteString(`<span class="green">Submit: </span>0&nbsp;&nbsp;<span class="green">Solved: </span>0<br></center>`)
+	input, output := "", ""
+	if len(p.Samples) > 0 {
+		input = `<span class="sampledata">` + strings.ReplaceAll(html.EscapeString(strings.TrimRight(p.Samples[0].Input, "\n")), "\n", "<br>") + `</span>`
+		output = `<span class="sampledata">` + strings.ReplaceAll(html.EscapeString(strings.TrimRight(p.Samples[0].Output, "\n")), "\n", "<br>") + `</span>`
+	}
+	for _, i := range [][2]string{{"Description", p.Description}, {"Input", p.Input}, {"Output", p.Output}, {"Sample Input", input}, {"Sample Output", output}, {"HINT", p.Hint}, {"Source", ""}} {
+		fmt.Fprintf(&b, `<h2>%s</h2><div class="content">%s</div>`, i[0], i[1])
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package fakeoj
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NewLutece 启动假的 Lutece，在 /graphql 上回答 ProblemListGQL 与 ProblemDetailGQL 查询，题面各节为 markdown
+// 请求的 key 为 "/graphql?maxPage"（查询总页数）、"/graphql?page=N" 与 "/graphql?problem=:slug"
+func NewLutece(problems ...Problem) *Server {
+	return newServer(problems, serveLutece)
+}
+
+type luteceRequest struct {
+	OperationName string `json:"operationName"`
+	Query         string `json:"query"`
+	Variables     struct {
+		Page int    `json:"page"`
+		Slug string `json:"slug"`
+	} `json:"variables"`
+}
+
+func serveLutece(s *Server, w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/graphql" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	req := &luteceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var key string
+	var data interface{}
+	switch {
+	case req.OperationName == "ProblemListGQL" && strings.Contains(req.Query, "maxPage"):
+		key = "/graphql?maxPage"
+		data = map[string]interface{}{"problemList": map[string]interface{}{"maxPage": s.pages()}}
+	case req.OperationName == "ProblemListGQL":
+		key = "/graphql?page=" + strconv.Itoa(req.Variables.Page)
+		list := make([]map[string]string, 0)
+		for _, i := range s.page(req.Variables.Page) {
+			list = append(list, map[string]string{"title": i.Title, "slug": i.Id})
+		}
+		data = map[string]interface{}{"problemList": map[string]interface{}{"problemList": list}}
+	case req.OperationName == "ProblemDetailGQL":
+		key = "/graphql?problem=" + req.Variables.Slug
+		data = map[string]interface{}{"problem": luteceProblem(s.problem(req.Variables.Slug))}
+	default:
+		http.Error(w, "unknown operation", http.StatusBadRequest)
+		return
+	}
+	if s.inject(w, key) {
+		return
+	}
+	if s.broken(key) {
+		writeJson(w, []byte(brokenJson))
+		return
+	}
+	b, _ := json.Marshal(map[string]interface{}{"data": data})
+	writeJson(w, b)
+}
+
+func luteceProblem(p *Problem) interface{} {
+	if p == nil {
+		return nil
+	}
+	samples := make([]map[string]string, 0)
+	for _, i := range p.Samples {
+		samples = append(samples, map[string]string{"inputContent": i.Input, "outputContent": i.Output})
+	}
+	return map[string]interface{}{
+		"title":          p.Title,
+		"content":        p.Description,
+		"standardInput":  p.Input,
+		"standardOutput": p.Output,
+		"constraints":    "",
+		"resources":      "",
+		"note":           p.Hint,
+		"limitation":     map[string]int{"timeLimit": p.TimeLimit, "memoryLimit": p.MemoryLimit},
+		"samples":        map[string]interface{}{"sampleList": samples},
+	}
+}
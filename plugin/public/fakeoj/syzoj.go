@@ -0,0 +1,104 @@
+package fakeoj
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// NewSYZOJ 启动假的 SYZOJ，提供 /problems?page=N、/problem/:id/export 与 /problem/:id/download/additional_file
+// 题面各节为 markdown，样例以 SYZOJ 的格式写入 example
+func NewSYZOJ(problems ...Problem) *Server {
+	return newServer(problems, serveSYZOJ)
+}
+
+func serveSYZOJ(s *Server, w http.ResponseWriter, r *http.Request) {
+	key := r.URL.RequestURI()
+	if s.inject(w, key) {
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/problems":
+		if s.broken(key) {
+			writeHtml(w, brokenHtml)
+			return
+		}
+		writeHtml(w, syzojProblems(s, pageParam(r)))
+	case len(parts) == 3 && parts[0] == "problem" && parts[2] == "export":
+		if s.broken(key) {
+			writeJson(w, []byte(brokenJson))
+			return
+		}
+		body := syzojExport(s.problem(parts[1]))
+		if s.checkETag(w, r, string(body)) {
+			return
+		}
+		writeJson(w, body)
+	case len(parts) == 4 && parts[0] == "problem" && parts[2] == "download" && parts[3] == "additional_file":
+		p := s.problem(parts[1])
+		if p == nil || p.AdditionalFile == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, p.Id))
+		_, _ = w.Write(p.AdditionalFile)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func syzojProblems(s *Server, page int) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html lang="zh-CN"><head><title>题库</title></head><body><div class="ui main container">`)
+	b.WriteString(`<table class="ui very basic center aligned table"><thead><tr><th>编号</th><th class="left aligned">题目名称</th></tr></thead><tbody>`)
+	for _, i := range s.page(page) {
+		fmt.Fprintf(&b, "\n<tr><td><b>%s</b></td><td class=\"left aligned\"><a style=\"vertical-align: middle; \" href=\"/problem/%s\">%s</a></td></tr>", i.Id, i.Id, html.EscapeString(i.Title))
+	}
+	b.WriteString("\n</tbody></table>\n")
+	b.WriteString(`<div style="text-align: center; "><div class="ui pagination menu" style="box-shadow: none; "><a class="icon item" id="page_prev"><i class="left chevron icon"></i></a>`)
+	for i := 1; i <= s.pages(); i++ {
+		fmt.Fprintf(&b, `<a class="item" href="?page=%d">%d</a>`, i, i)
+	}
+	b.WriteString(`<a class="icon item" id="page_next"><i class="right chevron icon"></i></a></div></div></div></body></html>`)
+	return b.String()
+}
+
+func syzojExport(p *Problem) []byte {
+	if p == nil {
+		b, _ := json.Marshal(map[string]interface{}{"success": false, "error": map[string]string{"message": "无此题目。"}})
+		return b
+	}
+	example := ""
+	for k, i := range p.Samples {
+		if k > 0 {
+			example += "\n\n"
+		}
+		example += fmt.Sprintf("#### 样例输入\n\n```\n%s```\n\n#### 样例输出\n\n```\n%s```", line(i.Input), line(i.Output))
+	}
+	tags := []string{}
+	if p.SpecialJudge {
+		tags = append(tags, "Special Judge")
+	}
+	b, _ := json.Marshal(map[string]interface{}{
+		"success": true,
+		"obj": map[string]interface{}{
+			"title":                p.Title,
+			"description":          p.Description,
+			"input_format":         p.Input,
+			"output_format":        p.Output,
+			"example":              example,
+			"limit_and_hint":       p.Hint,
+			"time_limit":           p.TimeLimit,
+			"memory_limit":         p.MemoryLimit,
+			"have_additional_file": p.AdditionalFile != nil,
+			"file_io":              false,
+			"type":                 "traditional",
+			"tags":                 tags,
+		},
+	})
+	return b
+}
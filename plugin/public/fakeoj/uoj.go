@@ -0,0 +1,90 @@
+package fakeoj
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// NewUOJ 启动假的 UOJ，提供 /problems?page=N 与 /problem/:id，题面各节为 html
+// 没有时间限制的题目按提交答案题显示
+func NewUOJ(problems ...Problem) *Server {
+	return newServer(problems, serveUOJ)
+}
+
+const uojLayout = `<!DOCTYPE html><html lang="zh-cn"><head><title>UOJ</title></head><body><div class="container theme-showcase" role="main"><div class="uoj-content">%s</div></div></body></html>`
+
+func serveUOJ(s *Server, w http.ResponseWriter, r *http.Request) {
+	key := r.URL.RequestURI()
+	if s.inject(w, key) {
+		return
+	}
+	switch {
+	case r.URL.Path == "/problems":
+		if s.broken(key) {
+			writeHtml(w, brokenHtml)
+			return
+		}
+		writeHtml(w, fmt.Sprintf(uojLayout, uojPagination(s)+uojTable(s.page(pageParam(r)))))
+	case strings.HasPrefix(r.URL.Path, "/problem/"):
+		p := s.problem(strings.TrimPrefix(r.URL.Path, "/problem/"))
+		if p == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if s.broken(key) {
+			writeHtml(w, fmt.Sprintf(uojLayout, `<div class="tab-content"><div class="tab-pane active" id="tab-statement"></div></div>`))
+			return
+		}
+		body := fmt.Sprintf(uojLayout, uojStatement(p))
+		if s.checkETag(w, r, body) {
+			return
+		}
+		writeHtml(w, body)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// 分页与表格均不含空白文本节点，与 UOJ 的实际输出相同
+func uojPagination(s *Server) string {
+	var b strings.Builder
+	b.WriteString(`<div class="row"><div class="col-sm-4 col-sm-push-4"></div><div class="col-sm-4 col-sm-pull-4"><div class="text-center"><ul class="pagination top-buffer-no bot-buffer-sm"><li class="disabled"><a>&laquo;</a></li>`)
+	for i := 1; i <= s.pages(); i++ {
+		fmt.Fprintf(&b, `<li><a href="/problems?page=%d">%d</a></li>`, i, i)
+	}
+	b.WriteString(`<li class="disabled"><a>&raquo;</a></li></ul></div></div></div>`)
+	return b.String()
+}
+
+func uojTable(problems []Problem) string {
+	var b strings.Builder
+	b.WriteString(`<div class="table-responsive"><table class="table table-bordered table-hover table-striped"><thead><tr><th>ID</th><th>题目</th></tr></thead><tbody>`)
+	for _, i := range problems {
+		fmt.Fprintf(&b, `<tr><td>#%s</td><td><a href="/problem/%s">%s</a></td></tr>`, i.Id, i.Id, html.EscapeString(i.Title))
+	}
+	b.WriteString(`</tbody></table></div>`)
+	return b.String()
+}
+
+func uojStatement(p *Problem) string {
+	var b strings.Builder
+	b.WriteString(`<div class="tab-content"><div class="tab-pane active" id="tab-statement"><article class="top-buffer-md">`)
+	if p.TimeLimit > 0 {
+		fmt.Fprintf(&b, "<p><strong>时间限制</strong>：$%d\\texttt{s}$&nbsp;&nbsp;<strong>空间限制</strong>：$%d\\texttt{MB}$</p>\n", (p.TimeLimit+999)/1000, p.MemoryLimit)
+	}
+	for _, i := range [][2]string{{"题目描述", p.Description}, {"输入格式", p.Input}, {"输出格式", p.Output}} {
+		if i[1] != "" {
+			fmt.Fprintf(&b, "<h3>%s</h3>\n%s\n", i[0], i[1])
+		}
+	}
+	for k, i := range p.Samples {
+		fmt.Fprintf(&b, "<h3>样例%d</h3>\n<h4>input</h4>\n<pre>%s</pre>\n<h4>output</h4>\n<pre>%s</pre>\n", k+1, html.EscapeString(i.Input), html.EscapeString(i.Output))
+	}
+	if p.Hint != "" {
+		fmt.Fprintf(&b, "<h3>限制与约定</h3>\n%s\n", p.Hint)
+	}
+	b.WriteString(`</article></div></div>`)
+	return b.String()
+}
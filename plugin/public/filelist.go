@@ -0,0 +1,50 @@
+package public
+
+import "sync"
+
+// FileList 为此次要提交更新的文件表，key 为文件完整路径名，value 为文件内容
+// 可被多个 goroutine 同时写入，提交时使用 Files 取出
+type FileList struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewFileList() *FileList {
+	return &FileList{files: make(map[string][]byte)}
+}
+
+func (l *FileList) Set(name string, data []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.files[name] = data
+}
+
+func (l *FileList) Get(name string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.files[name]
+	return b, ok
+}
+
+func (l *FileList) Delete(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.files, name)
+}
+
+func (l *FileList) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.files)
+}
+
+// Files 返回文件表的副本，用于 rpc.UpdateRequest
+func (l *FileList) Files() map[string][]byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	x := make(map[string][]byte, len(l.files))
+	for k, v := range l.files {
+		x[k] = v
+	}
+	return x
+}
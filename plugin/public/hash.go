@@ -0,0 +1,49 @@
+package public
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ProblemHash 计算题目内容的哈希，用于发现标题未变但题面、限制等有变化的题目
+// 计算前统一换行符并去除行尾空白；Warnings 与原始 html 题面不参与计算
+func ProblemHash(p *Problem) string {
+	q := *p
+	q.Warnings = nil
+	q.OriginalDescription = ""
+	q.Description = normalizeForHash(q.Description)
+	q.Sections = make([]Section, len(p.Sections))
+	for k, i := range p.Sections {
+		i.Content = normalizeForHash(i.Content)
+		q.Sections[k] = i
+	}
+	b, err := json.Marshal(&q)
+	if err != nil {
+		return ""
+	}
+	parts := []string{string(b), q.Description}
+	for _, i := range q.Samples {
+		parts = append(parts, normalizeForHash(i.Input), normalizeForHash(i.Output))
+	}
+	return CalcMD5(strings.Join(parts, "\x00"))
+}
+
+// UpstreamHash 计算题库返回的原始数据的哈希，如 syzoj 的 export 接口返回的各字段
+// 用于在下载图片、附件前判断题目是否变化，变化时记入 ProblemListItem.UpstreamHash
+func UpstreamHash(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return CalcMD5(string(b))
+}
+
+// 统一换行符，去除行尾及首尾的空白
+func normalizeForHash(x string) string {
+	x = strings.ReplaceAll(x, "\r\n", "\n")
+	lines := strings.Split(x, "\n")
+	for k := range lines {
+		lines[k] = strings.TrimRight(lines[k], " \t\r")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
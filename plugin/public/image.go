@@ -0,0 +1,192 @@
+package public
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ImageConfig 为图片下载的校验与处理规则，各题库可在自己的 HttpConfig 中单独设置
+type ImageConfig struct {
+	// 单张图片的大小上限，单位为字节，不大于 0 时不限制
+	MaxSize int64
+	// 将 bmp 与 tiff 转换为 png
+	Transcode bool
+	// 以最高压缩率重新编码 png，结果更小时才替换
+	Recompress bool
+	// 图片的最大宽度与高度，超出时等比例缩小，不大于 0 时不限制；仅处理 png、jpg、bmp 与 tiff
+	MaxWidth  int
+	MaxHeight int
+}
+
+var DefaultImageConfig = &ImageConfig{MaxSize: 16 << 20}
+
+// 允许保存的图片类型及其扩展名
+// svg 中可以带有脚本与事件属性，归档后会作为可执行的内容提供，因此不保存
+var imageExtensions = map[string]string{
+	"image/png":    "png",
+	"image/jpeg":   "jpg",
+	"image/gif":    "gif",
+	"image/webp":   "webp",
+	"image/bmp":    "bmp",
+	"image/tiff":   "tiff",
+	"image/x-icon": "ico",
+}
+
+// DetectImageType 根据文件头判断图片类型，返回 MIME 类型，不是支持的图片时返回空串
+func DetectImageType(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("II*\x00")), bytes.HasPrefix(b, []byte("MM\x00*")):
+		return "image/tiff"
+	}
+	t := http.DetectContentType(b)
+	if _, ok := imageExtensions[t]; ok {
+		return t
+	}
+	return ""
+}
+
+// 判断是否为 svg：svg 会被识别为 xml 或纯文本，检查其根元素
+func isSvg(b []byte) bool {
+	s := bytes.TrimLeft(bytes.TrimPrefix(b, []byte("\ufeff")), " \t\r\n")
+	if len(s) > 1024 {
+		s = s[:1024]
+	}
+	s = bytes.ToLower(s)
+	return bytes.HasPrefix(s, []byte("<svg")) || bytes.HasPrefix(s, []byte("<?xml")) && bytes.Contains(s, []byte("<svg"))
+}
+
+// Check 校验下载到的图片，contentType 为响应头中的 Content-Type，返回图片的扩展名（不含 .）
+// 响应头声明的类型不是图片，或文件头与支持的图片格式都不符时返回错误
+func (ic *ImageConfig) Check(contentType string, b []byte) (string, error) {
+	if ic == nil {
+		ic = DefaultImageConfig
+	}
+	if len(b) == 0 {
+		return "", fmt.Errorf("empty file")
+	}
+	if ic.MaxSize > 0 && int64(len(b)) > ic.MaxSize {
+		return "", fmt.Errorf("file is too large: %d bytes", len(b))
+	}
+	if contentType != "" {
+		t, _, err := mime.ParseMediaType(contentType)
+		if err == nil && !strings.HasPrefix(t, "image/") && t != "application/octet-stream" && t != "binary/octet-stream" {
+			return "", fmt.Errorf("content type is %s", t)
+		}
+	}
+	t := DetectImageType(b)
+	if t == "" && isSvg(b) {
+		return "", fmt.Errorf("svg images are not archived")
+	}
+	if t == "" {
+		return "", fmt.Errorf("unknown image format (%s)", http.DetectContentType(b))
+	}
+	return imageExtensions[t], nil
+}
+
+// 是否需要对图片做任何处理
+func (ic *ImageConfig) processing() bool {
+	return ic.Transcode || ic.Recompress || ic.MaxWidth > 0 || ic.MaxHeight > 0
+}
+
+// 等比例缩小图片使其不超过最大宽度与高度，无需缩小时返回 nil
+func (ic *ImageConfig) resize(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	nw, nh := w, h
+	if ic.MaxWidth > 0 && nw > ic.MaxWidth {
+		nw, nh = ic.MaxWidth, nh*ic.MaxWidth/nw
+	}
+	if ic.MaxHeight > 0 && nh > ic.MaxHeight {
+		nw, nh = nw*ic.MaxHeight/nh, ic.MaxHeight
+	}
+	if nw == w && nh == h {
+		return nil
+	}
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// 处理图片时允许解码的最大像素数，解码后每个像素最多占用 8 字节
+const imageMaxPixels = 40 << 20
+
+// Process 按配置转换、压缩与缩小图片，ext 为 Check 返回的扩展名，返回处理后的图片及其扩展名
+// 无需处理或处理失败时返回原图；处理失败或像素数超过 imageMaxPixels 时同时返回错误
+func (ic *ImageConfig) Process(b []byte, ext string) ([]byte, string, error) {
+	if ic == nil || !ic.processing() {
+		return b, ext, nil
+	}
+	var decode func(io.Reader) (image.Image, error)
+	var decodeConfig func(io.Reader) (image.Config, error)
+	switch ext {
+	case "png":
+		decode, decodeConfig = png.Decode, png.DecodeConfig
+	case "jpg":
+		decode, decodeConfig = jpeg.Decode, jpeg.DecodeConfig
+	case "bmp":
+		decode, decodeConfig = bmp.Decode, bmp.DecodeConfig
+	case "tiff":
+		decode, decodeConfig = tiff.Decode, tiff.DecodeConfig
+	default:
+		return b, ext, nil
+	}
+	// 先读取尺寸，避免解码像素数过多的图片时占用大量内存
+	cfg, err := decodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return b, ext, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > imageMaxPixels {
+		return b, ext, fmt.Errorf("image is too large to process: %dx%d", cfg.Width, cfg.Height)
+	}
+	img, err := decode(bytes.NewReader(b))
+	if err != nil {
+		return b, ext, err
+	}
+	resized := ic.resize(img)
+	if resized != nil {
+		img = resized
+	}
+	var buf bytes.Buffer
+	out := ext
+	switch {
+	case ext == "jpg":
+		if resized == nil {
+			return b, ext, nil
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case ext == "png" || ic.Transcode:
+		if ext == "png" && resized == nil && !ic.Recompress {
+			return b, ext, nil
+		}
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+		if err == nil && ext == "png" && resized == nil && buf.Len() >= len(b) {
+			return b, ext, nil
+		}
+		out = "png"
+	case resized == nil:
+		return b, ext, nil
+	case ext == "bmp":
+		err = bmp.Encode(&buf, img)
+	case ext == "tiff":
+		err = tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate})
+	}
+	if err != nil {
+		return b, ext, err
+	}
+	return buf.Bytes(), out, nil
+}
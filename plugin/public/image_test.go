@@ -0,0 +1,110 @@
+package public
+
+import (
+	"bytes"
+	"encoding/binary"
+	"golang.org/x/image/bmp"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestImageCheck(t *testing.T) {
+	tests := []struct {
+		contentType string
+		file        string
+		ext         string
+	}{
+		{"image/png", "\x89PNG\r\n\x1a\n....", "png"},
+		{"", "\xff\xd8\xff\xdb", "jpg"},
+		{"application/octet-stream", "GIF87a", "gif"},
+		{"image/webp", "RIFF\x00\x00\x00\x00WEBPVP8 ", "webp"},
+		{"image/bmp", "BM\x00\x00", "bmp"},
+		{"image/tiff", "II*\x00\x08\x00", "tiff"},
+		{"image/svg+xml", "<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"><script>alert(1)</script></svg>", ""},
+		{"", "<svg onload=\"alert(1)\"></svg>", ""},
+		{"text/html; charset=utf-8", "\x89PNG\r\n\x1a\n", ""},
+		{"image/png", "<!DOCTYPE html><html>登录</html>", ""},
+		{"image/png", "", ""},
+		{"image/png", "just text", ""},
+	}
+	for _, i := range tests {
+		ext, err := DefaultImageConfig.Check(i.contentType, []byte(i.file))
+		if ext != i.ext || (err == nil) != (i.ext != "") {
+			t.Errorf("Check(%q, %q) = %q, %v, want %q", i.contentType, i.file, ext, err, i.ext)
+		}
+	}
+	small := &ImageConfig{MaxSize: 4}
+	if _, err := small.Check("image/gif", []byte("GIF89a")); err == nil {
+		t.Errorf("Check should reject files larger than MaxSize")
+	}
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	return img
+}
+
+func TestImageProcess(t *testing.T) {
+	var b bytes.Buffer
+	_ = bmp.Encode(&b, testImage(40, 20))
+	ic := &ImageConfig{Transcode: true, MaxWidth: 10}
+	res, ext, err := ic.Process(b.Bytes(), "bmp")
+	if err != nil || ext != "png" {
+		t.Fatalf("Process(bmp) = %s, %v, want png", ext, err)
+	}
+	img, err := png.Decode(bytes.NewReader(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := img.Bounds().Size(); s.X != 10 || s.Y != 5 {
+		t.Errorf("resized to %v, want 10x5", s)
+	}
+
+	// 未开启转换时只缩小尺寸，格式不变
+	res, ext, err = (&ImageConfig{MaxHeight: 10}).Process(b.Bytes(), "bmp")
+	if err != nil || ext != "bmp" {
+		t.Fatalf("Process(bmp) = %s, %v, want bmp", ext, err)
+	}
+	if img, err := bmp.Decode(bytes.NewReader(res)); err != nil || img.Bounds().Dy() != 10 {
+		t.Errorf("resize bmp failed: %v", err)
+	}
+
+	// 压缩后不变小的 png 保持原样
+	b.Reset()
+	_ = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&b, testImage(8, 8))
+	res, ext, err = (&ImageConfig{Recompress: true}).Process(b.Bytes(), "png")
+	if err != nil || ext != "png" || !bytes.Equal(res, b.Bytes()) {
+		t.Errorf("Process(png) changed an already compressed image")
+	}
+
+	// 无法解码时保留原图并返回错误
+	bad := []byte("BM not really a bitmap")
+	res, ext, err = ic.Process(bad, "bmp")
+	if err == nil || ext != "bmp" || !bytes.Equal(res, bad) {
+		t.Errorf("Process should keep the original on failure, got %s, %v", ext, err)
+	}
+}
+
+// 像素数过多的图片不解码，保留原图
+func TestImageProcessTooLarge(t *testing.T) {
+	var b bytes.Buffer
+	_ = png.Encode(&b, testImage(1, 1))
+	x := b.Bytes()
+	// 改写 IHDR 中的宽与高为 100000x100000 并重新计算校验和
+	binary.BigEndian.PutUint32(x[16:], 100000)
+	binary.BigEndian.PutUint32(x[20:], 100000)
+	binary.BigEndian.PutUint32(x[29:], crc32.ChecksumIEEE(x[12:29]))
+	res, ext, err := (&ImageConfig{MaxWidth: 10}).Process(x, "png")
+	if err == nil || !strings.Contains(err.Error(), "too large") || ext != "png" || !bytes.Equal(res, x) {
+		t.Errorf("Process should keep a huge image, got %s, %v", ext, err)
+	}
+}
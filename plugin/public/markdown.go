@@ -0,0 +1,412 @@
+package public
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"strings"
+)
+
+// 转换时用于占位的硬换行标记
+const mdHardBreak = "\ue000"
+
+var (
+	mdSpaceRule       = regexp.MustCompile(`[ \t\r\n\f]+`)
+	mdEntityRule      = regexp.MustCompile(`&([A-Za-z0-9#]+;)`)
+	mdLineStartRule   = regexp.MustCompile(`(?m)^([#>+-])( |$)`)
+	mdOrderedRule     = regexp.MustCompile(`(?m)^(\d+)\.( |$)`)
+	mdBlankLinesRule  = regexp.MustCompile(`\n{3,}`)
+	mdMathSegmentRule = regexp.MustCompile(`(?s)\$\$.+?\$\$|\$[^$\n]+?\$|\\\(.+?\\\)|\\\[.+?\\\]`)
+)
+
+// HTML2Markdown 将 html 片段转换为 markdown
+// 支持标题、段落、列表、表格、<pre> 代码块等常见结构，
+// 无法用 markdown 表示的 <sub>、<sup>、复杂表格等保留为 html，
+// 文本中的 $...$、\(...\) 等公式原样保留，<script type="math/tex"> 转换为 $...$
+func HTML2Markdown(s string) (string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return "", err
+	}
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, i := range nodes {
+		root.AppendChild(i)
+	}
+	res := strings.Join(mdBlocks(root), "\n\n")
+	res = mdBlankLinesRule.ReplaceAllString(res, "\n\n")
+	return strings.TrimSpace(res) + "\n", nil
+}
+
+// 将 p 的题面由 html 转换为 markdown，原 html 题面保存在 p.OriginalDescription 中
+func ToMarkdown(p *Problem) error {
+	if p.DescriptionType == "markdown" {
+		return nil
+	}
+	p.OriginalDescription = p.Description
+	if len(p.Sections) == 0 {
+		t, err := HTML2Markdown(p.Description)
+		if err != nil {
+			return err
+		}
+		p.Description = t
+	} else {
+		// 由 RenderSamples 生成的样例一节已是 markdown
+		rendered := strings.TrimRight(RenderSamples(p.Samples), "\n")
+		for k := range p.Sections {
+			if p.Sections[k].Type == SectionSamples && len(p.Samples) > 0 && p.Sections[k].Content == rendered {
+				continue
+			}
+			t, err := HTML2Markdown(p.Sections[k].Content)
+			if err != nil {
+				return err
+			}
+			p.Sections[k].Content = strings.TrimSpace(t)
+		}
+		p.Description = RenderSections(p.Sections)
+	}
+	p.DescriptionType = "markdown"
+	return nil
+}
+
+func isMdBlock(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.P, atom.Div, atom.Center, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Pre, atom.Ul, atom.Ol, atom.Dl, atom.Dt, atom.Dd,
+		atom.Blockquote, atom.Table, atom.Hr, atom.Figure, atom.Figcaption, atom.Body, atom.Html:
+		return true
+	}
+	return false
+}
+
+// 转换 n 的所有子节点，返回若干块
+func mdBlocks(n *html.Node) []string {
+	res := make([]string, 0)
+	buf := ""
+	flush := func() {
+		if t := mdParagraph(buf); t != "" {
+			res = append(res, t)
+		}
+		buf = ""
+	}
+	for i := n.FirstChild; i != nil; i = i.NextSibling {
+		if isMdBlock(i) {
+			flush()
+			res = append(res, mdBlock(i)...)
+		} else {
+			buf += mdInline(i)
+		}
+	}
+	flush()
+	return res
+}
+
+// 整理段落中的空白字符，并转义行首的 markdown 标记
+func mdParagraph(x string) string {
+	lines := strings.Split(x, mdHardBreak)
+	res := make([]string, 0, len(lines))
+	for _, i := range lines {
+		res = append(res, strings.TrimSpace(mdSpaceRule.ReplaceAllString(i, " ")))
+	}
+	for len(res) > 0 && res[len(res)-1] == "" {
+		res = res[:len(res)-1]
+	}
+	for len(res) > 0 && res[0] == "" {
+		res = res[1:]
+	}
+	t := strings.Join(res, "  \n")
+	t = mdLineStartRule.ReplaceAllString(t, `\$1$2`)
+	return mdOrderedRule.ReplaceAllString(t, `$1\.$2`)
+}
+
+func mdBlock(n *html.Node) []string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		t := strings.ReplaceAll(mdParagraph(mdChildrenInline(n)), "  \n", " ")
+		if t == "" {
+			return nil
+		}
+		return []string{strings.Repeat("#", int(n.Data[1]-'0')) + " " + t}
+	case atom.Pre:
+		t := normalizeSample(nodeText(n))
+		if t == "" {
+			return nil
+		}
+		return []string{strings.TrimSuffix(codeBlock(t), "\n")}
+	case atom.Hr:
+		return []string{"---"}
+	case atom.Ul, atom.Ol:
+		return []string{mdList(n)}
+	case atom.Blockquote:
+		t := strings.Join(mdBlocks(n), "\n\n")
+		if t == "" {
+			return nil
+		}
+		t = "> " + strings.ReplaceAll(t, "\n", "\n> ")
+		return []string{strings.ReplaceAll(t, "> \n", ">\n")}
+	case atom.Table:
+		return []string{mdTable(n)}
+	}
+	return mdBlocks(n)
+}
+
+func mdList(n *html.Node) string {
+	res := make([]string, 0)
+	cnt := 0
+	for i := n.FirstChild; i != nil; i = i.NextSibling {
+		if i.Type != html.ElementNode || i.DataAtom != atom.Li {
+			continue
+		}
+		cnt++
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", cnt)
+		}
+		t := strings.Join(mdBlocks(i), "\n\n")
+		indent := strings.Repeat(" ", len(marker))
+		t = strings.ReplaceAll(t, "\n", "\n"+indent)
+		t = strings.ReplaceAll(t, "\n"+indent+"\n", "\n\n")
+		res = append(res, marker+t)
+	}
+	return strings.Join(res, "\n")
+}
+
+// 表格中没有合并单元格且单元格中没有块级元素时转换为 markdown 表格，否则保留 html
+func mdTable(n *html.Node) string {
+	var rows [][]string
+	simple := true
+	var walk func(*html.Node)
+	walk = func(x *html.Node) {
+		for i := x.FirstChild; i != nil; i = i.NextSibling {
+			if i.Type != html.ElementNode {
+				continue
+			}
+			switch i.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(i)
+			case atom.Tr:
+				row := make([]string, 0)
+				for j := i.FirstChild; j != nil; j = j.NextSibling {
+					if j.Type != html.ElementNode || (j.DataAtom != atom.Td && j.DataAtom != atom.Th) {
+						continue
+					}
+					for _, a := range j.Attr {
+						if (a.Key == "colspan" || a.Key == "rowspan") && a.Val != "1" {
+							simple = false
+						}
+					}
+					b := mdBlocks(j)
+					cell := strings.ReplaceAll(strings.Join(b, ""), "  \n", "<br>")
+					cell, ok := mdTableCell(cell)
+					if len(b) > 1 || strings.Contains(cell, "\n") || !ok {
+						simple = false
+					}
+					row = append(row, cell)
+				}
+				rows = append(rows, row)
+			default:
+				simple = false
+			}
+		}
+	}
+	walk(n)
+	if !simple || len(rows) == 0 {
+		return Node2html(n)
+	}
+	width := 0
+	for _, i := range rows {
+		if len(i) > width {
+			width = len(i)
+		}
+	}
+	if width == 0 {
+		return ""
+	}
+	line := func(r []string) string {
+		for len(r) < width {
+			r = append(r, "")
+		}
+		return "| " + strings.Join(r, " | ") + " |"
+	}
+	res := []string{line(rows[0]), "|" + strings.Repeat(" --- |", width)}
+	for _, i := range rows[1:] {
+		res = append(res, line(i))
+	}
+	return strings.Join(res, "\n")
+}
+
+// 转义单元格中公式以外的 |；公式中含有 | 时无法在 markdown 表格中表示，返回 false
+func mdTableCell(x string) (string, bool) {
+	s := ""
+	last := 0
+	for _, m := range mdMathSegmentRule.FindAllStringIndex(x, -1) {
+		if strings.Contains(x[m[0]:m[1]], "|") {
+			return x, false
+		}
+		s += strings.ReplaceAll(x[last:m[0]], "|", `\|`) + x[m[0]:m[1]]
+		last = m[1]
+	}
+	return s + strings.ReplaceAll(x[last:], "|", `\|`), true
+}
+
+func mdChildrenInline(n *html.Node) string {
+	s := ""
+	for i := n.FirstChild; i != nil; i = i.NextSibling {
+		s += mdInline(i)
+	}
+	return s
+}
+
+func mdAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// 用 mark 包裹行内内容，内容首尾的空白移到 mark 外侧
+func mdWrap(t string, mark string) string {
+	inner := strings.TrimSpace(t)
+	if inner == "" {
+		return t
+	}
+	l := t[:strings.Index(t, inner)]
+	r := t[strings.Index(t, inner)+len(inner):]
+	return l + mark + inner + mark + r
+}
+
+func mdInline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return mdEscape(n.Data)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if isMdBlock(n) {
+		return mdHardBreak + strings.Join(mdBlock(n), mdHardBreak) + mdHardBreak
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		return mdHardBreak
+	case atom.Strong, atom.B:
+		return mdWrap(mdChildrenInline(n), "**")
+	case atom.Em, atom.I:
+		return mdWrap(mdChildrenInline(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return mdWrap(mdChildrenInline(n), "~~")
+	case atom.Code, atom.Tt, atom.Kbd, atom.Samp:
+		t := nodeText(n)
+		fence := "`"
+		for strings.Contains(t, fence) {
+			fence += "`"
+		}
+		if strings.HasPrefix(t, "`") || strings.HasSuffix(t, "`") {
+			t = " " + t + " "
+		}
+		return fence + t + fence
+	case atom.Sub, atom.Sup, atom.U:
+		return "<" + n.Data + ">" + mdChildrenInline(n) + "</" + n.Data + ">"
+	case atom.A:
+		t := mdChildrenInline(n)
+		href := mdAttr(n, "href")
+		if href == "" {
+			return t
+		}
+		if strings.TrimSpace(t) == "" {
+			return ""
+		}
+		if t == mdEscape(href) && IsUrl(href) {
+			return "<" + href + ">"
+		}
+		return "[" + t + "](" + mdUrl(href) + ")"
+	case atom.Img:
+		if mdAttr(n, "width") != "" || mdAttr(n, "height") != "" {
+			return Node2html(n)
+		}
+		title := ""
+		if t := mdAttr(n, "title"); t != "" {
+			title = ` "` + strings.ReplaceAll(t, `"`, `\"`) + `"`
+		}
+		return "![" + mdEscape(mdAttr(n, "alt")) + "](" + mdUrl(mdAttr(n, "src")) + title + ")"
+	case atom.Script:
+		t := mdAttr(n, "type")
+		if !strings.HasPrefix(t, "math/tex") {
+			return ""
+		}
+		if strings.Contains(t, "mode=display") {
+			return "$$" + nodeText(n) + "$$"
+		}
+		return "$" + nodeText(n) + "$"
+	case atom.Style, atom.Noscript, atom.Template, atom.Head, atom.Title, atom.Meta, atom.Link:
+		return ""
+	}
+	return mdChildrenInline(n)
+}
+
+func mdUrl(x string) string {
+	x = strings.TrimSpace(x)
+	if strings.ContainsAny(x, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(x) + ">"
+	}
+	return x
+}
+
+// [ 改写为实体而不转义为 \[，以免被识别为公式；"](" 改写为实体，避免与生成的链接文字构成链接
+var mdEscapeReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", "&#91;", "](", "]&#40;", "<", "&lt;")
+
+// 转义文本中的 markdown 标记，公式部分保持不变
+func mdEscape(x string) string {
+	s := ""
+	last := 0
+	for _, m := range mdMathSegmentRule.FindAllStringIndex(x, -1) {
+		s += mdEscapeText(x[last:m[0]]) + x[m[0]:m[1]]
+		last = m[1]
+	}
+	return s + mdEscapeText(x[last:])
+}
+
+func mdEscapeText(x string) string {
+	x = mdEntityRule.ReplaceAllString(x, "&amp;$1")
+	return mdEscapeReplacer.Replace(x)
+}
+
+// 返回节点中的纯文本，<br> 与块级元素转换为换行
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+		case html.ElementNode:
+			switch n.Data {
+			case "br":
+				b.WriteString("\n")
+				return
+			case "style":
+				return
+			case "script":
+				if !strings.HasPrefix(mdAttr(n, "type"), "math/tex") {
+					return
+				}
+			}
+		}
+		for i := n.FirstChild; i != nil; i = i.NextSibling {
+			walk(i)
+		}
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "p", "div", "li", "tr", "h1", "h2", "h3", "h4", "h5", "h6":
+				b.WriteString("\n")
+			}
+		}
+	}
+	walk(n)
+	return b.String()
+}
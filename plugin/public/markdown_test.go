@@ -0,0 +1,57 @@
+package public
+
+import (
+	"testing"
+)
+
+var html2MarkdownTests = []struct {
+	name string
+	in   string
+	out  string
+}{
+	// 表格
+	{"table", `<table><tr><th>a</th><th>b</th></tr><tr><td>1|2</td><td>$x$</td></tr><tr><td>3</td></tr></table>`, "| a | b |\n| --- | --- |\n| 1\\|2 | $x$ |\n| 3 |  |\n"},
+	{"table math with bar", `<table><tr><th>a</th></tr><tr><td>$|x|$</td></tr></table>`, "<table><tbody><tr><th>a</th></tr><tr><td>$|x|$</td></tr></tbody></table>\n"},
+	{"table colspan", `<table><tr><td colspan="2">a</td></tr></table>`, "<table><tbody><tr><td colspan=\"2\">a</td></tr></tbody></table>\n"},
+	{"table line break", `<table><tr><td>a<br>b</td></tr></table>`, "| a<br>b |\n| --- |\n"},
+
+	// 列表
+	{"unordered list", `<ul><li>a</li><li>b<ul><li>c</li></ul></li></ul>`, "- a\n- b\n\n  - c\n"},
+	{"ordered list", `<ol><li><p>a</p><p>b</p></li><li>c</li></ol>`, "1. a\n\n   b\n2. c\n"},
+	{"list marker in text", `<p># not a title</p><p>1. not a list</p><p>- item</p>`, "\\# not a title\n\n1\\. not a list\n\n\\- item\n"},
+
+	// 代码块
+	{"pre", "<pre>1 2\n3 4\n</pre>", "```\n1 2\n3 4\n```\n"},
+	{"pre with fence", "<pre>```\nx</pre>", "````\n```\nx\n````\n"},
+	{"pre with tags", "<pre><b>1</b>\n&lt;2&gt;</pre>", "```\n1\n<2>\n```\n"},
+	{"inline code", "<p><code>a*b</code> and <code>`</code></p>", "`a*b` and `` ` ``\n"},
+
+	// 上下标
+	{"sub sup", `<p>x<sub>i</sub> + 2<sup>n</sup></p>`, "x<sub>i</sub> + 2<sup>n</sup>\n"},
+	{"sup with emphasis", `<p>10<sup><b>9</b></sup></p>`, "10<sup>**9**</sup>\n"},
+
+	// 公式
+	{"math kept", `<p>$a_i*b_i$ and a_i*b</p>`, "$a_i*b_i$ and a\\_i\\*b\n"},
+	{"math paren", `<p>\(a_i\) and \[b_i\]</p>`, "\\(a_i\\) and \\[b_i\\]\n"},
+	{"math script", `<p><script type="math/tex">a<b</script> and <script type="math/tex; mode=display">\sum</script></p>`, "$a<b$ and $$\\sum$$\n"},
+
+	// 其他行内元素与转义
+	{"heading", `<h2>Title <b>x</b></h2><p>a<br>b</p>`, "## Title **x**\n\na  \nb\n"},
+	{"brackets", `<p>[1] see [a](b) and a[i]</p>`, "&#91;1] see &#91;a]&#40;b) and a&#91;i]\n"},
+	{"link and image", `<p><a href="https://x.com/a">link</a> <img src="a.png" alt="[x]"></p>`, "[link](https://x.com/a) ![&#91;x]](a.png)\n"},
+	{"autolink", `<p><a href="https://x.com/a_b">https://x.com/a_b</a></p>`, "<https://x.com/a_b>\n"},
+	{"html in text", `<p>&lt;script&gt; &amp;lt;</p>`, "&lt;script> &amp;lt;\n"},
+}
+
+func TestHTML2Markdown(t *testing.T) {
+	for _, i := range html2MarkdownTests {
+		out, err := HTML2Markdown(i.in)
+		if err != nil {
+			t.Errorf("%s: %v", i.name, err)
+			continue
+		}
+		if out != i.out {
+			t.Errorf("%s: HTML2Markdown(%q) = %q, want %q", i.name, i.in, out, i.out)
+		}
+	}
+}
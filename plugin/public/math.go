@@ -0,0 +1,333 @@
+package public
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// 公式在原文中的写法
+const (
+	MathDollar        = "$"       // $...$
+	MathDoubleDollar  = "$$"      // $$...$$
+	MathParen         = `\(`      // \(...\)
+	MathBracket       = `\[`      // \[...\]
+	MathScript        = "script"  // <script type="math/tex">...</script>
+	MathKaTeX         = "katex"   // KaTeX 渲染结果，TeX 源码位于 <annotation> 中
+	MathJaxRendered   = "mathjax" // MathJax 渲染结果，其后紧跟 <script type="math/tex">，规范化时删除
+	mathMaxInlineSpan = 2000
+)
+
+// MathSpan 为题面中的一处公式
+type MathSpan struct {
+	Start   int // 在原文中的起始位置
+	End     int // 在原文中的结束位置（不含）
+	Form    string
+	Tex     string
+	Display bool
+}
+
+var (
+	mathScriptRule   = regexp.MustCompile(`(?is)^<script[^>]*\btype\s*=\s*["']?math/tex([^"'>]*)["']?[^>]*>(.*?)</script\s*>`)
+	mathJaxRule      = regexp.MustCompile(`(?is)^<(span|div)[^>]*\bclass\s*=\s*["']?MathJax`)
+	mathKaTeXRule    = regexp.MustCompile(`(?is)^<(span|div)[^>]*\bclass\s*=\s*["']?katex(-display)?\b`)
+	mathAnnotation   = regexp.MustCompile(`(?is)<annotation[^>]*encoding\s*=\s*["']application/x-tex["'][^>]*>(.*?)</annotation>`)
+	mathCodeTagRule  = regexp.MustCompile(`(?i)^<(pre|code)[\s>]`)
+	mathFenceRule    = regexp.MustCompile("^(```+|~~~+)")
+	mathTagNameRule  = regexp.MustCompile(`(?i)^</?([a-z][a-z0-9-]*)`)
+	mathSpaceOrStart = regexp.MustCompile(`^\s*`)
+)
+
+// 跳过 text[i:] 开头的一个 html 元素（含嵌套的同名元素），返回元素结束的位置，未闭合时返回 -1
+func skipElement(text string, i int) int {
+	m := mathTagNameRule.FindStringSubmatch(text[i:])
+	if m == nil {
+		return -1
+	}
+	name := strings.ToLower(m[1])
+	depth := 0
+	for j := i; j < len(text); {
+		k := strings.IndexByte(text[j:], '<')
+		if k < 0 {
+			return -1
+		}
+		j += k
+		t := mathTagNameRule.FindStringSubmatch(text[j:])
+		end := strings.IndexByte(text[j:], '>')
+		if end < 0 {
+			return -1
+		}
+		if t != nil && strings.ToLower(t[1]) == name {
+			if text[j+1] == '/' {
+				depth--
+			} else if text[j+end-1] != '/' {
+				depth++
+			}
+		}
+		j += end + 1
+		if depth == 0 {
+			return j
+		}
+	}
+	return -1
+}
+
+// 判断 text[i] 处的字符是否被奇数个反斜杠转义
+func escaped(text string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && text[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// 在 text[from:] 中查找 $...$ 的结束位置
+// 采用与 pandoc 相同的规则避免把金额识别为公式：开头的 $ 右侧不能是空白，结尾的 $ 左侧不能是空白且右侧不能是数字
+func findDollarEnd(text string, from int) int {
+	if from >= len(text) || text[from] == ' ' || text[from] == '\t' || text[from] == '\n' {
+		return -1
+	}
+	for j := from; j < len(text) && j-from < mathMaxInlineSpan; j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '\n':
+			if rest := strings.TrimLeft(text[j+1:], " \t"); rest == "" || rest[0] == '\n' {
+				return -1
+			}
+		case '$':
+			if j == from {
+				return -1
+			}
+			if c := text[j-1]; c == ' ' || c == '\t' || c == '\n' {
+				continue
+			}
+			if j+1 < len(text) && text[j+1] >= '0' && text[j+1] <= '9' {
+				continue
+			}
+			return j
+		}
+	}
+	return -1
+}
+
+// 在 text[from:] 中查找未被转义的 delim，不跨越空行
+func findDelim(text string, from int, delim string) int {
+	for j := from; j < len(text); {
+		k := strings.Index(text[j:], delim)
+		if k < 0 {
+			return -1
+		}
+		if p := strings.Index(text[j:], "\n\n"); p >= 0 && p < k && delim != "$$" {
+			return -1
+		}
+		if !escaped(text, j+k) {
+			return j + k
+		}
+		j += k + len(delim)
+	}
+	return -1
+}
+
+// 从 text[i] 开始的反引号串为行内代码的开始时，返回行内代码的结束位置及开始反引号串的长度
+// 结束标记为长度相同的反引号串，找不到时返回 -1
+func inlineCodeEnd(text string, i int) (int, int) {
+	n := 1
+	for i+n < len(text) && text[i+n] == '`' {
+		n++
+	}
+	for j := i + n; j < len(text); {
+		k := strings.IndexByte(text[j:], '`')
+		if k < 0 {
+			break
+		}
+		s, e := j+k, j+k
+		for e < len(text) && text[e] == '`' {
+			e++
+		}
+		if e-s == n {
+			return e, n
+		}
+		j = e
+	}
+	return -1, n
+}
+
+// FindMath 找出题面中的所有公式，代码块、行内代码、<pre> 与 <code> 中的内容会被跳过
+func FindMath(text string) []MathSpan {
+	res := make([]MathSpan, 0)
+	for i := 0; i < len(text); {
+		c := text[i]
+		if i == 0 || text[i-1] == '\n' {
+			if m := mathFenceRule.FindString(strings.TrimLeft(text[i:], " \t")); m != "" {
+				// 代码块，跳到结束标记所在行的行末
+				e := strings.IndexByte(text[i:], '\n')
+				if e < 0 {
+					return res
+				}
+				closed := false
+				for pos := i + e + 1; pos < len(text); {
+					lineEnd := len(text)
+					if k := strings.IndexByte(text[pos:], '\n'); k >= 0 {
+						lineEnd = pos + k
+					}
+					if strings.HasPrefix(strings.TrimLeft(text[pos:lineEnd], " \t"), m) {
+						i, closed = lineEnd, true
+						break
+					}
+					pos = lineEnd + 1
+				}
+				if !closed {
+					return res
+				}
+				continue
+			}
+		}
+		switch {
+		case c == '\\' && i+1 < len(text):
+			if text[i+1] == '(' || text[i+1] == '[' {
+				display := text[i+1] == '['
+				end := `\)`
+				if display {
+					end = `\]`
+				}
+				if display && i > 0 && isAlnum(text[i-1]) {
+					i += 2
+					continue
+				}
+				if j := findDelim(text, i+2, end); j >= 0 && j > i+2 {
+					form := MathParen
+					if display {
+						form = MathBracket
+					}
+					res = append(res, MathSpan{Start: i, End: j + 2, Form: form, Tex: text[i+2 : j], Display: display})
+					i = j + 2
+					continue
+				}
+			}
+			i += 2
+		case c == '`':
+			end, n := inlineCodeEnd(text, i)
+			if end < 0 {
+				i += n
+				continue
+			}
+			i = end
+		case c == '$':
+			if i+1 < len(text) && text[i+1] == '$' {
+				if j := findDelim(text, i+2, "$$"); j > i+2 {
+					res = append(res, MathSpan{Start: i, End: j + 2, Form: MathDoubleDollar, Tex: text[i+2 : j], Display: true})
+					i = j + 2
+					continue
+				}
+				i += 2
+				continue
+			}
+			if j := findDollarEnd(text, i+1); j >= 0 {
+				res = append(res, MathSpan{Start: i, End: j + 1, Form: MathDollar, Tex: text[i+1 : j]})
+				i = j + 1
+				continue
+			}
+			i++
+		case c == '<':
+			rest := text[i:]
+			if mathCodeTagRule.MatchString(rest) {
+				name := strings.ToLower(mathCodeTagRule.FindStringSubmatch(rest)[1])
+				j := strings.Index(strings.ToLower(rest), "</"+name)
+				if j < 0 {
+					i++
+					continue
+				}
+				i += j + 2
+				continue
+			}
+			if m := mathScriptRule.FindStringSubmatch(rest); m != nil {
+				res = append(res, MathSpan{Start: i, End: i + len(m[0]), Form: MathScript, Tex: strings.TrimSpace(m[2]), Display: strings.Contains(m[1], "mode=display")})
+				i += len(m[0])
+				continue
+			}
+			if mathJaxRule.MatchString(rest) {
+				// MathJax 渲染结果：仅当其后紧跟 TeX 源码脚本时才可安全删除
+				j := skipElement(text, i)
+				if j > 0 {
+					k := j + len(mathSpaceOrStart.FindString(text[j:]))
+					for k < len(text) && mathJaxRule.MatchString(text[k:]) {
+						e := skipElement(text, k)
+						if e < 0 {
+							break
+						}
+						k = e + len(mathSpaceOrStart.FindString(text[e:]))
+					}
+					if k < len(text) && mathScriptRule.MatchString(text[k:]) {
+						res = append(res, MathSpan{Start: i, End: k, Form: MathJaxRendered})
+						i = k
+						continue
+					}
+				}
+				i++
+				continue
+			}
+			if m := mathKaTeXRule.FindStringSubmatch(rest); m != nil {
+				j := skipElement(text, i)
+				if j > 0 {
+					if a := mathAnnotation.FindStringSubmatch(text[i:j]); a != nil {
+						res = append(res, MathSpan{Start: i, End: j, Form: MathKaTeX, Tex: strings.TrimSpace(html.UnescapeString(a[1])), Display: m[2] != ""})
+						i = j
+						continue
+					}
+				}
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return res
+}
+
+// NormalizeMath 将题面中各种写法的公式统一改写为 $...$（行内）与 $$...$$（行间）
+func NormalizeMath(text string) string {
+	return normalizeMath(text, false)
+}
+
+// 公式改写到 html 文本中时需转义的字符
+var mathHtmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// NormalizeMathHTML 同 NormalizeMath，用于 html 题面：取自 <script> 与 KaTeX 的 TeX 源码是未转义的原文，改写为文本时转义其中的 <、> 与 &
+func NormalizeMathHTML(text string) string {
+	return normalizeMath(text, true)
+}
+
+func normalizeMath(text string, isHtml bool) string {
+	spans := FindMath(text)
+	if len(spans) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, i := range spans {
+		b.WriteString(text[last:i.Start])
+		last = i.End
+		switch i.Form {
+		case MathDollar, MathDoubleDollar:
+			b.WriteString(text[i.Start:i.End])
+		case MathJaxRendered:
+		default:
+			tex := i.Tex
+			if isHtml && (i.Form == MathScript || i.Form == MathKaTeX) {
+				tex = mathHtmlEscaper.Replace(tex)
+			}
+			if i.Display {
+				b.WriteString("$$" + tex + "$$")
+			} else {
+				b.WriteString("$" + tex + "$")
+			}
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package public
+
+import (
+	"testing"
+)
+
+// 用例取自各题库的真实题面片段
+var normalizeMathTests = []struct {
+	name string
+	in   string
+	out  string
+}{
+	// 已是规范写法的公式保持不变
+	{"loj dollar", "给定一个长度为 $n$ 的序列 $a_1, a_2, \\ldots, a_n$。", "给定一个长度为 $n$ 的序列 $a_1, a_2, \\ldots, a_n$。"},
+	{"loj display", "求\n\n$$\\sum_{i=1}^n \\sum_{j=1}^m \\gcd(i, j)$$\n\n的值。", "求\n\n$$\\sum_{i=1}^n \\sum_{j=1}^m \\gcd(i, j)$$\n\n的值。"},
+	{"uoj time limit", "<p><strong>时间限制：</strong>$1\\texttt{s}$</p>", "<p><strong>时间限制：</strong>$1\\texttt{s}$</p>"},
+	{"uoj memory limit", "<strong>空间限制：</strong>$512\\texttt{MB}$", "<strong>空间限制：</strong>$512\\texttt{MB}$"},
+	{"multiline display", "$$\nf(x) = \\begin{cases} 1 & x = 0 \\\\ 0 & x \\neq 0 \\end{cases}\n$$", "$$\nf(x) = \\begin{cases} 1 & x = 0 \\\\ 0 & x \\neq 0 \\end{cases}\n$$"},
+
+	// \( \) 与 \[ \]
+	{"paren inline", "对于 \\(30\\%\\) 的数据，\\(n \\le 1000\\)。", "对于 $30\\%$ 的数据，$n \\le 1000$。"},
+	{"bracket display", "答案为\n\\[\\prod_{i=1}^{n} a_i \\bmod p\\]\n", "答案为\n$$\\prod_{i=1}^{n} a_i \\bmod p$$\n"},
+	{"paren in html", "<p>输出 \\(\\lfloor \\frac{n}{2} \\rfloor\\)。</p>", "<p>输出 $\\lfloor \\frac{n}{2} \\rfloor$。</p>"},
+	{"pandoc math span", `<span class="math inline">\(x^2\)</span>`, `<span class="math inline">$x^2$</span>`},
+	{"pandoc display span", `<span class="math display">\[\sum x\]</span>`, `<span class="math display">$$\sum x$$</span>`},
+	{"escaped backslash paren", "路径为 C:\\\\(test)", "路径为 C:\\\\(test)"},
+	{"escaped bracket index", "a\\[i\\] 表示第 i 个数", "a\\[i\\] 表示第 i 个数"},
+	{"paren not closed", "\\(unclosed", "\\(unclosed"},
+	{"paren across paragraph", "\\(a\n\nb\\)", "\\(a\n\nb\\)"},
+	{"paren inside dollar", "$\\left(\\frac{a}{b}\\right)$", "$\\left(\\frac{a}{b}\\right)$"},
+
+	// MathJax 脚本
+	{"mathjax script", `<script type="math/tex">n \le 10^5</script>`, `$n \le 10^5$`},
+	{"mathjax script display", `<script type="math/tex; mode=display">\sum_{i=1}^n i</script>`, `$$\sum_{i=1}^n i$$`},
+	{"mathjax script with id", `<script type="math/tex" id="MathJax-Element-3">a_i</script>`, `$a_i$`},
+	{"mathjax script lt", `<script type="math/tex">1 < a_i < 10^9</script>`, `$1 < a_i < 10^9$`},
+	{"mathjax rendered", `<span class="MathJax_Preview" style="color: inherit;"></span><span class="MathJax" id="MathJax-Element-1-Frame" tabindex="0"><nobr><span class="math" id="MathJax-Span-1"><span class="mi">n</span></span></nobr></span><script type="math/tex" id="MathJax-Element-1">n</script> 个点`, `$n$ 个点`},
+	{"mathjax rendered display", `<span class="MathJax_Preview"></span><div class="MathJax_Display"><span class="MathJax"><span>x</span></span></div><script type="math/tex; mode=display">x</script>`, `$$x$$`},
+	{"mathjax rendered without source", `<span class="MathJax"><span class="mi">n</span></span> 个点`, `<span class="MathJax"><span class="mi">n</span></span> 个点`},
+	{"mathjax svg", `<span class="MathJax_SVG" id="MathJax-Element-2-Frame"><svg><g></g></svg></span><script type="math/tex" id="MathJax-Element-2">m</script>`, `$m$`},
+
+	// KaTeX
+	{"katex", `<span class="katex"><span class="katex-mathml"><math><semantics><mrow><mi>n</mi></mrow><annotation encoding="application/x-tex">n</annotation></semantics></math></span><span class="katex-html" aria-hidden="true"><span class="base"><span class="mord mathdefault">n</span></span></span></span>`, `$n$`},
+	{"katex entities", `<span class="katex"><span class="katex-mathml"><math><semantics><mrow></mrow><annotation encoding="application/x-tex">a &lt; b</annotation></semantics></math></span></span>`, `$a < b$`},
+	{"katex display", `<span class="katex-display"><span class="katex"><span class="katex-mathml"><math><semantics><annotation encoding="application/x-tex">\sum_i a_i</annotation></semantics></math></span></span></span>`, `$$\sum_i a_i$$`},
+	{"katex without annotation", `<span class="katex"><span>n</span></span>`, `<span class="katex"><span>n</span></span>`},
+
+	// 代码与金额不能被改动
+	{"inline code", "使用 `printf(\"\\(%d\\)\")` 输出", "使用 `printf(\"\\(%d\\)\")` 输出"},
+	{"double backtick code", "``a ` \\(x\\)`` 和 \\(y\\)", "``a ` \\(x\\)`` 和 $y$"},
+	{"fenced code", "```cpp\nputs(\"\\\\(x\\\\)\");\nprintf(\"\\(%d\\)\", n);\n```\n\\(n\\)", "```cpp\nputs(\"\\\\(x\\\\)\");\nprintf(\"\\(%d\\)\", n);\n```\n$n$"},
+	{"tilde fence", "~~~\n<script type=\"math/tex\">x</script>\n~~~", "~~~\n<script type=\"math/tex\">x</script>\n~~~"},
+	{"unclosed fence", "```\n\\(x\\)", "```\n\\(x\\)"},
+	{"pre block", "<pre>\\(1 2\\)\n</pre>\\(x\\)", "<pre>\\(1 2\\)\n</pre>$x$"},
+	{"code tag", "<code>\\[a\\]</code>", "<code>\\[a\\]</code>"},
+	{"currency", "每件商品 $5，两件 $10。", "每件商品 $5，两件 $10。"},
+	{"currency then math", "花费 $5 and $10，求 \\(n\\)", "花费 $5 and $10，求 $n$"},
+	{"escaped dollar", "价格为 \\$100，\\(x\\)", "价格为 \\$100，$x$"},
+	{"shell prompt", "$ ./a.out < in.txt", "$ ./a.out < in.txt"},
+
+	// 混合写法
+	{"mixed", "若 $a$ 与 \\(b\\) 互质，则 <script type=\"math/tex\">\\gcd(a,b)=1</script>。", "若 $a$ 与 $b$ 互质，则 $\\gcd(a,b)=1$。"},
+	{"bzoj html", "<div class=\"content\"><p>N&lt;=100000, \\(M \\le 10^6\\)</p></div>", "<div class=\"content\"><p>N&lt;=100000, $M \\le 10^6$</p></div>"},
+	{"no math", "输入一行两个整数 a, b。", "输入一行两个整数 a, b。"},
+	{"empty", "", ""},
+}
+
+func TestNormalizeMath(t *testing.T) {
+	for _, i := range normalizeMathTests {
+		if got := NormalizeMath(i.in); got != i.out {
+			t.Errorf("%s: NormalizeMath(%q) = %q, want %q", i.name, i.in, got, i.out)
+		}
+	}
+}
+
+// html 题面中，取自脚本与 KaTeX 的 TeX 源码改写为文本时保持实体转义
+func TestNormalizeMathHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"script lt", `<p><script type="math/tex">1 < a_i < 10^9</script></p>`, `<p>$1 &lt; a_i &lt; 10^9$</p>`},
+		{"script amp", `<script type="math/tex; mode=display">\begin{cases} a & b \end{cases}</script>`, `$$\begin{cases} a &amp; b \end{cases}$$`},
+		{"katex entities", `<span class="katex"><span class="katex-mathml"><math><semantics><mrow></mrow><annotation encoding="application/x-tex">a &lt; b &gt; c</annotation></semantics></math></span></span>`, `$a &lt; b &gt; c$`},
+		{"paren already escaped", `<p>\(a &lt; b\)</p>`, `<p>$a &lt; b$</p>`},
+		{"dollar kept", `<p>$a &lt; b$</p>`, `<p>$a &lt; b$</p>`},
+	}
+	for _, i := range tests {
+		if got := NormalizeMathHTML(i.in); got != i.out {
+			t.Errorf("%s: NormalizeMathHTML(%q) = %q, want %q", i.name, i.in, got, i.out)
+		}
+		if got := NormalizeMathHTML(i.out); got != i.out {
+			t.Errorf("%s: NormalizeMathHTML is not idempotent: %q -> %q", i.name, i.out, got)
+		}
+	}
+}
+
+func TestNormalizeMathIdempotent(t *testing.T) {
+	for _, i := range normalizeMathTests {
+		if got := NormalizeMath(i.out); got != i.out {
+			t.Errorf("%s: NormalizeMath is not idempotent: %q -> %q", i.name, i.out, got)
+		}
+	}
+}
+
+func TestFindMath(t *testing.T) {
+	text := "若 $a$ 与 \\(b\\) 互质，$$c$$ 与 <script type=\"math/tex; mode=display\">d</script>"
+	want := []MathSpan{
+		{Form: MathDollar, Tex: "a"},
+		{Form: MathParen, Tex: "b"},
+		{Form: MathDoubleDollar, Tex: "c", Display: true},
+		{Form: MathScript, Tex: "d", Display: true},
+	}
+	got := FindMath(text)
+	if len(got) != len(want) {
+		t.Fatalf("FindMath found %d spans, want %d: %+v", len(got), len(want), got)
+	}
+	for k, i := range got {
+		if i.Form != want[k].Form || i.Tex != want[k].Tex || i.Display != want[k].Display {
+			t.Errorf("span %d = %+v, want %+v", k, i, want[k])
+		}
+		if i.Start < 0 || i.End > len(text) || i.Start >= i.End {
+			t.Errorf("span %d has bad range [%d, %d)", k, i.Start, i.End)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package public
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ProxyConfig 为题库的代理设置，支持 http、https 与 socks5 代理
+type ProxyConfig struct {
+	// 默认使用的代理地址，如 "http://127.0.0.1:8080"、"socks5://127.0.0.1:1080"，为空时直连
+	Url string
+	// 代理认证的用户名与密码，地址中已带有用户名时以地址中的为准
+	Username string
+	Password string
+	// 各域名单独使用的代理地址，key 同 HttpConfig.Limits，值为 "direct" 时直连
+	Hosts map[string]string
+
+	mu sync.Mutex
+	// 使用代理的 Client，key 为未使用代理的 Client
+	clients map[*http.Client]*http.Client
+}
+
+// ProxyConfigPath 为各题库代理设置的文件，内容为题库 id 到 ProxyConfig 的 json 对象
+var ProxyConfigPath = "./config/proxy.json"
+
+// LoadProxyConfig 从 ProxyConfigPath 读取题库 id 的代理设置，文件不存在或未设置该题库时返回 nil
+// 组件将返回的设置赋给自己的 HttpConfig.Proxy，不影响同一进程中的其他组件
+func LoadProxyConfig(id string) (*ProxyConfig, error) {
+	b, err := ioutil.ReadFile(ProxyConfigPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	x := make(map[string]*ProxyConfig)
+	err = json.Unmarshal(b, &x)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ProxyConfigPath, err)
+	}
+	p := x[id]
+	if p != nil {
+		err = p.Check()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Check 检查所有代理地址是否合法
+func (p *ProxyConfig) Check() error {
+	if _, err := p.parse(p.Url); err != nil {
+		return err
+	}
+	for _, i := range p.Hosts {
+		if _, err := p.parse(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解析代理地址 x 并加上认证信息，直连时返回 nil
+func (p *ProxyConfig) parse(x string) (*url.URL, error) {
+	if x == "" || x == "direct" {
+		return nil, nil
+	}
+	u, err := url.Parse(x)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", x, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %q", x, u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", x)
+	}
+	if u.User == nil && p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u, nil
+}
+
+// 返回对域名 host 的请求所用的代理地址，直连时返回 nil
+func (p *ProxyConfig) proxyUrl(host string) (*url.URL, error) {
+	host = strings.ToLower(host)
+	if x, ok := p.Hosts[host]; ok {
+		return p.parse(x)
+	}
+	if k := strings.LastIndexByte(host, ':'); k >= 0 {
+		if x, ok := p.Hosts[host[:k]]; ok {
+			return p.parse(x)
+		}
+	}
+	if x, ok := p.Hosts["*"]; ok {
+		return p.parse(x)
+	}
+	return p.parse(p.Url)
+}
+
+// Proxy 返回 req 所用的代理地址，可用作 http.Transport.Proxy
+func (p *ProxyConfig) Proxy(req *http.Request) (*url.URL, error) {
+	return p.proxyUrl(req.URL.Host)
+}
+
+// 返回通过代理发出请求的 client 副本；client 的 Transport 不是 *http.Transport 时无法设置代理，返回错误而不是直连
+// 需要包装 Transport 的插件请包装 HttpConfig.Transport() 的返回值，其已按该配置的代理设置
+func (p *ProxyConfig) client(client *http.Client) (*http.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[client]; ok {
+		return c, nil
+	}
+	var t *http.Transport
+	switch x := client.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = x.Clone()
+	default:
+		return nil, fmt.Errorf("cannot set proxy on transport %T", x)
+	}
+	t.Proxy = p.Proxy
+	c := *client
+	c.Transport = t
+	if p.clients == nil {
+		p.clients = make(map[*http.Client]*http.Client)
+	}
+	p.clients[client] = &c
+	return &c, nil
+}
@@ -0,0 +1,121 @@
+package public
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	auth := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Proxy-Authorization")
+		_, _ = w.Write([]byte("proxy " + r.URL.String()))
+	}))
+	defer proxy.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("direct"))
+	}))
+	defer server.Close()
+	p := &ProxyConfig{Url: proxy.URL, Username: "user", Password: "pass", Hosts: map[string]string{server.Listener.Addr().String(): "direct"}}
+	c := &HttpConfig{Proxy: p, RobotsPermission: "test"}
+
+	b, err := Download(c, "http://oj.example/problem/1")
+	if err != nil || string(b) != "proxy http://oj.example/problem/1" {
+		t.Errorf("Download = %q, %v, want the proxy's response", b, err)
+	}
+	if want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass")); auth != want {
+		t.Errorf("Proxy-Authorization = %q, want %q", auth, want)
+	}
+	b, err = Download(c, server.URL)
+	if err != nil || string(b) != "direct" {
+		t.Errorf("Download = %q, %v, want a direct connection", b, err)
+	}
+	// 插件包装的 Transport 已设置代理
+	if tr, err := c.Transport(); err != nil || tr.(*http.Transport).Proxy == nil {
+		t.Errorf("Transport() = %v, %v, want a transport with proxy", tr, err)
+	}
+	// 无法设置代理时返回错误，不直连
+	x := &HttpConfig{Client: &http.Client{Transport: &countTransport{}}, Proxy: p, RobotsPermission: "test"}
+	if _, err := Download(x, server.URL); err == nil {
+		t.Error("Download with an unproxiable transport should fail")
+	}
+	if _, err := x.Transport(); err == nil {
+		t.Error("Transport() with an unproxiable transport should fail")
+	}
+	// 未设置代理的 HttpConfig 使用 DefaultHttpConfig.Proxy
+	defer func() { DefaultHttpConfig.Proxy = nil }()
+	DefaultHttpConfig.Proxy = p
+	b, err = Download(&HttpConfig{RobotsPermission: "test"}, "http://oj.example/")
+	if err != nil || string(b) != "proxy http://oj.example/" {
+		t.Errorf("Download = %q, %v, want the proxy's response", b, err)
+	}
+}
+
+func TestProxyUrl(t *testing.T) {
+	p := &ProxyConfig{
+		Url:      "http://127.0.0.1:8080",
+		Username: "user",
+		Hosts:    map[string]string{"a.example": "socks5://u:p@127.0.0.1:1080", "b.example:8443": "direct"},
+	}
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"a.example", "socks5://u:p@127.0.0.1:1080"},
+		{"A.example:443", "socks5://u:p@127.0.0.1:1080"},
+		{"b.example:8443", ""},
+		{"b.example", "http://user:@127.0.0.1:8080"},
+	}
+	for _, i := range tests {
+		u, err := p.proxyUrl(i.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != i.want {
+			t.Errorf("proxyUrl(%q) = %q, want %q", i.host, got, i.want)
+		}
+	}
+	for _, i := range []string{"ftp://127.0.0.1", "127.0.0.1:8080", "http://"} {
+		if err := (&ProxyConfig{Url: i}).Check(); err == nil {
+			t.Errorf("Check(%q) should fail", i)
+		}
+	}
+}
+
+func TestLoadProxyConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(x string) { ProxyConfigPath = x }(ProxyConfigPath)
+	ProxyConfigPath = filepath.Join(dir, "proxy.json")
+	if p, err := LoadProxyConfig("oj"); err != nil || p != nil {
+		t.Errorf("LoadProxyConfig without config file = %+v, %v", p, err)
+	}
+	data := `{"oj": {"url": "socks5://127.0.0.1:1080", "hosts": {"cdn.example": "direct"}}, "bad": {"url": "ftp://x"}}`
+	if err := ioutil.WriteFile(ProxyConfigPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := LoadProxyConfig("oj"); err != nil || p == nil || p.Hosts["cdn.example"] != "direct" {
+		t.Errorf("LoadProxyConfig = %+v, %v", p, err)
+	}
+	if DefaultHttpConfig.Proxy != nil {
+		t.Errorf("LoadProxyConfig should not change DefaultHttpConfig")
+	}
+	if p, err := LoadProxyConfig("other"); err != nil || p != nil {
+		t.Errorf("LoadProxyConfig for a problemset without proxy = %+v, %v", p, err)
+	}
+	if _, err := LoadProxyConfig("bad"); err == nil {
+		t.Error("LoadProxyConfig should reject an invalid proxy")
+	}
+}
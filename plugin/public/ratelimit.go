@@ -0,0 +1,212 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimit 为对一个域名的访问限制，同一进程中对同一域名的所有请求共享同一组令牌、每日请求数与连接
+// 不同的 HttpConfig 对同一域名设置了不同的限制时，各项均取其中最严格的
+type HostLimit struct {
+	// 平均每秒的请求数，不大于 0 时不限制
+	Rate float64
+	// 允许连续发出的请求数，不大于 0 时视为 1
+	Burst int
+	// 每天最多的请求数，不大于 0 时不限制
+	DailyBudget int
+	// 同时进行的请求数上限，不大于 0 时不限制；响应的 Body 被关闭时才算请求结束
+	MaxConns int
+}
+
+// ErrBudgetExhausted 表示当天对该域名的请求数已达到 DailyBudget
+var ErrBudgetExhausted = errors.New("daily request budget exhausted")
+
+type hostLimiter struct {
+	mu     sync.Mutex
+	limit  HostLimit
+	tokens float64
+	last   time.Time
+	day    string
+	count  int
+	// 正在进行的请求数，有请求结束时关闭 released 并换成新的
+	conns    int
+	released chan struct{}
+}
+
+var (
+	hostLimiters   = make(map[string]*hostLimiter)
+	hostLimitersMu sync.Mutex
+)
+
+// 返回域名 host 的限制器，并将其限制收紧至不宽于 limit；limit 为空且 host 尚无限制器时返回 nil
+func getHostLimiter(host string, limit HostLimit) *hostLimiter {
+	hostLimitersMu.Lock()
+	l, ok := hostLimiters[host]
+	if !ok {
+		if limit == (HostLimit{}) {
+			hostLimitersMu.Unlock()
+			return nil
+		}
+		l = &hostLimiter{limit: limit, tokens: float64(limit.Burst), last: time.Now(), released: make(chan struct{})}
+		hostLimiters[host] = l
+		hostLimitersMu.Unlock()
+		return l
+	}
+	hostLimitersMu.Unlock()
+	l.tighten(limit)
+	return l
+}
+
+// 返回 a 与 b 中较小的正数，都不大于 0 时返回 0
+func minPositive(a, b int) int {
+	if a <= 0 || b > 0 && b < a {
+		return b
+	}
+	return a
+}
+
+// 将 l 的各项限制收紧为与 limit 中较严格的一个
+func (l *hostLimiter) tighten(limit HostLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit.Rate > 0 {
+		if l.limit.Rate <= 0 {
+			l.limit.Rate, l.limit.Burst = limit.Rate, limit.Burst
+		} else {
+			if limit.Rate < l.limit.Rate {
+				l.limit.Rate = limit.Rate
+			}
+			if limit.Burst < l.limit.Burst {
+				l.limit.Burst = limit.Burst
+			}
+		}
+	}
+	l.limit.DailyBudget = minPositive(l.limit.DailyBudget, limit.DailyBudget)
+	l.limit.MaxConns = minPositive(l.limit.MaxConns, limit.MaxConns)
+}
+
+// 等待令牌桶中有可用的令牌
+func (l *hostLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if day := now.Format("2006-01-02"); day != l.day {
+			l.day, l.count = day, 0
+		}
+		if l.limit.DailyBudget > 0 && l.count >= l.limit.DailyBudget {
+			l.mu.Unlock()
+			return ErrBudgetExhausted
+		}
+		if l.limit.Rate <= 0 {
+			l.count++
+			l.mu.Unlock()
+			return nil
+		}
+		burst := float64(l.limit.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		l.tokens += now.Sub(l.last).Seconds() * l.limit.Rate
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.count++
+			l.mu.Unlock()
+			return nil
+		}
+		d := time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second))
+		l.mu.Unlock()
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// 占用一个连接，返回释放连接的函数
+func (l *hostLimiter) acquire(ctx context.Context) (func(), error) {
+	for {
+		l.mu.Lock()
+		if l.limit.MaxConns <= 0 || l.conns < l.limit.MaxConns {
+			l.conns++
+			l.mu.Unlock()
+			break
+		}
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.conns--
+			close(l.released)
+			l.released = make(chan struct{})
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+// 返回对域名 host 的请求所适用的限制，未设置时返回 nil
+func (c *HttpConfig) hostLimit(host string) *HostLimit {
+	host = strings.ToLower(host)
+	if l, ok := c.Limits[host]; ok {
+		return l
+	}
+	if k := strings.LastIndexByte(host, ':'); k >= 0 {
+		if l, ok := c.Limits[host[:k]]; ok {
+			return l
+		}
+	}
+	return c.Limits["*"]
+}
+
+// 按 c.Limits 与 robots.txt 要求的请求间隔 crawlDelay 等待对 host 发出请求的许可，返回请求结束时需调用的函数
+func (c *HttpConfig) waitHost(ctx context.Context, host string, crawlDelay time.Duration) (func(), error) {
+	limit := HostLimit{}
+	if l := c.hostLimit(host); l != nil {
+		limit = *l
+	}
+	if crawlDelay > 0 {
+		if rate := float64(time.Second) / float64(crawlDelay); limit.Rate <= 0 || limit.Rate > rate {
+			limit.Rate, limit.Burst = rate, 1
+		}
+	}
+	// 未设置限制的请求也受其他设置对该域名的限制
+	l := getHostLimiter(strings.ToLower(host), limit)
+	if l == nil {
+		return func() {}, nil
+	}
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// 关闭时释放连接的响应 Body
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
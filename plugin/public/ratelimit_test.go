@@ -0,0 +1,136 @@
+package public
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func limitedServer(h http.HandlerFunc, limit *HostLimit) (*httptest.Server, *HttpConfig) {
+	server := httptest.NewServer(h)
+	u, _ := url.Parse(server.URL)
+	return server, &HttpConfig{Client: server.Client(), Retry: testRetryPolicy, Limits: map[string]*HostLimit{u.Host: limit}, RobotsPermission: "test"}
+}
+
+func TestHostLimitRate(t *testing.T) {
+	server, c := limitedServer(func(w http.ResponseWriter, r *http.Request) {}, &HostLimit{Rate: 100, Burst: 1})
+	defer server.Close()
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := Download(c, server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("6 requests at 100/s took %v", d)
+	}
+}
+
+func TestHostLimitConns(t *testing.T) {
+	var mu sync.Mutex
+	now, max := 0, 0
+	server, c := limitedServer(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		now++
+		if now > max {
+			max = now
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		now--
+		mu.Unlock()
+	}, &HostLimit{MaxConns: 2})
+	defer server.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Download(c, server.URL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if max > 2 {
+		t.Errorf("%d concurrent requests, want at most 2", max)
+	}
+}
+
+func TestHostLimitBudget(t *testing.T) {
+	server, c := limitedServer(func(w http.ResponseWriter, r *http.Request) {}, &HostLimit{DailyBudget: 2})
+	defer server.Close()
+	for i := 0; i < 3; i++ {
+		_, err := Download(c, server.URL)
+		if i < 2 && err != nil || i == 2 && !errors.Is(err, ErrBudgetExhausted) {
+			t.Errorf("request %d: got %v", i, err)
+		}
+	}
+}
+
+func TestHostLimitShared(t *testing.T) {
+	server, c := limitedServer(func(w http.ResponseWriter, r *http.Request) {}, &HostLimit{DailyBudget: 1})
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	other := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy, Limits: map[string]*HostLimit{u.Host: {DailyBudget: 3}}, RobotsPermission: "test"}
+	free := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy, RobotsPermission: "test"}
+	if _, err := Download(other, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	// 对同一域名的请求共享每日请求数，并使用各设置中最严格的限制
+	for k, i := range []*HttpConfig{c, other, free} {
+		if _, err := Download(i, server.URL); !errors.Is(err, ErrBudgetExhausted) {
+			t.Errorf("request %d: got %v, want ErrBudgetExhausted", k, err)
+		}
+	}
+}
+
+func TestHostLimitSharedConns(t *testing.T) {
+	var mu sync.Mutex
+	now, max := 0, 0
+	server, c := limitedServer(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		now++
+		if now > max {
+			max = now
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		now--
+		mu.Unlock()
+	}, &HostLimit{MaxConns: 4})
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	other := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy, Limits: map[string]*HostLimit{u.Host: {MaxConns: 1}}, RobotsPermission: "test"}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		x := c
+		if i%2 == 1 {
+			x = other
+		}
+		if i < 2 {
+			// 先依次发出请求，使两个设置的限制都已生效
+			if _, err := Download(x, server.URL); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Download(x, server.URL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if max > 1 {
+		t.Errorf("%d concurrent requests, want at most 1", max)
+	}
+}
@@ -0,0 +1,269 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserAgent 为请求默认的 User-Agent，表明爬虫的身份并提供联系方式
+var UserAgent = "OI-Archive-Crawler/1.0 (+https://github.com/oi-archive/crawler)"
+
+// RetryPolicy 为请求失败时的重试策略
+type RetryPolicy struct {
+	// 最多请求的次数，含第一次请求
+	MaxAttempts int
+	// 第一次重试前的等待时间，之后每次翻倍，但不超过 MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// 等待时间的随机浮动比例，取值 0~1
+	Jitter float64
+	// 需要重试的状态码，其余非 2xx 状态码直接返回错误
+	RetryStatus map[int]bool
+	// 服务器通过 Retry-After 要求等待的时间超过此值时不再重试，不大于 0 时不限制
+	MaxRetryAfter time.Duration
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:   3,
+	BaseDelay:     time.Second,
+	MaxDelay:      30 * time.Second,
+	Jitter:        0.2,
+	RetryStatus:   map[int]bool{408: true, 429: true, 500: true, 502: true, 503: true, 504: true},
+	MaxRetryAfter: 2 * time.Minute,
+}
+
+// 按状态码区分的请求错误，可用 errors.Is 判断
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrRateLimited = errors.New("rate limited")
+	ErrServerError = errors.New("server error")
+)
+
+// HTTPError 为服务器返回非 2xx 状态码时的错误
+type HTTPError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	// 服务器通过 Retry-After 要求等待的时间，未提供时为 0
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s error,status code = %d", strings.ToLower(e.Method), e.Url, e.StatusCode)
+}
+
+func (e *HTTPError) Unwrap() error {
+	switch {
+	case e.StatusCode == 404 || e.StatusCode == 410:
+		return ErrNotFound
+	case e.StatusCode == 429:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServerError
+	}
+	return nil
+}
+
+// 第 attempt 次重试前的等待时间
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// 解析 Retry-After 响应头，支持秒数与 http 日期两种格式
+func parseRetryAfter(x string) time.Duration {
+	x = strings.TrimSpace(x)
+	if x == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(x); err == nil {
+		if s < 0 {
+			return 0
+		}
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(x); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// 等待 d，context 被取消时提前返回错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// 返回对域名 host 的请求单独设置的请求头，未设置时返回 nil
+func (c *HttpConfig) hostHeader(host string) http.Header {
+	host = strings.ToLower(host)
+	if h, ok := c.HostHeader[host]; ok {
+		return h
+	}
+	if k := strings.LastIndexByte(host, ':'); k >= 0 {
+		return c.HostHeader[host[:k]]
+	}
+	return nil
+}
+
+// 按 UserAgent、c.Header 与 c.HostHeader 的顺序设置 req 的请求头，后者覆盖前者中的同名项
+func (c *HttpConfig) setHeader(req *http.Request) {
+	req.Header.Set("User-Agent", UserAgent)
+	header := c.Header
+	if header == nil {
+		header = DefaultHttpConfig.Header
+	}
+	for _, h := range []http.Header{header, c.hostHeader(req.URL.Host)} {
+		for k, v := range h {
+			req.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+		}
+	}
+}
+
+// DoRequest 是所有请求的入口：遵守 robots.txt 与 c.Limits 的限制，按 c.Retry 重试失败的请求，并在 context 被取消时立即返回
+// body 为 nil 时不发送请求体；返回的错误可用 errors.Is 与 ErrNotFound、ErrDisallowed 等比较
+// 设置了 c.Cache 时 GET 请求会发送条件请求，内容未变化时返回状态码为 304、Body 为缓存内容的响应
+func DoRequest(ctx context.Context, c *HttpConfig, method string, url string, contentType string, body []byte) (*http.Response, error) {
+	if c == nil {
+		c = DefaultHttpConfig
+	}
+	p := c.Retry
+	if p == nil {
+		p = DefaultRetryPolicy
+	}
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	crawlDelay, err := c.checkRobots(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	var cached *cacheMeta
+	if c.Cache != nil && method == http.MethodGet {
+		cached = c.Cache.load(url)
+	}
+	err = sleepContext(ctx, c.SleepTime)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, url, r)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		c.setHeader(req)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if cached != nil {
+			cached.setHeader(req)
+		}
+		release, err := c.waitHost(ctx, req.URL.Host, crawlDelay)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(req)
+		wait := time.Duration(0)
+		if err != nil {
+			release()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		} else {
+			res.Body = &releaseBody{res.Body, release}
+			if res.StatusCode == http.StatusNotModified && cached != nil {
+				if r, ok := c.Cache.notModified(url, cached, res); ok {
+					return r, nil
+				}
+				// 缓存已损坏，不带条件请求头立即重新请求
+				cached = nil
+				continue
+			}
+			if res.StatusCode >= 200 && res.StatusCode < 300 {
+				if c.Cache != nil && method == http.MethodGet {
+					return c.Cache.store(url, res)
+				}
+				return res, nil
+			}
+			e := &HTTPError{Method: method, Url: url, StatusCode: res.StatusCode, RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"))}
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+			res.Body.Close()
+			if !p.RetryStatus[res.StatusCode] || p.MaxRetryAfter > 0 && e.RetryAfter > p.MaxRetryAfter {
+				return nil, e
+			}
+			err, wait = e, e.RetryAfter
+		}
+		if attempt >= p.MaxAttempts {
+			return nil, err
+		}
+		if d := p.delay(attempt); d > wait {
+			wait = d
+		}
+		if e := sleepContext(ctx, wait); e != nil {
+			return nil, e
+		}
+	}
+}
+
+// SafeGetContext 同 SafeGet，可通过 ctx 取消
+func SafeGetContext(ctx context.Context, c *HttpConfig, url string) (*http.Response, error) {
+	return DoRequest(ctx, c, http.MethodGet, url, "", nil)
+}
+
+// SafePostContext 同 SafePost，可通过 ctx 取消
+func SafePostContext(ctx context.Context, c *HttpConfig, url string, contentType string, data []byte) (*http.Response, error) {
+	if data == nil {
+		data = []byte{}
+	}
+	return DoRequest(ctx, c, http.MethodPost, url, contentType, data)
+}
+
+// DownloadContext 同 Download，可通过 ctx 取消
+func DownloadContext(ctx context.Context, c *HttpConfig, url string) ([]byte, error) {
+	res, err := SafeGetContext(ctx, c, url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
@@ -0,0 +1,171 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = &RetryPolicy{
+	MaxAttempts:   3,
+	BaseDelay:     time.Millisecond,
+	MaxDelay:      5 * time.Millisecond,
+	RetryStatus:   DefaultRetryPolicy.RetryStatus,
+	MaxRetryAfter: time.Second,
+}
+
+func TestDoRequestRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(503)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	c := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy, RobotsPermission: "test"}
+	b, err := Download(c, server.URL)
+	if err != nil || string(b) != "ok" || calls != 3 {
+		t.Errorf("Download = %q, %v after %d calls, want ok after 3 calls", b, err, calls)
+	}
+}
+
+func TestDoRequestErrors(t *testing.T) {
+	calls := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		switch r.URL.Path {
+		case "/404":
+			w.WriteHeader(404)
+		case "/429":
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(429)
+		case "/429-long":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(429)
+		case "/500":
+			w.WriteHeader(500)
+		case "/403":
+			w.WriteHeader(403)
+		}
+	}))
+	defer server.Close()
+	c := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy}
+	tests := []struct {
+		path   string
+		target error
+		calls  int
+	}{
+		{"/404", ErrNotFound, 1},
+		{"/429", ErrRateLimited, 3},
+		{"/429-long", ErrRateLimited, 1},
+		{"/500", ErrServerError, 3},
+		{"/403", nil, 1},
+	}
+	for _, i := range tests {
+		_, err := SafeGet(c, server.URL+i.path)
+		var e *HTTPError
+		if !errors.As(err, &e) {
+			t.Errorf("%s: got %v, want *HTTPError", i.path, err)
+			continue
+		}
+		if i.target != nil && !errors.Is(err, i.target) {
+			t.Errorf("%s: got %v, want %v", i.path, err, i.target)
+		}
+		if calls[i.path] != i.calls {
+			t.Errorf("%s: requested %d times, want %d", i.path, calls[i.path], i.calls)
+		}
+	}
+}
+
+func TestDoRequestContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer server.Close()
+	c := &HttpConfig{Client: server.Client(), Retry: &RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour, RetryStatus: DefaultRetryPolicy.RetryStatus}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := SafeGetContext(ctx, c, server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Errorf("got %v after %v, want context.DeadlineExceeded", err, time.Since(start))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("120"); d != 120*time.Second {
+		t.Errorf("parseRetryAfter(120) = %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d < 50*time.Second || d > time.Minute {
+		t.Errorf("parseRetryAfter(date) = %v", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("parseRetryAfter(soon) = %v", d)
+	}
+}
+
+type countTransport struct {
+	calls int
+}
+
+func (t *countTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestDefaultClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	tr := &countTransport{}
+	DefaultHttpConfig.Client = &http.Client{Transport: tr}
+	defer func() { DefaultHttpConfig.Client = nil }()
+	// 未设置 Client 的配置也使用 DefaultHttpConfig.Client
+	c := &HttpConfig{Retry: testRetryPolicy, RobotsPermission: "test"}
+	if _, err := Download(c, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if x, err := c.Transport(); err != nil || x != tr {
+		t.Errorf("Transport() = %v, %v, want the default client's transport", x, err)
+	}
+	if tr.calls != 1 {
+		t.Errorf("default client used %d times, want 1", tr.calls)
+	}
+}
+
+func TestDoRequestHeader(t *testing.T) {
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("User-Agent") + "|" + r.Header.Get("Accept-Language") + "|" + r.Header.Get("Referer")))
+	}
+	a := httptest.NewServer(http.HandlerFunc(echo))
+	defer a.Close()
+	b := httptest.NewServer(http.HandlerFunc(echo))
+	defer b.Close()
+	c := &HttpConfig{
+		RobotsPermission: "test",
+		Header:           http.Header{"accept-language": {"zh-CN"}},
+		HostHeader:       map[string]http.Header{b.Listener.Addr().String(): {"User-Agent": {"special"}, "Referer": {b.URL + "/"}}},
+	}
+	tests := []struct {
+		c    *HttpConfig
+		url  string
+		want string
+	}{
+		{c, a.URL, UserAgent + "|zh-CN|"},
+		{c, b.URL, "special|zh-CN|" + b.URL + "/"},
+		{&HttpConfig{RobotsPermission: "test"}, a.URL, UserAgent + "||"},
+	}
+	for _, i := range tests {
+		res, err := Download(i.c, i.url)
+		if err != nil || string(res) != i.want {
+			t.Errorf("Download(%s) = %q, %v, want %q", i.url, res, err, i.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package public
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RobotsUserAgent 为在 robots.txt 中匹配规则时使用的爬虫名称
+var RobotsUserAgent = "OI-Archive-Crawler"
+
+// ErrDisallowed 表示链接被 robots.txt 禁止访问
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// robots.txt 的缓存时间与最大长度
+const (
+	robotsTTL     = 24 * time.Hour
+	robotsMaxSize = 512 << 10
+)
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// RobotsRules 为 robots.txt 中适用于本爬虫的规则
+type RobotsRules struct {
+	rules []robotsRule
+	// 两次请求间的最小间隔，未设置时为 0
+	CrawlDelay time.Duration
+}
+
+// 将 robots.txt 中的路径规则转换为正则表达式，支持 * 与结尾的 $
+func robotsPattern(x string) *regexp.Regexp {
+	end := strings.HasSuffix(x, "$")
+	x = strings.TrimSuffix(x, "$")
+	parts := strings.Split(x, "*")
+	for k, i := range parts {
+		parts[k] = regexp.QuoteMeta(i)
+	}
+	p := "^" + strings.Join(parts, ".*")
+	if end {
+		p += "$"
+	}
+	return regexp.MustCompile(p)
+}
+
+// ParseRobots 解析 robots.txt，返回适用于 userAgent 的规则
+// 存在名称与 userAgent 的产品名（"/" 之前的部分）相同（不区分大小写）的组时使用该组，否则使用 User-agent: * 的组
+func ParseRobots(b []byte, userAgent string) *RobotsRules {
+	type group struct {
+		agents []string
+		lines  [][2]string
+	}
+	groups := make([]*group, 0)
+	var now *group
+	lastAgent := false
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		if k := strings.IndexByte(line, '#'); k >= 0 {
+			line = line[:k]
+		}
+		k := strings.IndexByte(line, ':')
+		if k < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:k]))
+		value := strings.TrimSpace(line[k+1:])
+		if key == "user-agent" {
+			if !lastAgent || now == nil {
+				now = &group{}
+				groups = append(groups, now)
+			}
+			now.agents = append(now.agents, robotsProduct(value))
+			lastAgent = true
+			continue
+		}
+		lastAgent = false
+		if now != nil {
+			now.lines = append(now.lines, [2]string{key, value})
+		}
+	}
+
+	name := robotsProduct(userAgent)
+	var matched []*group
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a != "*" && a != "" && a == name {
+				matched = append(matched, g)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if a == "*" {
+					matched = append(matched, g)
+					break
+				}
+			}
+		}
+	}
+
+	res := &RobotsRules{}
+	for _, g := range matched {
+		for _, i := range g.lines {
+			switch i[0] {
+			case "allow", "disallow":
+				if i[1] == "" {
+					// 空的 Disallow 表示允许访问所有路径
+					continue
+				}
+				res.rules = append(res.rules, robotsRule{allow: i[0] == "allow", length: len(i[1]), pattern: robotsPattern(i[1])})
+			case "crawl-delay":
+				if d, err := strconv.ParseFloat(i[1], 64); err == nil && d > 0 {
+					res.CrawlDelay = time.Duration(d * float64(time.Second))
+				}
+			}
+		}
+	}
+	return res
+}
+
+// 返回 User-Agent 中的产品名，转为小写，如 "OI-Archive-Crawler/1.0" 的产品名为 "oi-archive-crawler"
+func robotsProduct(x string) string {
+	if k := strings.IndexAny(x, "/ "); k >= 0 {
+		x = x[:k]
+	}
+	return strings.ToLower(strings.TrimSpace(x))
+}
+
+// Allowed 判断是否允许访问路径 p（含查询参数），以最长的匹配规则为准，长度相同时 Allow 优先
+func (r *RobotsRules) Allowed(p string) bool {
+	if p == "/robots.txt" {
+		return true
+	}
+	best, allow := -1, true
+	for _, i := range r.rules {
+		if i.length < best || !i.pattern.MatchString(p) {
+			continue
+		}
+		if i.length > best || i.allow {
+			best, allow = i.length, i.allow
+		}
+	}
+	return allow
+}
+
+type robotsEntry struct {
+	mu      sync.Mutex
+	rules   *RobotsRules
+	expires time.Time
+}
+
+var (
+	robotsCache   = make(map[string]*robotsEntry)
+	robotsCacheMu sync.Mutex
+)
+
+// 获取 u 所在网站的 robots.txt 规则，结果按网站缓存
+// 网络错误或服务器出错时返回错误且不缓存，下次请求时重新获取
+func (c *HttpConfig) robots(ctx context.Context, u *url.URL) (*RobotsRules, error) {
+	key := u.Scheme + "://" + strings.ToLower(u.Host)
+	robotsCacheMu.Lock()
+	e, ok := robotsCache[key]
+	if !ok {
+		e = &robotsEntry{}
+		robotsCache[key] = e
+	}
+	robotsCacheMu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rules != nil && time.Now().Before(e.expires) {
+		return e.rules, nil
+	}
+	res, err := DoRequest(ctx, c, "GET", key+"/robots.txt", "", nil)
+	var httpErr *HTTPError
+	switch {
+	case err == nil:
+		b, err := ioutil.ReadAll(io.LimitReader(res.Body, robotsMaxSize))
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		e.rules, e.expires = ParseRobots(b, RobotsUserAgent), time.Now().Add(robotsTTL)
+	case errors.As(err, &httpErr) && httpErr.StatusCode >= 400 && httpErr.StatusCode < 500:
+		// robots.txt 不存在，允许访问所有路径
+		e.rules, e.expires = &RobotsRules{}, time.Now().Add(robotsTTL)
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	default:
+		return nil, fmt.Errorf("get robots.txt: %w", err)
+	}
+	return e.rules, nil
+}
+
+// 检查 robots.txt 是否允许访问 u，返回网站要求的请求间隔
+// 已在 c.RobotsPermission 中记录获得许可时不检查
+func (c *HttpConfig) checkRobots(ctx context.Context, u *url.URL) (time.Duration, error) {
+	if c.RobotsPermission != "" || u.Path == "/robots.txt" || u.Scheme != "http" && u.Scheme != "https" {
+		return 0, nil
+	}
+	r, err := c.robots(ctx, u)
+	if err != nil {
+		return 0, err
+	}
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	if !r.Allowed(p) {
+		return 0, fmt.Errorf("%s: %w", u.String(), ErrDisallowed)
+	}
+	return r.CrawlDelay, nil
+}
@@ -0,0 +1,126 @@
+package public
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testRobots = `# 注释
+User-agent: *
+Disallow: /admin
+Disallow: /*.php$
+Allow: /admin/public
+
+User-agent: OI-Archive-Crawler
+User-agent: Another-Bot
+Disallow: /private/
+Allow: /private/problem
+Disallow: /search?
+Crawl-delay: 0.5
+
+User-agent: BadBot
+Disallow: /
+`
+
+func TestParseRobots(t *testing.T) {
+	r := ParseRobots([]byte(testRobots), "OI-Archive-Crawler/1.0")
+	tests := []struct {
+		path  string
+		allow bool
+	}{
+		{"/", true},
+		{"/admin", true}, // 使用专门为本爬虫设置的组
+		{"/private/", false},
+		{"/private/a", false},
+		{"/private/problem/1", true},
+		{"/search?q=1", false},
+		{"/search", true},
+		{"/robots.txt", true},
+	}
+	for _, i := range tests {
+		if r.Allowed(i.path) != i.allow {
+			t.Errorf("Allowed(%q) = %v, want %v", i.path, !i.allow, i.allow)
+		}
+	}
+	if r.CrawlDelay != 500*time.Millisecond {
+		t.Errorf("CrawlDelay = %v, want 0.5s", r.CrawlDelay)
+	}
+
+	r = ParseRobots([]byte(testRobots), "SomeBot")
+	for path, allow := range map[string]bool{"/admin/x": false, "/admin/public/x": true, "/a.php": false, "/a.php?x=1": true, "/private/": true} {
+		if r.Allowed(path) != allow {
+			t.Errorf("default group: Allowed(%q) = %v, want %v", path, !allow, allow)
+		}
+	}
+
+	// 产品名须完全相同，不区分大小写
+	tests2 := []struct {
+		robots string
+		allow  bool
+	}{
+		{"User-agent: Crawler\nDisallow: /\n", true},
+		{"User-agent: OI-Archive\nDisallow: /\n", true},
+		{"User-agent: oi-archive-crawler\nDisallow: /\n", false},
+		{"User-agent: OI-Archive-Crawler/2.0\nDisallow: /\n", false},
+	}
+	for _, i := range tests2 {
+		if ParseRobots([]byte(i.robots), "OI-Archive-Crawler/1.0").Allowed("/a") != i.allow {
+			t.Errorf("%q: Allowed(/a) = %v, want %v", i.robots, !i.allow, i.allow)
+		}
+	}
+}
+
+func TestRobotsRequest(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\nCrawl-delay: 0.05\n"))
+			return
+		}
+		calls++
+	}))
+	defer server.Close()
+	c := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy}
+	_, err := Download(c, server.URL+"/private/1")
+	if !errors.Is(err, ErrDisallowed) || calls != 0 {
+		t.Errorf("got %v with %d calls, want ErrDisallowed", err, calls)
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := Download(c, server.URL+"/problem/1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("Crawl-delay is not respected: 3 requests took %v", d)
+	}
+
+	c.RobotsPermission = "test"
+	if _, err := Download(c, server.URL+"/private/1"); err != nil {
+		t.Errorf("RobotsPermission should skip robots.txt: %v", err)
+	}
+}
+
+func TestRobotsServerError(t *testing.T) {
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" && fail {
+			w.WriteHeader(503)
+		}
+	}))
+	defer server.Close()
+	c := &HttpConfig{Client: server.Client(), Retry: testRetryPolicy}
+	// 获取 robots.txt 失败时返回该错误，而不是视为禁止访问
+	_, err := Download(c, server.URL+"/problem/1")
+	if !errors.Is(err, ErrServerError) || errors.Is(err, ErrDisallowed) {
+		t.Errorf("got %v, want ErrServerError", err)
+	}
+	// 错误不被缓存
+	fail = false
+	if _, err := Download(c, server.URL+"/problem/1"); err != nil {
+		t.Errorf("robots.txt error is cached: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package public
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Sample 表示一组样例数据
+// Input, Output 为样例内容；InputFile, OutputFile 为写入文件表后相对于题目目录的路径，由 WriteSamples 填写
+type Sample struct {
+	Input      string `json:"-"`
+	Output     string `json:"-"`
+	InputFile  string `json:"input"`
+	OutputFile string `json:"output"`
+}
+
+// 将样例写入 <题目目录>/samples/<n>.in 与 <n>.out，并在 p.Samples 中记录文件路径
+func WriteSamples(p *Problem, nowPath string, fileList *FileList) {
+	for k := range p.Samples {
+		s := &p.Samples[k]
+		s.InputFile = fmt.Sprintf("samples/%d.in", k+1)
+		s.OutputFile = fmt.Sprintf("samples/%d.out", k+1)
+		fileList.Set(nowPath+s.InputFile, []byte(s.Input))
+		fileList.Set(nowPath+s.OutputFile, []byte(s.Output))
+	}
+}
+
+// 将样例渲染为 markdown 代码块，用于拼接到题面中
+func RenderSamples(samples []Sample) string {
+	s := ""
+	for k, i := range samples {
+		s += fmt.Sprintf("### 样例输入 #%d\n\n%s\n### 样例输出 #%d\n\n%s\n", k+1, codeBlock(i.Input), k+1, codeBlock(i.Output))
+	}
+	return s
+}
+
+func codeBlock(x string) string {
+	fence := "```"
+	for strings.Contains(x, fence) {
+		fence += "`"
+	}
+	if !strings.HasSuffix(x, "\n") {
+		x += "\n"
+	}
+	return fence + "\n" + x + fence + "\n"
+}
+
+var (
+	sampleTitleRule = regexp.MustCompile(`(?i)样例|sample|example`)
+	inputTitleRule  = regexp.MustCompile(`(?i)输入|input`)
+	outputTitleRule = regexp.MustCompile(`(?i)输出|output`)
+	explainRule     = regexp.MustCompile(`(?i)解释|说明|explanation|note`)
+
+	mdHeadingRule   = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+(.*?)[ \t#]*$`)
+	htmlHeadingRule = regexp.MustCompile(`(?is)<h[1-6][^>]*>(.*?)</h[1-6]>`)
+	mdBoldRule      = regexp.MustCompile(`(?m)^[ \t]*(?:\*\*|__)([^*\n]+?)(?:\*\*|__)[ \t]*$`)
+	htmlBoldRule    = regexp.MustCompile(`(?is)<p[^>]*>\s*<(?:b|strong)>(.*?)</(?:b|strong)>\s*</p>`)
+
+	fenceOpenRule = regexp.MustCompile("(?m)^[ \t]*(```+|~~~+)[^\n]*$")
+	preRule       = regexp.MustCompile(`(?is)<pre[^>]*>(.*?)</pre>`)
+)
+
+type sampleSection struct {
+	start, end int
+	title      string
+	body       string
+}
+
+// ExtractSamples 从题面中启发式地提取样例
+// 题面按标题（markdown 标题、<h1>~<h6>、单独成行的粗体）切分为若干节，
+// 标题含“样例输入”“Sample Input”等字样的节与其后含“输出”字样的节配对，
+// 节中第一个 <pre> 或代码块作为样例内容，若不存在则取该节的纯文本
+func ExtractSamples(text string) []Sample {
+	var excluded [][]int
+	excluded = append(excluded, fencedBlocks(text)...)
+	excluded = append(excluded, preRule.FindAllStringIndex(text, -1)...)
+	inExcluded := func(pos int) bool {
+		for _, i := range excluded {
+			if pos > i[0] && pos < i[1] {
+				return true
+			}
+		}
+		return false
+	}
+	var heads []sampleSection
+	for _, rule := range []*regexp.Regexp{mdHeadingRule, htmlHeadingRule, mdBoldRule, htmlBoldRule} {
+		for _, m := range rule.FindAllStringSubmatchIndex(text, -1) {
+			if inExcluded(m[0]) {
+				continue
+			}
+			heads = append(heads, sampleSection{start: m[0], end: m[1], title: strings.TrimSpace(htmlText(text[m[2]:m[3]]))})
+		}
+	}
+	sort.Slice(heads, func(i, j int) bool { return heads[i].start < heads[j].start })
+	sections := make([]sampleSection, 0, len(heads))
+	for k, i := range heads {
+		if len(sections) > 0 && i.start < sections[len(sections)-1].end {
+			continue
+		}
+		next := len(text)
+		for _, j := range heads[k+1:] {
+			if j.start >= i.end {
+				next = j.start
+				break
+			}
+		}
+		i.body = text[i.end:next]
+		sections = append(sections, i)
+	}
+
+	res := make([]Sample, 0)
+	inSample := false
+	var input *string
+	for _, i := range sections {
+		isSample := sampleTitleRule.MatchString(i.title)
+		isInput := inputTitleRule.MatchString(i.title)
+		isOutput := outputTitleRule.MatchString(i.title)
+		switch {
+		case isInput && !isOutput && (isSample || inSample):
+			if b, ok := firstBlock(i.body); ok {
+				input = &b
+			}
+		case isOutput && !isInput && (isSample || inSample):
+			if b, ok := firstBlock(i.body); ok && input != nil {
+				res = append(res, Sample{Input: *input, Output: b})
+			}
+			input = nil
+		case isSample:
+			inSample = true
+			input = nil
+			blocks := codeBlocks(i.body)
+			for k := 0; k+1 < len(blocks); k += 2 {
+				res = append(res, Sample{Input: blocks[k], Output: blocks[k+1]})
+			}
+		case explainRule.MatchString(i.title):
+		default:
+			inSample = false
+			input = nil
+		}
+	}
+	return res
+}
+
+// 返回一节中所有 <pre> 与代码块的内容
+func codeBlocks(body string) []string {
+	type block struct {
+		pos  int
+		text string
+	}
+	var blocks []block
+	for _, m := range fencedBlocks(body) {
+		blocks = append(blocks, block{m[0], normalizeSample(body[m[2]:m[3]])})
+	}
+	for _, m := range preRule.FindAllStringSubmatchIndex(body, -1) {
+		blocks = append(blocks, block{m[0], normalizeSample(htmlText(body[m[2]:m[3]]))})
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].pos < blocks[j].pos })
+	res := make([]string, 0, len(blocks))
+	for _, i := range blocks {
+		res = append(res, i.text)
+	}
+	return res
+}
+
+// 返回文本中所有围栏代码块的位置，每项为 {开始, 结束, 内容开始, 内容结束}
+// 结束围栏须与开始围栏使用相同的字符且不短于开始围栏，没有结束围栏的不视为代码块
+func fencedBlocks(text string) [][]int {
+	res := make([][]int, 0)
+	pos := 0
+	for {
+		m := fenceOpenRule.FindStringSubmatchIndex(text[pos:])
+		if m == nil {
+			return res
+		}
+		start, fence := pos+m[0], text[pos+m[2]:pos+m[3]]
+		bodyStart := pos + m[1] + 1
+		pos = bodyStart
+		for i := bodyStart; i < len(text); {
+			j := strings.IndexByte(text[i:], '\n')
+			if j < 0 {
+				j = len(text)
+			} else {
+				j += i
+			}
+			line := strings.TrimLeft(text[i:j], " \t")
+			if strings.HasPrefix(line, fence) && strings.Trim(line, fence[:1]+" \t") == "" {
+				res = append(res, []int{start, j, bodyStart, i})
+				pos = j
+				break
+			}
+			i = j + 1
+		}
+		if pos >= len(text) {
+			return res
+		}
+	}
+}
+
+func firstBlock(body string) (string, bool) {
+	if b := codeBlocks(body); len(b) > 0 {
+		return b[0], true
+	}
+	t := normalizeSample(htmlText(body))
+	if strings.TrimSpace(t) == "" {
+		return "", false
+	}
+	return t, true
+}
+
+// 统一样例的空白字符：去掉首尾空行，以换行符结尾
+func normalizeSample(x string) string {
+	x = strings.ReplaceAll(x, "\r\n", "\n")
+	x = strings.ReplaceAll(x, "\u00a0", " ")
+	x = strings.TrimLeft(x, "\n")
+	x = strings.TrimRight(x, " \t\n")
+	if x == "" {
+		return ""
+	}
+	return x + "\n"
+}
+
+// 提取 html 片段中的纯文本，<br> 与块级元素转换为换行
+func htmlText(x string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(x), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return x
+	}
+	s := ""
+	for _, i := range nodes {
+		s += nodeText(i)
+	}
+	return s
+}
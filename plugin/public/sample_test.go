@@ -0,0 +1,48 @@
+package public
+
+import (
+	"reflect"
+	"testing"
+)
+
+var extractSamplesTests = []struct {
+	name string
+	in   string
+	out  []Sample
+}{
+	{"numbered markdown headings", "### 样例输入 #1\n\n```\n1 2\n```\n\n### 样例输出 #1\n\n```\n3\n```\n\n### 样例输入 #2\n\n```\n4 5\n```\n\n### 样例输出 #2\n\n```\n9\n```\n",
+		[]Sample{{Input: "1 2\n", Output: "3\n"}, {Input: "4 5\n", Output: "9\n"}}},
+	{"html headings and pre", "<h3>Sample Input 1</h3><pre>1 2\r\n</pre><h3>Sample Output 1</h3><pre>3</pre>",
+		[]Sample{{Input: "1 2\n", Output: "3\n"}}},
+	{"bold titles without pre", "<p><b>输入样例</b></p><p>1&nbsp;2</p><p><strong>输出样例</strong></p><p>3</p>",
+		[]Sample{{Input: "1 2\n", Output: "3\n"}}},
+	{"sample section with pairs", "## 样例\n\n<pre>1</pre><pre>2</pre><pre>3</pre>\n\n### 输入\n\n```\n4\n```\n\n### 解释\n\n略\n\n### 输出\n\n```\n5\n```\n",
+		[]Sample{{Input: "1\n", Output: "2\n"}, {Input: "4\n", Output: "5\n"}}},
+	{"heading inside code block", "## 样例输入\n\n```\n# 1\n```\n\n## 样例输出\n\n```\n2\n```\n",
+		[]Sample{{Input: "# 1\n", Output: "2\n"}}},
+	{"input without output", "## 样例输入\n\n```\n1\n```\n\n## 提示\n\n无\n\n## 样例输出\n\n```\n2\n```\n", []Sample{}},
+	{"output before input", "## 样例输出\n\n```\n2\n```\n\n## 样例输入\n\n```\n1\n```\n", []Sample{}},
+	{"not a sample", "## Input\n\n```\n1\n```\n\n## Output\n\n```\n2\n```\n", []Sample{}},
+}
+
+func TestExtractSamples(t *testing.T) {
+	for _, i := range extractSamplesTests {
+		if out := ExtractSamples(i.in); !reflect.DeepEqual(out, i.out) {
+			t.Errorf("%s: ExtractSamples(%q) = %q, want %q", i.name, i.in, out, i.out)
+		}
+	}
+}
+
+func TestRenderSamples(t *testing.T) {
+	samples := []Sample{{Input: "1 2", Output: "3\n"}, {Input: "```\n", Output: "4\n"}}
+	want := "### 样例输入 #1\n\n```\n1 2\n```\n\n### 样例输出 #1\n\n```\n3\n```\n\n" +
+		"### 样例输入 #2\n\n````\n```\n````\n\n### 样例输出 #2\n\n```\n4\n```\n\n"
+	if got := RenderSamples(samples); got != want {
+		t.Errorf("RenderSamples = %q, want %q", got, want)
+	}
+	// 渲染的样例可以被重新提取
+	samples[0].Input = "1 2\n"
+	if got := ExtractSamples(RenderSamples(samples)); !reflect.DeepEqual(got, samples) {
+		t.Errorf("ExtractSamples(RenderSamples) = %q, want %q", got, samples)
+	}
+}
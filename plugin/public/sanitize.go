@@ -0,0 +1,440 @@
+package public
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Sanitizer 用于清理题面中的 html，只保留白名单中的标签与属性
+type Sanitizer struct {
+	// 允许保留的标签
+	AllowedTags map[string]bool
+	// 允许保留的属性，key 为标签名，"*" 对应所有标签都允许的属性
+	AllowedAttrs map[string]map[string]bool
+	// 连同内容一起删除的标签
+	DropContentTags map[string]bool
+}
+
+func toSet(x ...string) map[string]bool {
+	res := make(map[string]bool)
+	for _, i := range x {
+		res[i] = true
+	}
+	return res
+}
+
+// NewSanitizer 返回使用默认白名单的 Sanitizer
+// 默认保留常见排版标签、表格、图片与 MathML，删除脚本、样式、<iframe> 等嵌入内容及所有事件属性
+func NewSanitizer() *Sanitizer {
+	return &Sanitizer{
+		AllowedTags: toSet(
+			"a", "abbr", "b", "blockquote", "br", "caption", "center", "cite", "code", "col", "colgroup",
+			"dd", "del", "details", "dfn", "div", "dl", "dt", "em", "figcaption", "figure", "font",
+			"h1", "h2", "h3", "h4", "h5", "h6", "hr", "i", "img", "ins", "kbd", "li", "mark", "ol", "p",
+			"picture", "pre", "q", "s", "samp", "small", "source", "span", "strike", "strong", "sub",
+			"summary", "sup", "table", "tbody", "td", "tfoot", "th", "thead", "tr", "tt", "u", "ul", "var",
+			"math", "semantics", "annotation", "mrow", "mi", "mo", "mn", "ms", "mtext", "mspace", "msub",
+			"msup", "msubsup", "mfrac", "msqrt", "mroot", "munder", "mover", "munderover", "mtable", "mtr",
+			"mtd", "mstyle", "mpadded", "mphantom", "menclose", "mfenced",
+		),
+		AllowedAttrs: map[string]map[string]bool{
+			"*":      toSet("class", "id", "title", "style", "align", "valign", "width", "height", "lang", "dir", "border", "color", "size", "face"),
+			"a":      toSet("href", "name"),
+			"img":    toSet("src", "alt", "srcset"),
+			"source": toSet("src", "srcset", "type", "media"),
+			"table":  toSet("cellpadding", "cellspacing"),
+			"td":     toSet("colspan", "rowspan"),
+			"th":     toSet("colspan", "rowspan"),
+			"ol":     toSet("start", "type"),
+			"math":   toSet("display", "xmlns"),
+			"script": toSet("type"),
+			// MathML 中的属性
+			"annotation": toSet("encoding"),
+			"mo":         toSet("stretchy", "fence", "separator", "lspace", "rspace"),
+			"mstyle":     toSet("displaystyle", "scriptlevel", "mathvariant"),
+			"mi":         toSet("mathvariant"),
+			"mtable":     toSet("columnalign", "rowspacing", "columnspacing"),
+			"mspace":     toSet("depth"),
+			"menclose":   toSet("notation"),
+		},
+		DropContentTags: toSet(
+			"script", "style", "iframe", "frame", "frameset", "object", "embed", "applet", "noscript",
+			"template", "svg", "link", "meta", "base", "head", "title", "textarea", "select",
+		),
+	}
+}
+
+// WriteFiles 清理题面时使用的 Sanitizer
+var DefaultSanitizer = NewSanitizer()
+
+var (
+	urlAttrs        = toSet("href", "src", "srcset")
+	unsafeStyleRule = regexp.MustCompile(`(?i)expression\s*\(|javascript:|vbscript:|url\s*\(|@import|behavior\s*:`)
+	urlSchemeRule   = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
+	urlIgnoredRule  = regexp.MustCompile(`[\x00-\x20]+`)
+	tagNameRule     = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	unclosedTagRule = regexp.MustCompile(`^</?([^\s/>]*)`)
+	voidTags        = toSet("area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr")
+	// 内容不按 html 解析的元素，其内容无论 DropContentTags 如何设置都会被删除
+	rawTextTags = toSet("script", "style", "iframe", "noscript", "noembed", "noframes", "plaintext", "xmp", "textarea", "title")
+	codeTags    = toSet("pre", "code")
+	// 公式中可能被当作标签开始的 "<"
+	mathTagRule   = regexp.MustCompile(`<[A-Za-z]`)
+	blankLineRule = regexp.MustCompile(`\n[ \t]*\n`)
+	preOpenRule   = regexp.MustCompile(`(?i)<pre[\s>]`)
+)
+
+// 判断是否为数学公式脚本，如 MathJax 使用的 <script type="math/tex">，返回其 type
+func mathScriptType(t html.Token) (string, bool) {
+	if t.Data != "script" {
+		return "", false
+	}
+	for _, a := range t.Attr {
+		if a.Key == "type" && strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "math/") {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func safeUrl(tag, x string) bool {
+	x = strings.ToLower(urlIgnoredRule.ReplaceAllString(x, ""))
+	m := urlSchemeRule.FindStringSubmatch(x)
+	if m == nil {
+		return true
+	}
+	switch m[1] {
+	case "http", "https", "ftp", "mailto":
+		return true
+	case "data":
+		return (tag == "img" || tag == "source") && strings.HasPrefix(x, "data:image/") && !strings.HasPrefix(x, "data:image/svg")
+	}
+	return false
+}
+
+// Sanitize 清理文本中的 html，返回清理后的文本及被移除内容的说明
+// 文本可以是混有 html 的 markdown；markdown 的代码与公式不按 html 解析：代码原样保留，公式中可能构成标签的 "<" 后插入空格
+// <pre>、<code> 中不允许的标签当作代码的内容转义，如 #include <map>
+// 不是合法标签的 "<"（如公式中的 $a<b$）在 markdown 中原样保留，在 html 中转义为 &lt;
+func (s *Sanitizer) Sanitize(text string, descriptionType string) (string, []string) {
+	removed := make([]string, 0)
+	seen := make(map[string]bool)
+	remove := func(x string) {
+		if !seen[x] {
+			seen[x] = true
+			removed = append(removed, x)
+		}
+	}
+	// 删除标签后前后的文本可能拼成新的标签，如 <scr<script>ipt>，因此重复清理直到结果不再变化
+	for k := 0; k < 10; k++ {
+		var b strings.Builder
+		if descriptionType == "markdown" {
+			s.sanitizeMarkdown(&b, text, remove)
+		} else {
+			s.sanitize(&b, text, true, remove)
+		}
+		if b.String() == text {
+			return text, removed
+		}
+		text = b.String()
+	}
+	remove("无法清理的 html")
+	return strings.ReplaceAll(text, "<", "&lt;"), removed
+}
+
+// markdown 中不按 html 清理的公式或代码
+type protectedSpan struct {
+	start, end int
+	math       bool
+}
+
+// 找出 markdown 中的公式、围栏代码块与行内代码，按位置排序
+// 代码由渲染器转义，但位于 html 块中的代码会被当作 html 输出，不予保留
+func markdownProtected(text string) []protectedSpan {
+	res := make([]protectedSpan, 0)
+	for _, i := range FindMath(text) {
+		switch i.Form {
+		case MathDollar, MathDoubleDollar, MathParen, MathBracket:
+			res = append(res, protectedSpan{i.Start, i.End, true})
+		}
+	}
+	blocks := htmlBlocks(text)
+	code := func(start, end int) {
+		for _, i := range blocks {
+			if start >= i[0] && start < i[1] {
+				return
+			}
+		}
+		res = append(res, protectedSpan{start, end, false})
+	}
+	fences := fencedBlocks(text)
+	for i, f := 0, 0; i < len(text); {
+		if f < len(fences) && i >= fences[f][0] {
+			if i == fences[f][0] {
+				code(fences[f][0], fences[f][1])
+				i = fences[f][1]
+			}
+			f++
+			continue
+		}
+		switch text[i] {
+		case '\\':
+			i += 2
+		case '`':
+			end, n := inlineCodeEnd(text, i)
+			if end < 0 {
+				i += n
+				continue
+			}
+			code(i, end)
+			i = end
+		default:
+			i++
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].start < res[j].start })
+	return res
+}
+
+// 返回 markdown 中 html 块的大致位置：以 "<" 开头的段落，以及 <pre> 至 </pre> 或文本末尾
+func htmlBlocks(text string) [][]int {
+	res := make([][]int, 0)
+	start := 0
+	for _, i := range append(blankLineRule.FindAllStringIndex(text, -1), []int{len(text), len(text)}) {
+		if strings.HasPrefix(strings.TrimLeft(text[start:i[0]], " \t\n"), "<") {
+			res = append(res, []int{start, i[0]})
+		}
+		start = i[1]
+	}
+	lower := strings.ToLower(text)
+	for _, i := range preOpenRule.FindAllStringIndex(text, -1) {
+		end := len(text)
+		if j := strings.Index(lower[i[1]:], "</pre"); j >= 0 {
+			end = i[1] + j
+		}
+		res = append(res, []int{i[0], end})
+	}
+	return res
+}
+
+// 清理 markdown：公式与代码不按 html 解析，以免其中的 "<" 与其后的文本被当作标签
+// 代码原样保留；公式中的 "<" 若与其后清理过的文本构成危险的标签，在其后插入空格，不影响公式的渲染，未被当作公式渲染时也不会成为标签
+func (s *Sanitizer) sanitizeMarkdown(b *strings.Builder, text string, remove func(string)) {
+	var out strings.Builder
+	math := make([][]int, 0)
+	last := 0
+	for _, i := range markdownProtected(text) {
+		if i.start < last {
+			continue
+		}
+		s.sanitize(&out, text[last:i.start], false, remove)
+		if i.math {
+			math = append(math, []int{out.Len(), out.Len() + i.end - i.start})
+		}
+		out.WriteString(text[i.start:i.end])
+		last = i.end
+	}
+	s.sanitize(&out, text[last:], false, remove)
+	res, pos := out.String(), 0
+	for _, i := range math {
+		for _, j := range mathTagRule.FindAllStringIndex(res[i[0]:i[1]], -1) {
+			if k := i[0] + j[0]; s.dangerousTag(res[k:]) {
+				b.WriteString(res[pos : k+1])
+				b.WriteString(" ")
+				pos = k + 1
+				remove("公式中的标签")
+			}
+		}
+	}
+	b.WriteString(res[pos:])
+}
+
+// 判断 text 开头的标签被当作 html 时是否危险：含事件属性、不安全的地址或样式，或为会连同内容删除的元素
+func (s *Sanitizer) dangerousTag(text string) bool {
+	z := html.NewTokenizer(strings.NewReader(text))
+	if tt := z.Next(); tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+		return false
+	}
+	t := z.Token()
+	if s.DropContentTags[t.Data] || rawTextTags[t.Data] {
+		return true
+	}
+	for _, a := range t.Attr {
+		if strings.HasPrefix(a.Key, "on") || !safeUrl(t.Data, a.Val) || a.Key == "style" && unsafeStyleRule.MatchString(a.Val) {
+			return true
+		}
+	}
+	return false
+}
+
+// 把不是标签的 raw 当作文本写入 b：只转义开头的 "<"，其后的内容继续清理
+func (s *Sanitizer) writeText(b *strings.Builder, raw string, isHtml bool, remove func(string)) {
+	if isHtml {
+		b.WriteString("&lt;")
+	} else {
+		b.WriteString("<")
+	}
+	s.sanitize(b, raw[1:], isHtml, remove)
+}
+
+func (s *Sanitizer) sanitize(b *strings.Builder, text string, isHtml bool, remove func(string)) {
+	z := html.NewTokenizer(strings.NewReader(text))
+	dropDepth := 0
+	codeDepth := 0
+	mathScript := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// 文本末尾未结束的标签：合法的标签同浏览器一样丢弃，其余当作文本，如结尾的 $a<b$
+			if raw := string(z.Raw()); dropDepth == 0 && strings.HasPrefix(raw, "<") {
+				if m := unclosedTagRule.FindStringSubmatch(raw); codeDepth == 0 && m != nil && tagNameRule.MatchString(strings.ToLower(m[1])) {
+					remove("未结束的标签")
+				} else {
+					s.writeText(b, raw, isHtml, remove)
+				}
+			}
+			break
+		}
+		raw := string(z.Raw())
+		t := z.Token()
+		switch tt {
+		case html.TextToken:
+			switch {
+			case dropDepth > 0:
+			case mathScript:
+				// 公式脚本的内容不能提前结束 <script>
+				b.WriteString(strings.ReplaceAll(raw, "</", `<\/`))
+			default:
+				b.WriteString(raw)
+			}
+		case html.CommentToken, html.DoctypeToken:
+			if dropDepth == 0 {
+				remove("html 注释")
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			drop := s.DropContentTags[t.Data] || rawTextTags[t.Data]
+			if dropDepth > 0 {
+				if drop && tt == html.StartTagToken && !voidTags[t.Data] {
+					dropDepth++
+				}
+				continue
+			}
+			if !tagNameRule.MatchString(t.Data) {
+				// 不是合法的标签，如 $a<b$ 或 markdown 中的 <https://example.com>：只把 "<" 当作文本，其后的内容继续清理
+				s.writeText(b, raw, isHtml, remove)
+				continue
+			}
+			if codeDepth > 0 && !drop && !s.AllowedTags[t.Data] {
+				// 代码中不允许的标签多为代码的内容，如 #include <map>，转义为文本
+				s.writeText(b, raw, true, remove)
+				continue
+			}
+			if typ, ok := mathScriptType(t); ok {
+				if tt == html.StartTagToken {
+					mathScript = true
+					b.WriteString((&html.Token{Type: html.StartTagToken, Data: "script", Attr: []html.Attribute{{Key: "type", Val: typ}}}).String())
+				}
+				continue
+			}
+			if drop {
+				remove(describeTag(t))
+				if tt == html.StartTagToken && !voidTags[t.Data] {
+					dropDepth++
+				}
+				continue
+			}
+			if !s.AllowedTags[t.Data] && atom.Lookup([]byte(t.Data)) != 0 {
+				remove("<" + t.Data + ">")
+				continue
+			}
+			// 允许的标签与未知的标签都只保留白名单中的属性
+			attrs := make([]html.Attribute, 0, len(t.Attr))
+			for _, a := range t.Attr {
+				if !s.AllowedAttrs["*"][a.Key] && !s.AllowedAttrs[t.Data][a.Key] {
+					remove(fmt.Sprintf("<%s %s>", t.Data, a.Key))
+					continue
+				}
+				if urlAttrs[a.Key] && !safeUrl(t.Data, a.Val) || a.Key == "style" && unsafeStyleRule.MatchString(a.Val) {
+					remove(fmt.Sprintf(`<%s %s="%s">`, t.Data, a.Key, a.Val))
+					continue
+				}
+				attrs = append(attrs, a)
+			}
+			if codeTags[t.Data] && tt == html.StartTagToken {
+				codeDepth++
+			}
+			if len(attrs) == len(t.Attr) {
+				b.WriteString(raw)
+				continue
+			}
+			t.Attr = attrs
+			b.WriteString(t.String())
+		case html.EndTagToken:
+			if dropDepth > 0 {
+				if s.DropContentTags[t.Data] || rawTextTags[t.Data] {
+					dropDepth--
+				}
+				continue
+			}
+			if t.Data == "script" && mathScript {
+				mathScript = false
+				b.WriteString("</script>")
+				continue
+			}
+			if !tagNameRule.MatchString(t.Data) {
+				s.writeText(b, raw, isHtml, remove)
+				continue
+			}
+			if codeDepth > 0 && !s.AllowedTags[t.Data] && !s.DropContentTags[t.Data] && !rawTextTags[t.Data] {
+				s.writeText(b, raw, true, remove)
+				continue
+			}
+			if codeTags[t.Data] && codeDepth > 0 {
+				codeDepth--
+			}
+			if s.AllowedTags[t.Data] || atom.Lookup([]byte(t.Data)) == 0 {
+				b.WriteString("</" + t.Data + ">")
+			}
+		}
+	}
+}
+
+// 描述被删除的标签，带上地址便于排查
+func describeTag(t html.Token) string {
+	for _, a := range t.Attr {
+		if a.Key == "src" || a.Key == "href" || a.Key == "data" {
+			return fmt.Sprintf("<%s %s=%s>", t.Data, a.Key, a.Val)
+		}
+	}
+	return "<" + t.Data + ">"
+}
+
+// SanitizeProblem 清理题目 p 的题面，返回被移除内容的说明
+func (s *Sanitizer) SanitizeProblem(p *Problem) []string {
+	removed := make([]string, 0)
+	seen := make(map[string]bool)
+	sanitize := func(x string, descriptionType string) string {
+		t, r := s.Sanitize(x, descriptionType)
+		for _, i := range r {
+			if !seen[i] {
+				seen[i] = true
+				removed = append(removed, i)
+			}
+		}
+		return t
+	}
+	// 转换为 markdown 前的原始题面按 html 清理
+	original := p.OriginalDescription
+	p.OriginalDescription = ""
+	_ = p.RewriteText(func(x string) (string, error) {
+		return sanitize(x, p.DescriptionType), nil
+	})
+	if original != "" {
+		p.OriginalDescription = sanitize(original, "html")
+	}
+	return removed
+}
@@ -0,0 +1,92 @@
+package public
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// 结果中仍会被当作 html 的危险属性
+var sanitizeDangerRule = regexp.MustCompile(`(?i)<[a-z][^<>]*\s(on[a-z]+\s*=|[a-z]+\s*=\s*["']?\s*javascript:)`)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		typ  string
+		// 非空时要求结果与之相同
+		want string
+		// 结果中不能出现的内容
+		bad []string
+		// 结果中的标签位于 markdown 代码中，由渲染器转义
+		code bool
+	}{
+		{name: "math img", in: `$<img src=x onerror=alert(1)>$`, typ: "markdown", want: `$< img src=x onerror=alert(1)>$`},
+		{name: "math tag closed outside", in: `$x<svg/onload=alert(1)$>`, typ: "markdown", want: `$x< svg/onload=alert(1)$>`},
+		{name: "math img html", in: `$<img src=x onerror=alert(1)>$`, typ: "html", want: `$<img src="x">$`},
+		{name: "script between math", in: `price $5 and <script>alert(1)</script> $10`, typ: "markdown", want: `price $5 and  $10`},
+		{name: "iframe in math", in: `\(<iframe src=//evil></iframe>\)`, typ: "html", want: `\(\)`},
+		{name: "inline code", in: "`<img src=x onerror=alert(1)>`", typ: "markdown", want: "`<img src=x onerror=alert(1)>`", code: true},
+		{name: "fenced code", in: "```\n<script>alert(1)</script>\n```", typ: "markdown", want: "```\n<script>alert(1)</script>\n```", code: true},
+		{name: "escaped backquote", in: "\\`<img src=x onerror=alert(1)>\\`", typ: "markdown", want: "\\`<img src=\"x\">\\`"},
+		{name: "code in html block", in: "<div>`<img src=x onerror=alert(1)>`</div>", typ: "markdown", want: "<div>`<img src=\"x\">`</div>"},
+		{name: "code in pre", in: "<pre>\n\n`<img src=x onerror=alert(1)>`\n</pre>", typ: "markdown", want: "<pre>\n\n`<img src=\"x\">`\n</pre>"},
+		{name: "tags in pre", in: "<pre>#include <map>\ntemplate <typename T></pre>", typ: "html", want: "<pre>#include &lt;map>\ntemplate &lt;typename T></pre>"},
+		{name: "script in pre", in: "<pre><script>alert(1)</script></pre>", typ: "html", want: "<pre></pre>"},
+		{name: "unknown tag", in: `<foo onmouseover=alert(1)>x</foo>`, typ: "html", want: `<foo>x</foo>`},
+		{name: "custom element", in: `<x-a onclick="alert(1)" title="t">x</x-a>`, typ: "html", want: `<x-a title="t">x</x-a>`},
+		{name: "event handler", in: `<p style="color:red" onclick="alert(1)">hi</p>`, typ: "html", want: `<p style="color:red">hi</p>`},
+		{name: "xmp", in: `<xmp><img src=x onerror=alert(1)></xmp>ok`, typ: "html", want: `ok`},
+		{name: "noembed", in: `<noembed><img src=x onerror=alert(1)></noembed>ok`, typ: "markdown", want: `ok`},
+		{name: "noframes", in: `<noframes><img src=x onerror=alert(1)></noframes>ok`, typ: "html", want: `ok`},
+		{name: "plaintext", in: `ok<plaintext><img src=x onerror=alert(1)>`, typ: "html", want: `ok`},
+		{name: "style", in: `<style>body{}</style>ok`, typ: "html", want: `ok`},
+		{name: "math script", in: `<script type="math/tex" onload="alert(1)">a</b</script>`, typ: "html", want: `<script type="math/tex">a<\/b</script>`},
+		{name: "javascript url", in: `<a href="javascript:alert(1)">x</a>`, typ: "html", want: `<a>x</a>`},
+		{name: "obfuscated javascript url", in: `<a href=" jav&#x09;ascript:alert(1)">x</a>`, typ: "html", want: `<a>x</a>`},
+		{name: "data url", in: `<a href="data:text/html,<script>alert(1)</script>">x</a>`, typ: "html", want: `<a>x</a>`},
+		{name: "svg data url", in: `<img src="data:image/svg+xml,<svg onload=alert(1)>">`, typ: "html", want: `<img>`},
+		{name: "png data url", in: `<img src="data:image/png;base64,AAAA">`, typ: "html", want: `<img src="data:image/png;base64,AAAA">`},
+		{name: "unsafe style", in: `<span style="background:url(javascript:alert(1))">x</span>`, typ: "html", want: `<span>x</span>`},
+		{name: "nested tag name", in: `<scr<script>ipt>alert(1)</script>x`, typ: "html", want: `&lt;script>alert(1)x`},
+		{name: "nested tag name markdown", in: `<scr<script>ipt>alert(1)</script>x`, typ: "markdown", bad: []string{"<script"}},
+		{name: "double open", in: `<<img src=x onerror=alert(1)>`, typ: "markdown", want: `<<img src="x">`},
+		{name: "unclosed attribute", in: `<img src=x onerror=alert(1)//`, typ: "html", bad: []string{"onerror"}},
+		{name: "tag inside invalid tag", in: `$a<b$ text <img src=x onerror=alert(1)>`, typ: "markdown", want: `$a<b$ text <img src="x">`},
+		{name: "end tag with attribute", in: `<b>x</b onclick=alert(1)>`, typ: "html", want: `<b>x</b>`},
+		{name: "comment", in: `a<!-- <img src=x onerror=alert(1)> -->b`, typ: "html", want: `ab`},
+		{name: "math kept", in: `$a<b$ and $c>d$, $x < y$`, typ: "markdown", want: `$a<b$ and $c>d$, $x < y$`},
+		{name: "math escaped in html", in: `$a<b$`, typ: "html", want: `$a&lt;b$`},
+		{name: "autolink", in: `<https://example.com>`, typ: "markdown", want: `<https://example.com>`},
+		{name: "math before heading", in: "对于 $1 \\le n<m \\le 10^5$ 的数据\n\n# 提示\n\n无", typ: "markdown", want: "对于 $1 \\le n<m \\le 10^5$ 的数据\n\n# 提示\n\n无"},
+		{name: "math pair", in: "对于 $n<m \\le 10^5$，输出满足 $a_i>b$ 的个数。", typ: "markdown", want: "对于 $n<m \\le 10^5$，输出满足 $a_i>b$ 的个数。"},
+		{name: "cpp code", in: "```cpp\n#include <map>\ntemplate <typename T>\nT f(T x);\n```", typ: "markdown", want: "```cpp\n#include <map>\ntemplate <typename T>\nT f(T x);\n```"},
+		{name: "tag in inline code", in: "输入 `<select>` 然后", typ: "markdown", want: "输入 `<select>` 然后"},
+	}
+	for _, i := range tests {
+		got, _ := DefaultSanitizer.Sanitize(i.in, i.typ)
+		if i.want != "" && got != i.want {
+			t.Errorf("%s: Sanitize(%q) = %q, want %q", i.name, i.in, got, i.want)
+		}
+		for _, j := range i.bad {
+			if strings.Contains(strings.ToLower(got), j) {
+				t.Errorf("%s: Sanitize(%q) = %q, contains %q", i.name, i.in, got, j)
+			}
+		}
+		if !i.code && sanitizeDangerRule.MatchString(got) {
+			t.Errorf("%s: Sanitize(%q) = %q, contains dangerous attributes", i.name, i.in, got)
+		}
+	}
+}
+
+func TestSanitizeProblem(t *testing.T) {
+	p := &Problem{
+		DescriptionType:     "markdown",
+		Description:         "$a<b$ <img src=x onerror=alert(1)>",
+		OriginalDescription: "<p>$a<b$</p><script>alert(1)</script>",
+	}
+	removed := DefaultSanitizer.SanitizeProblem(p)
+	if p.Description != `$a<b$ <img src="x">` || p.OriginalDescription != "<p>$a&lt;b$</p>" || len(removed) != 2 {
+		t.Errorf("SanitizeProblem = %q, %q, removed %v", p.Description, p.OriginalDescription, removed)
+	}
+}
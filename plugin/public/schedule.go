@@ -0,0 +1,123 @@
+package public
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// 返回当前时间，测试时可替换为固定的时间
+var Now = time.Now
+
+// OldProblem 为已归档的题目信息
+type OldProblem struct {
+	Title string
+	// 同 ProblemListItem 中的同名字段
+	Fetched      int64
+	Changed      int64
+	Hash         string
+	Updated      int64
+	UpstreamHash string
+}
+
+// OldProblemList 为已归档的题目列表，key 为题号，由 InitPList 从主服务读取
+type OldProblemList map[string]OldProblem
+
+// 由本次的题目列表生成 OldProblemList，用于组件连续运行时的下一次更新
+func NewOldProblemList(list ProblemList) OldProblemList {
+	res := make(OldProblemList)
+	for _, i := range list {
+		res[i.Pid] = OldProblem{Title: i.Title, Fetched: i.Fetched, Changed: i.Changed, Hash: i.Hash, Updated: i.Updated, UpstreamHash: i.UpstreamHash}
+	}
+	return res
+}
+
+// CopyTo 将已归档的爬取记录复制到新的题目列表中，使未更新的题目保留原有记录
+// 组件在题目列表中填写的 Updated 不会被覆盖
+func (l OldProblemList) CopyTo(newPList ProblemList) {
+	for k := range newPList {
+		i := &newPList[k]
+		if old, ok := l[i.Pid]; ok {
+			i.Fetched, i.Changed, i.Hash, i.UpstreamHash = old.Fetched, old.Changed, old.Hash, old.UpstreamHash
+			if i.Updated == 0 {
+				i.Updated = old.Updated
+			}
+		}
+	}
+}
+
+// 记录题目 i 已于 now 爬取成功，i.Data 非空时更新 Hash，新增、标题变化及内容哈希变化的题目同时更新 Changed
+func (l OldProblemList) markFetched(i *ProblemListItem, now time.Time) {
+	i.Fetched = now.Unix()
+	if i.Data == nil {
+		return
+	}
+	i.Hash = ProblemHash(i.Data)
+	// 没有记录哈希的题目无法判断内容是否变化
+	if old, ok := l[i.Pid]; !ok || old.Title != i.Title || old.Hash != "" && old.Hash != i.Hash {
+		i.Changed = now.Unix()
+	}
+}
+
+// 选定本次要更新的题目，规则同 DownloadProblems，使用 DefaultDownloadConfig 中的设置
+// 不使用 DownloadProblems 的组件需自行调用 CopyTo 并更新 Fetched、Changed 与 Hash
+func ChooseUpdateProblem(newPList ProblemList, oldPList OldProblemList, limit int) map[string]bool {
+	return DefaultDownloadConfig.choose(newPList, oldPList, limit, Now())
+}
+
+// 新增、标题变化的题目全部更新，其余题目按以下顺序选取，直至达到 limit 道：
+// 题库提供的更新时间 Updated 晚于上次爬取或与上次记录不同的题目；
+// 从未记录爬取时间及超过 MaxInterval 未爬取的题目，按未爬取的时间从长到短；
+// 其余题目按未爬取的时间从长到短，易变的题目按 VolatileFactor 倍计算；时间相同时按题目列表中的顺序
+func (dc *DownloadConfig) choose(newPList ProblemList, oldPList OldProblemList, limit int, now time.Time) map[string]bool {
+	if limit > len(newPList) {
+		limit = len(newPList)
+	}
+	res := make(map[string]bool)
+	if limit == 0 {
+		return res
+	}
+	// level 越小越优先
+	type candidate struct {
+		pid   string
+		level int
+		score float64
+	}
+	rest := make([]candidate, 0)
+	for _, i := range newPList {
+		old, ok := oldPList[i.Pid]
+		if !ok || old.Title != i.Title {
+			res[i.Pid] = true
+			continue
+		}
+		if i.Updated != 0 && (i.Updated > old.Fetched || old.Updated != 0 && i.Updated != old.Updated) {
+			rest = append(rest, candidate{i.Pid, 0, float64(i.Updated)})
+			continue
+		}
+		if old.Fetched == 0 {
+			rest = append(rest, candidate{i.Pid, 1, math.Inf(1)})
+			continue
+		}
+		age := now.Sub(time.Unix(old.Fetched, 0))
+		c := candidate{pid: i.Pid, level: 2, score: age.Seconds()}
+		if dc.MaxInterval > 0 && age > dc.MaxInterval {
+			c.level = 1
+		} else if dc.VolatileFactor > 0 && old.Changed != 0 && now.Sub(time.Unix(old.Changed, 0)) <= dc.VolatileWindow {
+			c.score *= dc.VolatileFactor
+		}
+		rest = append(rest, c)
+	}
+	sort.SliceStable(rest, func(a, b int) bool {
+		if rest[a].level != rest[b].level {
+			return rest[a].level < rest[b].level
+		}
+		return rest[a].score > rest[b].score
+	})
+	for _, i := range rest {
+		if len(res) >= limit {
+			break
+		}
+		res[i.pid] = true
+	}
+	return res
+}
@@ -0,0 +1,124 @@
+package public
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChooseUpdateProblem(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	day := int64(24 * 60 * 60)
+	at := func(days int64) int64 { return now.Unix() - days*day }
+	dc := &DownloadConfig{MaxInterval: 60 * 24 * time.Hour, VolatileWindow: 30 * 24 * time.Hour, VolatileFactor: 4}
+	list := ProblemList{{Pid: "new", Title: "a"}, {Pid: "renamed", Title: "b"}, {Pid: "fresh", Title: "c"}, {Pid: "old", Title: "d"},
+		{Pid: "volatile", Title: "e"}, {Pid: "overdue", Title: "f"}, {Pid: "unknown", Title: "g"}, {Pid: "updated", Title: "h", Updated: at(2)}}
+	old := OldProblemList{
+		"renamed":  {Title: "x", Fetched: at(1)},
+		"fresh":    {Title: "c", Fetched: at(1)},
+		"old":      {Title: "d", Fetched: at(20)},
+		"volatile": {Title: "e", Fetched: at(10), Changed: at(12)},
+		"overdue":  {Title: "f", Fetched: at(70)},
+		"unknown":  {Title: "g"},
+		"updated":  {Title: "h", Fetched: at(3)},
+	}
+	for _, i := range []struct {
+		limit int
+		want  []string
+	}{
+		{0, nil},
+		{2, []string{"new", "renamed"}},
+		// updated 在上次爬取后有更新
+		{3, []string{"new", "renamed", "updated"}},
+		{4, []string{"new", "renamed", "updated", "unknown"}},
+		{5, []string{"new", "renamed", "updated", "unknown", "overdue"}},
+		// volatile 10 天未爬取，按 40 天计算，先于 20 天未爬取的 old
+		{6, []string{"new", "renamed", "updated", "unknown", "overdue", "volatile"}},
+		{7, []string{"new", "renamed", "updated", "unknown", "overdue", "volatile", "old"}},
+		{100, []string{"new", "renamed", "updated", "unknown", "overdue", "volatile", "old", "fresh"}},
+	} {
+		want := make(map[string]bool)
+		for _, j := range i.want {
+			want[j] = true
+		}
+		if got := dc.choose(list, old, i.limit, now); !reflect.DeepEqual(got, want) {
+			t.Errorf("limit %d: got %v, want %v", i.limit, got, want)
+		}
+	}
+}
+
+func TestDownloadProblemsTimes(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	Now = func() time.Time { return now }
+	defer func() { Now = time.Now }()
+	list := ProblemList{{Pid: "1", Title: "a"}, {Pid: "2", Title: "b"}, {Pid: "3", Title: "c"}, {Pid: "4", Title: "d"}, {Pid: "5", Title: "e"}}
+	old := OldProblemList{
+		"2": {Title: "b", Fetched: 100, Changed: 50},
+		"3": {Title: "c", Fetched: 200, Changed: 50},
+		"4": {Title: "x", Fetched: 300, Changed: 50},
+		"5": {Title: "e", Fetched: now.Unix(), Changed: 50},
+	}
+	DownloadProblems(nil, list, old, 4, func(i *ProblemListItem) error {
+		switch i.Pid {
+		case "2":
+			return ErrUnchanged
+		case "3":
+			return errors.New("bad problem")
+		}
+		i.Data = &Problem{}
+		return nil
+	})
+	want := [][2]int64{{now.Unix(), now.Unix()}, {now.Unix(), 50}, {200, 50}, {now.Unix(), now.Unix()}, {now.Unix(), 50}}
+	for k, i := range list {
+		if got := [2]int64{i.Fetched, i.Changed}; got != want[k] {
+			t.Errorf("problem %s: fetched, changed = %v, want %v", i.Pid, got, want[k])
+		}
+	}
+	if list[4].Data != nil {
+		t.Errorf("problem 5 is fetched just now and should be skipped")
+	}
+	o := NewOldProblemList(list)
+	if o["1"] != (OldProblem{Title: "a", Fetched: now.Unix(), Changed: now.Unix(), Hash: list[0].Hash}) || len(o) != len(list) {
+		t.Errorf("NewOldProblemList = %v", o)
+	}
+}
+
+func TestDownloadProblemsHash(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	Now = func() time.Time { return now }
+	defer func() { Now = time.Now }()
+	p := &Problem{Title: "a", Time: 1000, Description: "题面"}
+	h := ProblemHash(p)
+	list := ProblemList{{Pid: "1", Title: "a"}, {Pid: "2", Title: "a"}, {Pid: "3", Title: "a"}}
+	old := OldProblemList{
+		"1": {Title: "a", Fetched: 100, Changed: 50, Hash: h},
+		"2": {Title: "a", Fetched: 100, Changed: 50, Hash: h},
+		"3": {Title: "a", Fetched: 100, Changed: 50},
+	}
+	DownloadProblems(nil, list, old, 3, func(i *ProblemListItem) error {
+		i.Data = &Problem{Title: "a", Time: 1000, Description: "题面 \r\n"}
+		if i.Pid == "2" {
+			i.Data.Time = 2000
+		}
+		return nil
+	})
+	// 只有空白不同的题面视为未变化；没有记录哈希的题目不更新 Changed
+	for k, want := range []int64{50, now.Unix(), 50} {
+		if list[k].Changed != want || list[k].Hash == "" {
+			t.Errorf("problem %s: changed = %d, hash = %q, want changed = %d", list[k].Pid, list[k].Changed, list[k].Hash, want)
+		}
+	}
+	if list[0].Hash != h {
+		t.Errorf("hash of problem 1 = %s, want %s", list[0].Hash, h)
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	list := ProblemList{{Pid: "1", Title: "a", Updated: 300}, {Pid: "2", Title: "b"}}
+	old := OldProblemList{"1": {Title: "a", Fetched: 100, Hash: "x", Updated: 200}, "2": {Title: "b", Updated: 200, UpstreamHash: "y"}}
+	old.CopyTo(list)
+	if list[0].Updated != 300 || list[0].Hash != "x" || list[0].Fetched != 100 || list[1].Updated != 200 || list[1].UpstreamHash != "y" {
+		t.Errorf("CopyTo = %+v", list)
+	}
+}
@@ -0,0 +1,146 @@
+package public
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrNoSecret 表示未设置所需的机密信息
+var ErrNoSecret = errors.New("secret not found")
+
+// Secrets 提供登录所需的账号、密码等机密信息
+type Secrets interface {
+	// Secret 返回题库 id 的机密信息 key，如 "username"、"password"，未设置时返回 ErrNoSecret
+	Secret(id string, key string) (string, error)
+}
+
+// DefaultSecrets 为未指定 Secrets 时使用的来源：先读取环境变量，再读取 ./config/secrets.json
+var DefaultSecrets Secrets = SecretsChain{EnvSecrets{}, &FileSecrets{Path: "./config/secrets.json"}}
+
+// EnvSecrets 从环境变量 CRAWLER_<题库 id>_<key> 读取机密信息，如 CRAWLER_BZOJ_PASSWORD
+type EnvSecrets struct{}
+
+func (EnvSecrets) Secret(id string, key string) (string, error) {
+	if v, ok := os.LookupEnv(envSecretName(id, key)); ok {
+		return v, nil
+	}
+	return "", ErrNoSecret
+}
+
+// 返回环境变量名，字母转为大写，其余非数字字符转为 _
+func envSecretName(id string, key string) string {
+	return "CRAWLER_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, id+"_"+key)
+}
+
+// FileSecrets 从 json 文件读取机密信息，文件内容为题库 id 到各项机密信息的对象，如 {"bzoj": {"username": "...", "password": "..."}}
+// 文件只在第一次使用时读取；文件包含密码，请勿提交到版本库，并限制其访问权限
+type FileSecrets struct {
+	Path string
+
+	once    sync.Once
+	secrets map[string]map[string]string
+	err     error
+}
+
+func (f *FileSecrets) Secret(id string, key string) (string, error) {
+	f.once.Do(func() {
+		b, err := ioutil.ReadFile(f.Path)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			f.err = err
+			return
+		}
+		err = json.Unmarshal(b, &f.secrets)
+		if err != nil {
+			f.err = fmt.Errorf("%s: %v", f.Path, err)
+		}
+	})
+	if f.err != nil {
+		return "", f.err
+	}
+	if v, ok := f.secrets[id][key]; ok {
+		return v, nil
+	}
+	return "", ErrNoSecret
+}
+
+// LegacySecrets 读取组件旧版本使用的账号文件，仅用于迁移，如 BZOJ 的 ./config/bzoj.json（{"Username": "...", "Password": "..."}）
+// Fields 为机密信息名到文件中字段名的对应关系；从中读取到账号时提示改用环境变量或 secrets.json
+type LegacySecrets struct {
+	Id     string
+	Path   string
+	Fields map[string]string
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+func (l *LegacySecrets) Secret(id string, key string) (string, error) {
+	field, ok := l.Fields[key]
+	if id != l.Id || !ok {
+		return "", ErrNoSecret
+	}
+	l.once.Do(func() {
+		b, err := ioutil.ReadFile(l.Path)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			l.err = err
+			return
+		}
+		err = json.Unmarshal(b, &l.secrets)
+		if err != nil {
+			l.err = fmt.Errorf("%s: %v", l.Path, err)
+			return
+		}
+		log.Printf("%s 的账号读取自旧的配置文件 %s，请改用环境变量 %s 等或 ./config/secrets.json 中的 %q，旧的配置文件将不再支持", l.Id, l.Path, envSecretName(l.Id, "password"), l.Id)
+	})
+	if l.err != nil {
+		return "", l.err
+	}
+	if v, ok := l.secrets[field]; ok {
+		return v, nil
+	}
+	return "", ErrNoSecret
+}
+
+// MapSecrets 为直接给出的机密信息，key 为题库 id，主要用于测试
+type MapSecrets map[string]map[string]string
+
+func (m MapSecrets) Secret(id string, key string) (string, error) {
+	if v, ok := m[id][key]; ok {
+		return v, nil
+	}
+	return "", ErrNoSecret
+}
+
+// SecretsChain 依次从各个来源读取机密信息，返回第一个已设置的值
+type SecretsChain []Secrets
+
+func (c SecretsChain) Secret(id string, key string) (string, error) {
+	for _, i := range c {
+		v, err := i.Secret(id, key)
+		if !errors.Is(err, ErrNoSecret) {
+			return v, err
+		}
+	}
+	return "", ErrNoSecret
+}
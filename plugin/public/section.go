@@ -0,0 +1,203 @@
+package public
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 题面中各节的类型
+const (
+	SectionDescription = "description"
+	SectionInput       = "input"
+	SectionOutput      = "output"
+	SectionSamples     = "samples"
+	SectionConstraints = "constraints"
+	SectionHint        = "hint"
+	SectionSource      = "source"
+	SectionOther       = "other" // 无法归类的节，保留原标题
+)
+
+var sectionOrder = []string{SectionDescription, SectionInput, SectionOutput, SectionSamples, SectionConstraints, SectionHint, SectionOther, SectionSource}
+
+var sectionTitles = map[string]string{
+	SectionDescription: "题目描述",
+	SectionInput:       "输入格式",
+	SectionOutput:      "输出格式",
+	SectionSamples:     "样例",
+	SectionConstraints: "数据范围",
+	SectionHint:        "提示",
+	SectionSource:      "来源",
+}
+
+// Section 为题面中的一节，写入 main.json 的 sections 数组
+type Section struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// 按出现顺序匹配，先匹配到的规则优先
+var sectionRules = []struct {
+	typ  string
+	rule *regexp.Regexp
+}{
+	{SectionSamples, regexp.MustCompile(`(?i)样例|sample|example`)},
+	{SectionInput, regexp.MustCompile(`(?i)输入|input`)},
+	{SectionOutput, regexp.MustCompile(`(?i)输出|output`)},
+	{SectionConstraints, regexp.MustCompile(`(?i)数据范围|数据规模|限制与约定|约定|constraint|limit`)},
+	{SectionHint, regexp.MustCompile(`(?i)提示|说明|注释|备注|hint|note`)},
+	{SectionSource, regexp.MustCompile(`(?i)来源|出处|source`)},
+	{SectionDescription, regexp.MustCompile(`(?i)描述|题面|题意|背景|description|content|statement|background`)},
+}
+
+// ClassifySection 根据原题面中的标题判断节的类型，无法判断时返回 SectionOther
+func ClassifySection(title string) string {
+	for _, i := range sectionRules {
+		if i.rule.MatchString(title) {
+			return i.typ
+		}
+	}
+	return SectionOther
+}
+
+// StatementBuilder 用于按统一的节结构生成题面
+type StatementBuilder struct {
+	sections []Section
+}
+
+func NewStatementBuilder() *StatementBuilder {
+	return &StatementBuilder{}
+}
+
+// Add 追加一节内容，content 为空时忽略，同类型的节会被合并
+func (b *StatementBuilder) Add(typ string, content string) *StatementBuilder {
+	return b.add(Section{Type: typ, Title: sectionTitles[typ], Content: content})
+}
+
+// AddTitled 追加一节内容，节的类型由原标题推断，无法推断时保留原标题
+func (b *StatementBuilder) AddTitled(title string, content string) *StatementBuilder {
+	typ := ClassifySection(title)
+	if typ != SectionOther {
+		return b.Add(typ, content)
+	}
+	return b.add(Section{Type: typ, Title: strings.TrimSpace(title), Content: content})
+}
+
+func (b *StatementBuilder) add(s Section) *StatementBuilder {
+	s.Content = strings.Trim(s.Content, "\r\n")
+	if strings.TrimSpace(s.Content) == "" {
+		return b
+	}
+	for k := range b.sections {
+		if i := &b.sections[k]; i.Type == s.Type && i.Title == s.Title {
+			i.Content += "\n\n" + s.Content
+			return b
+		}
+	}
+	b.sections = append(b.sections, s)
+	return b
+}
+
+// Build 将各节按统一顺序写入 p.Sections，并生成 p.Description
+// 若未添加样例一节而 p.Samples 非空，则由 RenderSamples 生成样例一节
+func (b *StatementBuilder) Build(p *Problem) {
+	sections := make([]Section, len(b.sections))
+	copy(sections, b.sections)
+	hasSamples := false
+	for _, i := range sections {
+		if i.Type == SectionSamples {
+			hasSamples = true
+		}
+	}
+	if !hasSamples && len(p.Samples) > 0 {
+		sections = append(sections, Section{Type: SectionSamples, Title: sectionTitles[SectionSamples], Content: strings.TrimRight(RenderSamples(p.Samples), "\n")})
+	}
+	rank := make(map[string]int)
+	for k, i := range sectionOrder {
+		rank[i] = k
+	}
+	sort.SliceStable(sections, func(i, j int) bool { return rank[sections[i].Type] < rank[sections[j].Type] })
+	p.Sections = sections
+	p.Description = RenderSections(sections)
+}
+
+// RenderSections 将各节渲染为 description.md 的内容
+func RenderSections(sections []Section) string {
+	s := ""
+	for _, i := range sections {
+		s += "# " + i.Title + "\n\n" + i.Content + "\n\n"
+	}
+	return s
+}
+
+// RewriteText 对题面的各部分调用 f，并以返回值替换原内容
+// 有分节时处理各节并重新生成 Description，否则处理 Description；OriginalDescription 非空时也一并处理
+func (p *Problem) RewriteText(f func(string) (string, error)) error {
+	if p.OriginalDescription != "" {
+		t, err := f(p.OriginalDescription)
+		if err != nil {
+			return err
+		}
+		p.OriginalDescription = t
+	}
+	if len(p.Sections) == 0 {
+		t, err := f(p.Description)
+		if err != nil {
+			return err
+		}
+		p.Description = t
+		return nil
+	}
+	for k := range p.Sections {
+		t, err := f(p.Sections[k].Content)
+		if err != nil {
+			return err
+		}
+		p.Sections[k].Content = t
+	}
+	p.Description = RenderSections(p.Sections)
+	return nil
+}
+
+var sectionHeadingRule = regexp.MustCompile(`(?m)^[ \t]{0,3}(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+
+// SplitSections 按 markdown 标题把题面切分为若干 (标题, 内容)，只按最高一级的标题切分
+// 第一个标题前的内容作为无标题的一节返回
+func SplitSections(text string) (titles []string, contents []string) {
+	excluded := fencedBlocks(text)
+	var heads [][]int
+	level := 7
+	for _, m := range sectionHeadingRule.FindAllStringSubmatchIndex(text, -1) {
+		ok := true
+		for _, i := range excluded {
+			if m[0] > i[0] && m[0] < i[1] {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		heads = append(heads, m)
+		if l := m[3] - m[2]; l < level {
+			level = l
+		}
+	}
+	last, title := 0, ""
+	for _, m := range heads {
+		if m[3]-m[2] != level {
+			continue
+		}
+		if m[0] > last || title != "" {
+			titles = append(titles, title)
+			contents = append(contents, text[last:m[0]])
+		}
+		title, last = text[m[4]:m[5]], m[1]
+	}
+	if last < len(text) || title != "" {
+		titles = append(titles, title)
+		contents = append(contents, text[last:])
+	}
+	return titles, contents
+}
@@ -0,0 +1,66 @@
+package public
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifySection(t *testing.T) {
+	tests := []struct {
+		title string
+		typ   string
+	}{
+		{"题目描述", SectionDescription},
+		{"题目背景", SectionDescription},
+		{"Description", SectionDescription},
+		{"Problem Statement", SectionDescription},
+		{"输入格式", SectionInput},
+		{"Input Specification", SectionInput},
+		{"输出", SectionOutput},
+		{"OUTPUT FORMAT", SectionOutput},
+		{"输入样例", SectionSamples},
+		{"Sample Output 2", SectionSamples},
+		{"Examples", SectionSamples},
+		{"样例说明", SectionSamples},
+		{"数据范围与提示", SectionConstraints},
+		{"限制与约定", SectionConstraints},
+		{"Constraints", SectionConstraints},
+		{"提示", SectionHint},
+		{"Note", SectionHint},
+		{"来源", SectionSource},
+		{"Source", SectionSource},
+		{"作者", SectionOther},
+		{"", SectionOther},
+	}
+	for _, i := range tests {
+		if typ := ClassifySection(i.title); typ != i.typ {
+			t.Errorf("ClassifySection(%q) = %q, want %q", i.title, typ, i.typ)
+		}
+	}
+}
+
+func TestStatementBuilder(t *testing.T) {
+	p := &Problem{Samples: []Sample{{Input: "1\n", Output: "2\n"}}}
+	NewStatementBuilder().
+		AddTitled("来源", "NOI").
+		Add(SectionOutput, "输出一个数").
+		AddTitled("作者", "someone").
+		Add(SectionHint, " \n\n").
+		Add(SectionInput, "").
+		AddTitled("Description", "\n题面\n").
+		Add(SectionDescription, "补充").
+		Build(p)
+	want := []Section{
+		{Type: SectionDescription, Title: "题目描述", Content: "题面\n\n补充"},
+		{Type: SectionOutput, Title: "输出格式", Content: "输出一个数"},
+		{Type: SectionSamples, Title: "样例", Content: "### 样例输入 #1\n\n```\n1\n```\n\n### 样例输出 #1\n\n```\n2\n```"},
+		{Type: SectionOther, Title: "作者", Content: "someone"},
+		{Type: SectionSource, Title: "来源", Content: "NOI"},
+	}
+	if !reflect.DeepEqual(p.Sections, want) {
+		t.Errorf("Sections = %+v, want %+v", p.Sections, want)
+	}
+	if p.Description != RenderSections(want) {
+		t.Errorf("Description = %q", p.Description)
+	}
+}
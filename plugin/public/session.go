@@ -0,0 +1,388 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 登录失败与会话失效的错误，可用 errors.Is 判断
+var (
+	ErrLoginFailed    = errors.New("login failed")
+	ErrSessionExpired = errors.New("session expired")
+)
+
+// 登录请求的格式
+const (
+	LoginForm = "form"
+	LoginJson = "json"
+)
+
+// Session 为需要账号的题库的会话：用 Secrets 中的账号登录，会话过期时自动重新登录，并可将 cookie 保存到文件供下次运行使用
+// 可被多个 goroutine 同时使用
+type Session struct {
+	// 题库 id，用于读取机密信息
+	Id string
+	// 发出请求所用的设置，其 Client 带有本会话的 cookie
+	Http *HttpConfig
+	// 登录请求的地址
+	LoginUrl string
+	// 登录请求的格式，LoginForm 或 LoginJson
+	Format string
+	// 登录请求的字段，key 为字段名，value 为机密信息名，如 {"user_id": "username", "password": "password"}
+	Fields map[string]string
+	// 判断登录是否成功，参数为登录请求返回的内容；为 nil 时登录请求返回 2xx 即视为成功
+	Check func(body []byte) error
+	// 会话过期的标志：请求被重定向到 LoginPage，或返回的内容中含有 ExpiredMarker；为空时不检查
+	LoginPage     string
+	ExpiredMarker string
+	// 保存 cookie 的文件，为空时不保存
+	CookiePath string
+	// 机密信息的来源，为 nil 时使用 DefaultSecrets
+	Secrets Secrets
+
+	jar *recordingJar
+	mu  sync.Mutex
+	// 成功登录的次数，用于避免多个 goroutine 同时发现会话过期时重复登录
+	logins int
+}
+
+// NewSession 返回题库 id 的会话，登录请求以表单形式发送到 loginUrl
+// 请求使用 c 中的设置，c 的 Client 会被替换为带有 cookie 的副本；c 为 nil 时使用 DefaultHttpConfig 的副本
+func NewSession(id string, c *HttpConfig, loginUrl string) *Session {
+	if c == nil {
+		x := *DefaultHttpConfig
+		c = &x
+	}
+	// Options 为 nil 时不会出错
+	j, _ := cookiejar.New(nil)
+	jar := &recordingJar{Jar: j, cookies: make(map[string]savedCookie)}
+	client := *c.baseClient()
+	client.Jar = jar
+	c.Client = &client
+	return &Session{Id: id, Http: c, LoginUrl: loginUrl, Format: LoginForm, jar: jar}
+}
+
+// BodyContains 返回登录后的内容中含有 marker 时才成功的 Check
+func BodyContains(marker string) func([]byte) error {
+	return func(b []byte) error {
+		if !bytes.Contains(b, []byte(marker)) {
+			return fmt.Errorf("%w: %.200s", ErrLoginFailed, b)
+		}
+		return nil
+	}
+}
+
+// BodyNotContains 返回登录后的内容中含有 marker 时失败的 Check，如密码错误时弹出的 alert
+func BodyNotContains(marker string) func([]byte) error {
+	return func(b []byte) error {
+		if bytes.Contains(b, []byte(marker)) {
+			return fmt.Errorf("%w: %.200s", ErrLoginFailed, b)
+		}
+		return nil
+	}
+}
+
+// Open 载入 CookiePath 中保存的 cookie，没有保存的 cookie 时登录
+// 载入的 cookie 可能已经失效，此时会在第一次发现会话过期时重新登录
+func (s *Session) Open() error {
+	ok, err := s.loadCookies()
+	if err != nil {
+		log.Printf("读取%s的 cookie 时出现错误:%v", s.Id, err)
+	}
+	if ok {
+		return nil
+	}
+	return s.Login()
+}
+
+// Login 登录并保存 cookie
+func (s *Session) Login() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.login()
+}
+
+func (s *Session) login() error {
+	secrets := s.Secrets
+	if secrets == nil {
+		secrets = DefaultSecrets
+	}
+	fields := make(map[string]string, len(s.Fields))
+	for k, v := range s.Fields {
+		x, err := secrets.Secret(s.Id, v)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", s.Id, v, err)
+		}
+		fields[k] = x
+	}
+	var body []byte
+	var contentType string
+	switch s.Format {
+	case LoginJson:
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		body, contentType = b, "application/json"
+	default:
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, v)
+		}
+		body, contentType = []byte(form.Encode()), "application/x-www-form-urlencoded"
+	}
+	b, err := PostAndRead(s.Http, s.LoginUrl, contentType, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLoginFailed, err)
+	}
+	if s.Check != nil {
+		err = s.Check(b)
+		if err != nil {
+			return err
+		}
+	}
+	s.logins++
+	err = s.saveCookies()
+	if err != nil {
+		log.Printf("保存%s的 cookie 时出现错误:%v", s.Id, err)
+	}
+	return nil
+}
+
+// 其他 goroutine 未在此期间登录时重新登录，logins 为发出请求前的登录次数
+func (s *Session) relogin(logins int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.logins != logins {
+		return nil
+	}
+	log.Printf("%s的会话已过期，重新登录", s.Id)
+	return s.login()
+}
+
+// 判断响应是否表示会话已过期
+func (s *Session) expired(res *http.Response, body []byte) bool {
+	if s.ExpiredMarker != "" && bytes.Contains(body, []byte(s.ExpiredMarker)) {
+		return true
+	}
+	if s.LoginPage == "" || res.Request == nil {
+		return false
+	}
+	u, err := url.Parse(s.LoginPage)
+	if err != nil {
+		return false
+	}
+	return res.Request.URL.Host == u.Host && res.Request.URL.Path == u.Path
+}
+
+// Do 发出请求并返回响应的内容，会话过期时重新登录并重试一次，仍然过期时返回 ErrSessionExpired
+func (s *Session) Do(ctx context.Context, method string, url string, contentType string, body []byte) ([]byte, error) {
+	for retry := false; ; retry = true {
+		s.mu.Lock()
+		logins := s.logins
+		s.mu.Unlock()
+		res, err := DoRequest(ctx, s.Http, method, url, contentType, body)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !s.expired(res, b) {
+			return b, nil
+		}
+		if retry {
+			return nil, fmt.Errorf("%s: %w", url, ErrSessionExpired)
+		}
+		err = s.relogin(logins)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Download 同 public.Download，会话过期时重新登录
+func (s *Session) Download(url string) ([]byte, error) {
+	return s.Do(context.Background(), http.MethodGet, url, "", nil)
+}
+
+// PostForm 以表单形式发送 POST 请求并返回响应的内容，会话过期时重新登录
+func (s *Session) PostForm(url string, form url.Values) ([]byte, error) {
+	return s.Do(context.Background(), http.MethodPost, url, "application/x-www-form-urlencoded", []byte(form.Encode()))
+}
+
+// GetDocument 同 public.GetDocument，会话过期时重新登录
+func (s *Session) GetDocument(url string) (*goquery.Document, error) {
+	b, err := s.Download(url)
+	if err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromReader(bytes.NewReader(b))
+}
+
+// 保存在 CookiePath 中的 cookie
+// Host 为只发送给设置它的主机的 cookie 所属的主机，Domain 为发送给该域名及其子域名的 cookie 的域名，两者只有一个非空
+// Expires 为过期时间的 Unix 时间戳，为 0 时为会话 cookie
+type savedCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Host     string `json:"host,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Expires  int64  `json:"expires,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HttpOnly bool   `json:"http_only,omitempty"`
+}
+
+func (c *savedCookie) expired(now time.Time) bool {
+	return c.Expires != 0 && c.Expires <= now.Unix()
+}
+
+// 在 jar 中设置 cookie，返回是否设置
+func (c *savedCookie) restore(jar http.CookieJar) bool {
+	host := c.Host
+	if host == "" {
+		host = c.Domain
+	}
+	if host == "" || c.expired(time.Now()) {
+		return false
+	}
+	u := &url.URL{Scheme: "http", Host: host, Path: c.Path}
+	if c.Secure {
+		u.Scheme = "https"
+	}
+	x := &http.Cookie{Name: c.Name, Value: c.Value, Domain: c.Domain, Path: c.Path, Secure: c.Secure, HttpOnly: c.HttpOnly}
+	if c.Expires != 0 {
+		x.Expires = time.Unix(c.Expires, 0)
+	}
+	jar.SetCookies(u, []*http.Cookie{x})
+	return true
+}
+
+// recordingJar 在 cookiejar 之外记录 cookie 的域名、路径与过期时间，cookiejar 的 Cookies 不返回这些信息，保存 cookie 时需要
+type recordingJar struct {
+	*cookiejar.Jar
+	mu      sync.Mutex
+	cookies map[string]savedCookie
+}
+
+func (j *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	for _, i := range cookies {
+		x := savedCookie{Name: i.Name, Value: i.Value, Domain: strings.ToLower(strings.TrimPrefix(i.Domain, ".")), Path: i.Path, Secure: i.Secure, HttpOnly: i.HttpOnly}
+		if x.Domain == "" {
+			x.Host = strings.ToLower(u.Hostname())
+		}
+		if x.Path == "" || x.Path[0] != '/' {
+			// 与 cookiejar 相同的默认路径：请求路径中最后一个 / 之前的部分
+			x.Path = "/"
+			if k := strings.LastIndexByte(u.Path, '/'); k > 0 {
+				x.Path = u.Path[:k]
+			}
+		}
+		switch {
+		case i.MaxAge < 0:
+			x.Expires = now.Unix()
+		case i.MaxAge > 0:
+			x.Expires = now.Add(time.Duration(i.MaxAge) * time.Second).Unix()
+		case !i.Expires.IsZero():
+			x.Expires = i.Expires.Unix()
+		}
+		key := x.Host + ";" + x.Domain + ";" + x.Path + ";" + x.Name
+		if x.expired(now) {
+			delete(j.cookies, key)
+		} else {
+			j.cookies[key] = x
+		}
+	}
+}
+
+// 返回尚未过期的 cookie，按名称排序
+func (j *recordingJar) saved() []savedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	res := make([]savedCookie, 0, len(j.cookies))
+	for _, i := range j.cookies {
+		if !i.expired(now) {
+			res = append(res, i)
+		}
+	}
+	sort.Slice(res, func(a, b int) bool {
+		if res[a].Name != res[b].Name {
+			return res[a].Name < res[b].Name
+		}
+		return res[a].Host+res[a].Domain+res[a].Path < res[b].Host+res[b].Domain+res[b].Path
+	})
+	return res
+}
+
+// 载入保存的 cookie，返回是否载入了 cookie；已过期的 cookie 不载入
+func (s *Session) loadCookies() (bool, error) {
+	if s.CookiePath == "" {
+		return false, nil
+	}
+	b, err := ioutil.ReadFile(s.CookiePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	x := make([]savedCookie, 0)
+	err = json.Unmarshal(b, &x)
+	if err != nil {
+		return false, err
+	}
+	u, err := url.Parse(s.LoginUrl)
+	if err != nil {
+		return false, err
+	}
+	ok := false
+	for _, i := range x {
+		if i.Host == "" && i.Domain == "" {
+			// 旧版本只保存了名称与值，视为登录地址所在网站的 cookie
+			i.Host, i.Path = u.Hostname(), "/"
+		}
+		if i.restore(s.jar) {
+			ok = true
+		}
+	}
+	return ok, nil
+}
+
+// 保存本会话中设置的 cookie，文件仅当前用户可读写
+func (s *Session) saveCookies() error {
+	if s.CookiePath == "" {
+		return nil
+	}
+	b, err := json.Marshal(s.jar.saved())
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.CookiePath), 0700)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.CookiePath, b, 0600)
+}
@@ -0,0 +1,202 @@
+package public
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 假的题库：POST /login 接受 json 格式的账号，会话 cookie 失效时 /page 重定向到 /login-page
+type sessionServer struct {
+	mu      sync.Mutex
+	session string
+	logins  int
+}
+
+func (s *sessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.URL.Path {
+	case "/login":
+		x := make(map[string]string)
+		if json.NewDecoder(r.Body).Decode(&x) != nil || x["name"] != "user" || x["pass"] != "secret" {
+			_, _ = w.Write([]byte(`{"ok":false}`))
+			return
+		}
+		s.logins++
+		s.session = "s" + string(rune('0'+s.logins))
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: s.session, Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "theme", Value: "dark", Path: "/page", MaxAge: 3600})
+		http.SetCookie(w, &http.Cookie{Name: "old", Value: "x", Expires: time.Unix(1, 0)})
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	case "/page":
+		if c, err := r.Cookie("sid"); err != nil || c.Value != s.session {
+			http.Redirect(w, r, "/login-page", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("content"))
+	case "/login-page":
+		_, _ = w.Write([]byte("please login"))
+	}
+}
+
+func (s *sessionServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = ""
+}
+
+func newTestSession(url string, password string) *Session {
+	s := NewSession("oj", &HttpConfig{RobotsPermission: "test", Retry: testRetryPolicy}, url+"/login")
+	s.Format = LoginJson
+	s.Fields = map[string]string{"name": "username", "pass": "password"}
+	s.Check = BodyContains(`"ok":true`)
+	s.LoginPage = url + "/login-page"
+	s.Secrets = MapSecrets{"oj": {"username": "user", "password": password}}
+	return s
+}
+
+func TestSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h := &sessionServer{}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	s := newTestSession(server.URL, "wrong")
+	if err := s.Open(); !errors.Is(err, ErrLoginFailed) {
+		t.Errorf("Open with a wrong password = %v, want ErrLoginFailed", err)
+	}
+
+	s = newTestSession(server.URL, "secret")
+	s.CookiePath = filepath.Join(dir, "cookies", "oj.json")
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(s.CookiePath); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("cookie file is not saved with mode 0600: %v", err)
+	}
+	// 会话过期时多个 goroutine 只重新登录一次
+	h.expire()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := s.Download(server.URL + "/page")
+			if err != nil || string(b) != "content" {
+				t.Errorf("Download = %q, %v", b, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if h.logins != 2 {
+		t.Errorf("logged in %d times, want 2", h.logins)
+	}
+
+	// 下次运行时使用保存的 cookie
+	s2 := newTestSession(server.URL, "secret")
+	s2.CookiePath = s.CookiePath
+	if err := s2.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := s2.Download(server.URL + "/page"); err != nil || string(b) != "content" || h.logins != 2 {
+		t.Errorf("Download with saved cookies = %q, %v after %d logins", b, err, h.logins)
+	}
+	// 保存的 cookie 保留路径与过期时间，已过期的 cookie 不保存
+	saved := make([]savedCookie, 0)
+	if b, err := ioutil.ReadFile(s.CookiePath); err != nil || json.Unmarshal(b, &saved) != nil {
+		t.Fatalf("cannot read saved cookies: %v", err)
+	}
+	if len(saved) != 2 || saved[0].Name != "sid" || saved[0].Path != "/" || saved[0].Expires != 0 ||
+		saved[1].Name != "theme" || saved[1].Path != "/page" || saved[1].Expires <= time.Now().Unix() || saved[1].Host != "127.0.0.1" {
+		t.Errorf("unexpected saved cookies: %+v", saved)
+	}
+	u, _ := url.Parse(server.URL + "/page/1")
+	if c := s2.jar.Cookies(u); len(c) != 2 {
+		t.Errorf("restored cookies for /page/1 = %v, want sid and theme", c)
+	}
+	u, _ = url.Parse(server.URL + "/other")
+	if c := s2.jar.Cookies(u); len(c) != 1 || c[0].Name != "sid" {
+		t.Errorf("restored cookies for /other = %v, want sid", c)
+	}
+
+	// 旧版本只保存名称与值的 cookie 文件
+	if err := ioutil.WriteFile(s.CookiePath, []byte(`[{"name":"sid","value":"`+h.session+`"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s4 := newTestSession(server.URL, "secret")
+	s4.CookiePath = s.CookiePath
+	if err := s4.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := s4.Download(server.URL + "/page"); err != nil || string(b) != "content" || h.logins != 2 {
+		t.Errorf("Download with legacy cookies = %q, %v after %d logins", b, err, h.logins)
+	}
+
+	// 重新登录后仍被重定向到登录页
+	s3 := newTestSession(server.URL, "secret")
+	s3.LoginUrl = server.URL + "/login-page"
+	s3.Check = nil
+	if _, err := s3.Download(server.URL + "/page"); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Download = %v, want ErrSessionExpired", err)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.json")
+	if err := ioutil.WriteFile(path, []byte(`{"my-oj": {"username": "file-user", "password": "file-pass"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("CRAWLER_MY_OJ_PASSWORD")
+	os.Setenv("CRAWLER_MY_OJ_PASSWORD", "env-pass")
+	s := SecretsChain{EnvSecrets{}, &FileSecrets{Path: path}}
+	tests := []struct {
+		id, key string
+		want    string
+		err     error
+	}{
+		{"my-oj", "password", "env-pass", nil},
+		{"my-oj", "username", "file-user", nil},
+		{"my-oj", "token", "", ErrNoSecret},
+		{"other", "password", "", ErrNoSecret},
+	}
+	for _, i := range tests {
+		v, err := s.Secret(i.id, i.key)
+		if v != i.want || !errors.Is(err, i.err) {
+			t.Errorf("Secret(%q, %q) = %q, %v, want %q, %v", i.id, i.key, v, err, i.want, i.err)
+		}
+	}
+	if _, err := (&FileSecrets{Path: filepath.Join(dir, "none.json")}).Secret("my-oj", "password"); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("Secret without file = %v, want ErrNoSecret", err)
+	}
+
+	// 旧版本的账号文件
+	legacy := filepath.Join(dir, "my-oj.json")
+	if err := ioutil.WriteFile(legacy, []byte(`{"Username": "old-user", "Password": "old-pass"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l := &LegacySecrets{Id: "my-oj", Path: legacy, Fields: map[string]string{"username": "Username", "password": "Password"}}
+	s = SecretsChain{EnvSecrets{}, l}
+	for _, i := range []struct{ id, key, want string }{{"my-oj", "password", "env-pass"}, {"my-oj", "username", "old-user"}, {"other", "username", ""}} {
+		if v, _ := s.Secret(i.id, i.key); v != i.want {
+			t.Errorf("Secret(%q, %q) with legacy file = %q, want %q", i.id, i.key, v, i.want)
+		}
+	}
+}
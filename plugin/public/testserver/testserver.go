@@ -0,0 +1,218 @@
+// Package testserver 提供进程内的主服务实现，用于在 go test 中端到端地运行组件
+//
+// Server 实现了 rpc.APIServer，提交的文件保存在内存中，不会写入 git 仓库。
+package testserver
+
+import (
+	"context"
+	. "crawler/plugin/public"
+	"crawler/rpc"
+	"encoding/json"
+	"google.golang.org/grpc"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type Server struct {
+	// Register 返回的调试模式
+	DebugMode bool
+	// 为 true 时 Update 返回失败，且不保存提交的文件
+	FailUpdate bool
+
+	mu         sync.Mutex
+	files      map[string][]byte
+	updates    []*rpc.UpdateRequest
+	registered []*rpc.Info
+}
+
+func New() *Server {
+	return &Server{files: make(map[string][]byte)}
+}
+
+// SetFile 设置仓库中已有的文件，name 为完整路径，如 "uoj/_assets/index.json"
+func (s *Server) SetFile(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = data
+}
+
+// SetProblemlist 设置题库 id 已归档的题目列表，组件 Start 时通过 GetProblemlist 读取
+func (s *Server) SetProblemlist(id string, list ProblemList) {
+	b, err := json.Marshal(list)
+	if err != nil {
+		panic(err)
+	}
+	s.SetFile(id+"/problemlist.json", b)
+}
+
+func (s *Server) Register(ctx context.Context, req *rpc.RegisterRequest) (*rpc.RegisterReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registered = append(s.registered, req.Info)
+	return &rpc.RegisterReply{DebugMode: s.DebugMode}, nil
+}
+
+func (s *Server) GetProblemlist(ctx context.Context, req *rpc.Info) (*rpc.GetProblemlistReply, error) {
+	s.mu.Lock()
+	b, ok := s.files[req.Id+"/problemlist.json"]
+	s.mu.Unlock()
+	if !ok {
+		return &rpc.GetProblemlistReply{Ok: true, Data: []*rpc.ProblemlistData{}}, nil
+	}
+	x := ProblemList{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return &rpc.GetProblemlistReply{Ok: false}, nil
+	}
+	l := make([]*rpc.ProblemlistData, 0)
+	for _, i := range x {
+		l = append(l, &rpc.ProblemlistData{Pid: i.Pid, Title: i.Title, Fetched: i.Fetched, Changed: i.Changed, Hash: i.Hash, Updated: i.Updated, UpstreamHash: i.UpstreamHash})
+	}
+	return &rpc.GetProblemlistReply{Ok: true, Data: l}, nil
+}
+
+func (s *Server) Update(ctx context.Context, req *rpc.UpdateRequest) (*rpc.UpdateReply, error) {
+	// 复制一份，组件之后修改 fileList 不影响记录
+	files := make(map[string][]byte, len(req.File))
+	for k, v := range req.File {
+		files[k] = v
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, &rpc.UpdateRequest{Info: req.Info, File: files})
+	if s.FailUpdate {
+		return &rpc.UpdateReply{Ok: false}, nil
+	}
+	for k, v := range files {
+		s.files[k] = v
+	}
+	return &rpc.UpdateReply{Ok: true}, nil
+}
+
+func (s *Server) GetFile(ctx context.Context, req *rpc.GetFileRequest) (*rpc.GetFileReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.files[path.Clean("/" + req.Info.Id)[1:]+path.Clean("/"+req.Path)]
+	if !ok {
+		return &rpc.GetFileReply{Ok: false}, nil
+	}
+	return &rpc.GetFileReply{Ok: true, Data: b}, nil
+}
+
+type client struct {
+	s *Server
+}
+
+func (c client) Register(ctx context.Context, in *rpc.RegisterRequest, opts ...grpc.CallOption) (*rpc.RegisterReply, error) {
+	return c.s.Register(ctx, in)
+}
+
+func (c client) GetProblemlist(ctx context.Context, in *rpc.Info, opts ...grpc.CallOption) (*rpc.GetProblemlistReply, error) {
+	return c.s.GetProblemlist(ctx, in)
+}
+
+func (c client) Update(ctx context.Context, in *rpc.UpdateRequest, opts ...grpc.CallOption) (*rpc.UpdateReply, error) {
+	return c.s.Update(ctx, in)
+}
+
+func (c client) GetFile(ctx context.Context, in *rpc.GetFileRequest, opts ...grpc.CallOption) (*rpc.GetFileReply, error) {
+	return c.s.GetFile(ctx, in)
+}
+
+// Client 返回直接调用 s 的 rpc.APIClient
+func (s *Server) Client() rpc.APIClient {
+	return client{s}
+}
+
+// Use 将 public.Connect 替换为连接到 s，返回恢复原函数的函数
+func (s *Server) Use() func() {
+	old := Connect
+	Connect = func() (rpc.APIClient, func() error, error) {
+		return s.Client(), func() error { return nil }, nil
+	}
+	return func() { Connect = old }
+}
+
+// Registered 返回调用过 Register 的题库
+func (s *Server) Registered() []*rpc.Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*rpc.Info(nil), s.registered...)
+}
+
+// Updates 按顺序返回所有 Update 请求
+func (s *Server) Updates() []*rpc.UpdateRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*rpc.UpdateRequest(nil), s.updates...)
+}
+
+// File 返回仓库中的文件，含已成功提交的文件
+func (s *Server) File(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.files[name]
+	return b, ok
+}
+
+// Submitted 返回所有 Update 请求中提交过的文件路径，已排序
+func (s *Server) Submitted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]bool)
+	for _, i := range s.updates {
+		for k := range i.File {
+			m[k] = true
+		}
+	}
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// AssertSubmitted 检查 names 中的每个文件都曾被提交
+func (s *Server) AssertSubmitted(t testing.TB, names ...string) {
+	t.Helper()
+	m := make(map[string]bool)
+	for _, i := range s.Submitted() {
+		m[i] = true
+	}
+	for _, i := range names {
+		if !m[i] {
+			t.Errorf("%s was not submitted", i)
+		}
+	}
+}
+
+// AssertNotSubmitted 检查 names 中的文件都未被提交
+func (s *Server) AssertNotSubmitted(t testing.TB, names ...string) {
+	t.Helper()
+	m := make(map[string]bool)
+	for _, i := range s.Submitted() {
+		m[i] = true
+	}
+	for _, i := range names {
+		if m[i] {
+			t.Errorf("%s was submitted", i)
+		}
+	}
+}
+
+// MainJson 读取并解析题库 id 中题目 pid 的 main.json，文件不存在或无法解析时测试失败
+func (s *Server) MainJson(t testing.TB, id string, pid string) *Problem {
+	t.Helper()
+	name := id + "/" + pid + "/main.json"
+	b, ok := s.File(name)
+	if !ok {
+		t.Fatalf("%s was not submitted", name)
+	}
+	p := &Problem{}
+	if err := json.Unmarshal(b, p); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return p
+}
@@ -0,0 +1,51 @@
+package testserver
+
+import (
+	"context"
+	. "crawler/plugin/public"
+	"crawler/rpc"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	s := New()
+	s.SetProblemlist("oj", ProblemList{{Pid: "1", Title: "A"}})
+	s.SetFile("oj/_assets/index.json", []byte("{}"))
+	defer s.Use()()
+	c, closeConn, err := Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeConn()
+	info := &rpc.Info{Id: "oj", Name: "OJ"}
+
+	pl, err := c.GetProblemlist(context.Background(), info)
+	if err != nil || !pl.Ok || len(pl.Data) != 1 || pl.Data[0].Title != "A" {
+		t.Errorf("GetProblemlist = %v, %v", pl, err)
+	}
+	f, err := c.GetFile(context.Background(), &rpc.GetFileRequest{Info: info, Path: "_assets/../_assets/index.json"})
+	if err != nil || !f.Ok || string(f.Data) != "{}" {
+		t.Errorf("GetFile = %v, %v", f, err)
+	}
+
+	files := map[string][]byte{"oj/1/main.json": []byte(`{"title":"B","time":1000}`)}
+	r, err := c.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: files})
+	if err != nil || !r.Ok {
+		t.Fatalf("Update = %v, %v", r, err)
+	}
+	files["oj/2/main.json"] = nil
+	s.AssertSubmitted(t, "oj/1/main.json")
+	s.AssertNotSubmitted(t, "oj/2/main.json")
+	if p := s.MainJson(t, "oj", "1"); p.Title != "B" || p.Time != 1000 {
+		t.Errorf("MainJson = %+v", p)
+	}
+
+	s.FailUpdate = true
+	r, err = c.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: map[string][]byte{"oj/3/main.json": nil}})
+	if err != nil || r.Ok {
+		t.Errorf("failed Update = %v, %v", r, err)
+	}
+	if _, ok := s.File("oj/3/main.json"); ok || len(s.Updates()) != 2 {
+		t.Errorf("failed Update was saved")
+	}
+}
@@ -8,134 +8,142 @@ import (
 	"context"
 	"crawler/rpc"
 	"crypto/md5"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/html"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Problem struct {
-	Time            int    `json:"time"`
-	Memory          int    `json:"memory"`
-	Title           string `json:"title"`
-	Judge           string `json:"judge"`
-	Url             string `json:"url"`
-	Description     string `json:"-"`
-	DescriptionType string `json:"description_type"`
+	Time            int          `json:"time"`
+	Memory          int          `json:"memory"`
+	Title           string       `json:"title"`
+	Judge           string       `json:"judge"`
+	Url             string       `json:"url"`
+	Description     string       `json:"-"`
+	DescriptionType string       `json:"description_type"`
+	Samples         []Sample     `json:"samples,omitempty"`
+	Sections        []Section    `json:"sections,omitempty"`
+	Attachments     []Attachment `json:"attachments,omitempty"`
+	// 爬取过程中出现的问题，如未能保存的图片
+	Warnings []string `json:"warnings,omitempty"`
+	// 转换为 markdown 前的原始 html 题面，非空时另存为 description.html
+	OriginalDescription string `json:"-"`
 }
 
 type ProblemListItem struct {
-	Title string   `json:"title"`
-	Pid   string   `json:"pid"`
-	Data  *Problem `json:"-"`
+	Title string `json:"title"`
+	Pid   string `json:"pid"`
+	// 上次成功爬取与上次发现变化的时间，unix 时间戳，用于选择要更新的题目
+	Fetched int64 `json:"fetched,omitempty"`
+	Changed int64 `json:"changed,omitempty"`
+	// 上次爬取的题目内容的哈希，见 ProblemHash
+	Hash string `json:"hash,omitempty"`
+	// 题库提供的题目更新时间，unix 时间戳，如题目列表中的更新时间或 API 的 updated_at，由组件在生成题目列表时填写
+	Updated int64 `json:"updated,omitempty"`
+	// 题库返回的原始数据的哈希，见 UpstreamHash，由组件在 getProblem 中填写
+	UpstreamHash string   `json:"upstream_hash,omitempty"`
+	Data         *Problem `json:"-"`
 }
 
 type ProblemList []ProblemListItem
 
-type FileList map[string][]byte
-
 type HttpConfig struct {
-	Client    *http.Client
+	// 发出请求所用的 Client，为 nil 时使用 DefaultHttpConfig.Client
+	Client *http.Client
+	// 每次请求前的等待时间，多个请求并发时请使用 Limits
 	SleepTime time.Duration
+	// 各域名的访问限制，key 为域名（可带端口），"*" 对应未单独设置的域名；同一域名的限制由进程中所有 HttpConfig 共享，取最严格的一个
+	Limits map[string]*HostLimit
+	// 非空时不检查 robots.txt，用于记录题库所有者的明确许可，如 "2021-09-01 邮件许可"
+	RobotsPermission string
+	// GET 请求的磁盘缓存，为 nil 时不缓存
+	Cache *DiskCache
+	// 请求失败时的重试策略，为 nil 时使用 DefaultRetryPolicy
+	Retry *RetryPolicy
+	// 图片的校验规则，为 nil 时使用 DefaultImageConfig
+	Image *ImageConfig
+	// 代理设置，为 nil 时使用 DefaultHttpConfig.Proxy
+	Proxy *ProxyConfig
+	// 每个请求默认带有的请求头，为 nil 时使用 DefaultHttpConfig.Header；未设置 User-Agent 时使用 UserAgent
+	Header http.Header
+	// 各域名单独设置的请求头，覆盖 Header 中的同名项，key 为域名（可带端口）
+	HostHeader map[string]http.Header
 }
 
+// DefaultHttpConfig 为 c 为 nil 时使用的配置，其 Client 同时是所有未设置 Client 的请求所用的 Client
+// 测试时可将其替换为 vcr 录制或回放的 Client
 var DefaultHttpConfig = &HttpConfig{Client: nil, SleepTime: 200 * time.Millisecond}
 
-// SafeGet 是 http.Get 的简单封装，会在产生错误时重试 2 次，若重试全部失败，则返回最后一次的错误
-func SafeGet(c *HttpConfig, url string) (res *http.Response, err error) {
-	if c == nil {
-		c = DefaultHttpConfig
+// 返回 c 所设置的 Client，未设置时返回 DefaultHttpConfig.Client 或 http.DefaultClient
+func (c *HttpConfig) baseClient() *http.Client {
+	if c.Client != nil {
+		return c.Client
 	}
-	time.Sleep(c.SleepTime)
-	for i := 1; i <= 3; i++ {
-		if c.Client == nil {
-			res, err = http.Get(url)
-		} else {
-			res, err = c.Client.Get(url)
-		}
-		if err != nil {
-			time.Sleep(c.SleepTime)
-			continue
-		}
-		if res.StatusCode != 200 {
-			err = fmt.Errorf("get %s error,status code = %d", url, res.StatusCode)
-			time.Sleep(c.SleepTime)
-			continue
-		}
-		return res, nil
+	if DefaultHttpConfig.Client != nil {
+		return DefaultHttpConfig.Client
 	}
-	return nil, err
+	return http.DefaultClient
 }
 
-// SafePost 是 http.PostForm 的简单封装，会在产生错误时重试 2 次，若重试全部失败，则返回最后一次的错误
-func SafePost(c *HttpConfig, url string, contentType string, data []byte) (res *http.Response, err error) {
-	if c == nil {
-		c = DefaultHttpConfig
+// 返回 c 发出请求所用的 Client，设置了代理时返回使用代理的副本
+func (c *HttpConfig) client() (*http.Client, error) {
+	client := c.baseClient()
+	p := c.Proxy
+	if p == nil {
+		p = DefaultHttpConfig.Proxy
 	}
-	time.Sleep(c.SleepTime)
-	for i := 1; i <= 3; i++ {
-		if c.Client == nil {
-			res, err = http.Post(url, contentType, bytes.NewReader(data))
-		} else {
-			res, err = c.Client.Post(url, contentType, bytes.NewReader(data))
-		}
-		if err != nil {
-			time.Sleep(c.SleepTime)
-			continue
-		}
-		if res.StatusCode != 200 {
-			err = fmt.Errorf("post %s error,status code = %d", url, res.StatusCode)
-			time.Sleep(c.SleepTime)
-			continue
-		}
-		return res, nil
+	if p == nil {
+		return client, nil
 	}
-	return nil, err
+	return p.client(client)
 }
 
-// SafePostForm 是 http.PostForm 的简单封装，会在产生错误时重试 2 次，若重试全部失败，则返回最后一次的错误
-func SafePostForm(c *HttpConfig, url string, form url.Values) (res *http.Response, err error) {
-	if c == nil {
-		c = DefaultHttpConfig
+// Transport 返回 c 发出请求所用的 Transport，已按 c.Proxy（未设置时为 DefaultHttpConfig.Proxy）设置代理，供需要包装 Transport 的插件使用
+// 代理无法应用于 Client 的 Transport 时返回错误
+func (c *HttpConfig) Transport() (http.RoundTripper, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
 	}
-	time.Sleep(c.SleepTime)
-	for i := 1; i <= 3; i++ {
-		if c.Client == nil {
-			res, err = http.PostForm(url, form)
-		} else {
-			res, err = c.Client.PostForm(url, form)
-		}
-		if err != nil {
-			time.Sleep(c.SleepTime)
-			continue
-		}
-		if res.StatusCode != 200 {
-			err = fmt.Errorf("post %s error,status code = %d", url, res.StatusCode)
-			time.Sleep(c.SleepTime)
-			continue
-		}
-		return res, nil
+	if client.Transport == nil {
+		return http.DefaultTransport, nil
 	}
-	return nil, err
+	return client.Transport, nil
+}
+
+// SafeGet 发送 GET 请求，按 c.Retry 的策略重试，若重试全部失败，则返回最后一次的错误
+func SafeGet(c *HttpConfig, url string) (*http.Response, error) {
+	return SafeGetContext(context.Background(), c, url)
+}
+
+// SafePost 发送 POST 请求，重试策略同 SafeGet
+func SafePost(c *HttpConfig, url string, contentType string, data []byte) (*http.Response, error) {
+	return SafePostContext(context.Background(), c, url, contentType, data)
+}
+
+// SafePostForm 以表单形式发送 POST 请求，重试策略同 SafeGet
+func SafePostForm(c *HttpConfig, url string, form url.Values) (*http.Response, error) {
+	return SafePostFormContext(context.Background(), c, url, form)
+}
+
+// SafePostFormContext 同 SafePostForm，可通过 ctx 取消
+func SafePostFormContext(ctx context.Context, c *HttpConfig, url string, form url.Values) (*http.Response, error) {
+	return SafePostContext(ctx, c, url, "application/x-www-form-urlencoded", []byte(form.Encode()))
 }
 
 // Download 用于下载一个 url 中的内容
 func Download(c *HttpConfig, url string) ([]byte, error) {
-	res, err := SafeGet(c, url)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-	return ioutil.ReadAll(res.Body)
+	return DownloadContext(context.Background(), c, url)
 }
 
 // Post 并返回 respose 的 body 的内容
@@ -172,19 +180,6 @@ func GetDocument(c *HttpConfig, url string) (*goquery.Document, error) {
 	return doc, nil
 }
 
-// 返回输入 url 的文件扩展名
-func getFileExtension(url string) (string, error) {
-	a := strings.Split(url, ".")
-	if len(a) <= 1 {
-		return "", fmt.Errorf("")
-	}
-	b := strings.Split(a[len(a)-1], "?")
-	if len(b[0]) > 5 {
-		return "", fmt.Errorf("")
-	}
-	return b[0], nil
-}
-
 var urlRule = regexp.MustCompile(`(https?|ftp|file)://[-A-Za-z0-9+&@#/%?=~_|!:,.;]+[-A-Za-z0-9+&@#/%=~_|]`)
 
 // 判断是否为一个合法的完整 url
@@ -197,218 +192,189 @@ func CalcMD5(x string) string {
 	return fmt.Sprintf("%x", h)
 }
 
-// 解析文档中的图片，下载后保存至 fileList 中。
-// c http实例，不需要可置nil; text: 待解析的文档; prefix: 文件系统路径前缀;
-// fileList: 文件表; url1,url2: 文档链接和域名链接，用于相对路径的处理，若不需要则置空
-// 返回替换图片链接后的文档
-func DownloadImage(c *HttpConfig, text string, prefix string, fileList map[string][]byte, url1 string, url2 string) (string, error) {
-	rule := regexp.MustCompile(`!\[.*?]\((.+?)\)`)
-	r2 := regexp.MustCompile(`\(.+?\)`)
-	text = rule.ReplaceAllStringFunc(text, func(x string) string {
-		match := r2.FindString(x)
-		match = match[1 : len(match)-1]
-		if len(match) > 1000 {
-			return x
-		}
-		matchBak := match
-		file, err := Download(c, match)
-		if err != nil {
-			if url1 != "" && match[0] != '/' {
-				match = url1 + match
-				file, err = Download(c, match)
-			} else if url2 != "" && match[0] == '/' {
-				match = url2 + match
-				file, err = Download(c, match)
-			}
-			if err != nil {
-				log.Printf("Problem %s : download image %s error", url1, matchBak)
-				return x
-			}
-		}
-		b64 := base64.URLEncoding.EncodeToString([]byte(match))
-		if len(b64) > 200 {
-			b64 = CalcMD5(b64)
-		}
-		path := ""
-		ex, err := getFileExtension(match)
-		if err == nil {
-			path = prefix + b64 + "." + ex
-		} else {
-			path = prefix + b64
-		}
-		fileList[path] = file
-		return r2.ReplaceAllString(x, "(/source/"+path+")")
-	})
-	rule = regexp.MustCompile(`<img[^>]+src\s*=\s*['"]([^'"]+)['"][^>]*>`)
-	r2 = regexp.MustCompile(`src\s*=\s*['"]([^'"]+)['"]`)
-	r3 := regexp.MustCompile(`['"]([^'"]+)['"]`)
-	text = rule.ReplaceAllStringFunc(text, func(x string) string {
-		//log.Println(x)
-		match2 := r2.FindString(x)
-		match := r3.FindString(match2)
-		match = match[1 : len(match)-1]
-		if len(match) > 1000 {
-			return x
-		}
-		matchBak := match
-		file, err := Download(c, match)
-		if err != nil {
-			if url1 != "" && match[0] != '/' {
-				match = url1 + match
-				file, err = Download(c, match)
-			} else if url2 != "" && match[0] == '/' {
-				match = url2 + match
-				file, err = Download(c, match)
-			}
-			if err != nil {
-				log.Printf("Problem %s : download image %s error", url1, matchBak)
-				return x
-			}
-		}
-		b64 := base64.URLEncoding.EncodeToString([]byte(match))
-		if len(b64) > 200 {
-			b64 = CalcMD5(b64)
-		}
-		path := ""
-		ex, err := getFileExtension(match)
-		if err == nil {
-			path = prefix + b64 + "." + ex
-		} else {
-			path = prefix + b64
-		}
-		fileList[path] = file
-		return r2.ReplaceAllString(x, r3.ReplaceAllString(match2, `"/source/`+path+`"`))
-	})
-	return text, nil
-}
-
 // 向文件表写入 problemlist
-func WriteProblemList(list ProblemList, fileList FileList, homePath string) error {
+func WriteProblemList(list ProblemList, fileList *FileList, homePath string) error {
 	b, err := json.Marshal(list)
 	if err != nil {
 		return err
 	}
-	fileList[homePath+"problemlist.json"] = b
+	fileList.Set(homePath+"problemlist.json", b)
 	return nil
 }
 
 // 向文件表写入 main.json
-func WriteMainJson(path string, p *ProblemListItem, fileList FileList) error {
+func WriteMainJson(path string, p *ProblemListItem, fileList *FileList) error {
 	b, err := json.Marshal(p.Data)
 	if err != nil {
 		return err
 	}
-	fileList[path] = b
+	fileList.Set(path, b)
 	return nil
 }
 
-// 向文件表写入文件
-func WriteFiles(pList ProblemList, fileList FileList, homePath string) error {
+// 向文件表写入题目列表、各题目的文件及资源索引，题目文件的写入方式见 WriteProblem
+func WriteFiles(pList ProblemList, fileList *FileList, homePath string) error {
 	err := WriteProblemList(pList, fileList, homePath)
 	if err != nil {
 		return err
 	}
-	for _, i := range pList {
-		if i.Data == nil {
+	for k := range pList {
+		if pList[k].Data == nil {
 			continue
 		}
-		nowPath := homePath + i.Pid + "/"
-		err = WriteMainJson(nowPath+"main.json", &i, fileList)
+		err = WriteProblem(&pList[k], fileList, homePath)
 		if err != nil {
 			log.Println(err)
-			continue
 		}
-		fileList[nowPath+"description.md"] = []byte(i.Data.Description)
+	}
+	return WriteAssetIndex(fileList, homePath)
+}
+
+// WriteProblem 向文件表写入一道题目的 main.json、题面与样例，写入前统一公式写法，并使用 DefaultSanitizer 清理题面
+func WriteProblem(i *ProblemListItem, fileList *FileList, homePath string) error {
+	nowPath := homePath + i.Pid + "/"
+	WriteSamples(i.Data, nowPath, fileList)
+	// OriginalDescription 总是 html，单独处理
+	normalize := NormalizeMath
+	if i.Data.DescriptionType != "markdown" {
+		normalize = NormalizeMathHTML
+	}
+	original := i.Data.OriginalDescription
+	i.Data.OriginalDescription = ""
+	_ = i.Data.RewriteText(func(x string) (string, error) {
+		return normalize(x), nil
+	})
+	if original != "" {
+		i.Data.OriginalDescription = NormalizeMathHTML(original)
+	}
+	if removed := DefaultSanitizer.SanitizeProblem(i.Data); len(removed) > 0 {
+		log.Printf("题目%s的题面中以下内容已被移除：%s", i.Pid, strings.Join(removed, ", "))
+	}
+	err := WriteMainJson(nowPath+"main.json", i, fileList)
+	if err != nil {
+		return err
+	}
+	fileList.Set(nowPath+"description.md", []byte(i.Data.Description))
+	if i.Data.OriginalDescription != "" {
+		fileList.Set(nowPath+"description.html", []byte(i.Data.OriginalDescription))
 	}
 	return nil
 }
 
-// 选定本次要更新的题目
-func ChooseUpdateProblem(newPList ProblemList, oldPList map[string]string, limit int) map[string]bool {
-	rand.Seed(time.Now().Unix())
-	if limit > len(newPList) {
-		limit = len(newPList)
+// 向文件表写入题库的资源索引，索引为空时不写入
+// 尚未提交的图片只有在 fileList 中时才写入索引，提交成功后需调用 CommitAssets
+func WriteAssetIndex(fileList *FileList, homePath string) error {
+	if index := GetAssetIndex(homePath).entries(fileList, homePath); len(index) > 0 {
+		// 逐行输出，便于在 git 中查看变化
+		b, err := json.MarshalIndent(index, "", "\t")
+		if err != nil {
+			return err
+		}
+		fileList.Set(homePath+AssetIndexFile, b)
 	}
-	res := make(map[string]bool)
-	if limit == 0 {
-		return res
+	return nil
+}
+
+// DownloadConfig 为 DownloadProblems 的设置
+type DownloadConfig struct {
+	// 同时爬取的题目数，不大于 0 时视为 1；并发时对同一域名的请求仍受 HttpConfig.Limits 的限制
+	Workers int
+	// 超过此时间未爬取的题目优先更新，不大于 0 时不限制；limit 不足以更新所有这样的题目时，先更新最久未爬取的
+	MaxInterval time.Duration
+	// 最近此时间内有变化的题目视为易变的题目，选择时其未爬取的时间按 VolatileFactor 倍计算
+	VolatileWindow time.Duration
+	VolatileFactor float64
+}
+
+var DefaultDownloadConfig = &DownloadConfig{Workers: 1, MaxInterval: 60 * 24 * time.Hour, VolatileWindow: 30 * 24 * time.Hour, VolatileFactor: 4}
+
+// 爬取新增、标题变化的题目及按 ChooseUpdateProblem 的规则选出的其他题目，直至达到 limit 道
+// getProblem 返回 ErrUnchanged 表示题目未变化，不会被视为错误；调用 getProblem 时 i 中已有上次爬取的记录，可用于比较 UpstreamHash
+// 爬取成功的题目会更新 Fetched 与 Hash，新增、标题变化及内容哈希变化的题目同时更新 Changed
+// dc 为 nil 时使用 DefaultDownloadConfig；Workers 大于 1 时 getProblem 会被并发调用，只能修改传入的题目，文件请写入 FileList
+func DownloadProblems(dc *DownloadConfig, newPList ProblemList, oldPList OldProblemList, limit int, getProblem func(*ProblemListItem) error) {
+	if dc == nil {
+		dc = DefaultDownloadConfig
 	}
-	cnt := 0
+	now := Now()
+	oldPList.CopyTo(newPList)
+	chosen := dc.choose(newPList, oldPList, limit, now)
+	tasks := make([]int, 0, len(chosen))
 	for k := range newPList {
-		i := &newPList[k]
-		if title, ok := oldPList[i.Pid]; !ok || title != i.Title {
-			cnt++
-			res[i.Pid] = true
+		if chosen[newPList[k].Pid] {
+			tasks = append(tasks, k)
 		}
 	}
-	for cnt < limit {
-		i := rand.Intn(len(newPList))
-		if _, ok := res[newPList[i].Pid]; ok {
-			continue
+	errs := dc.download(newPList, tasks, getProblem)
+	for _, k := range tasks {
+		if errs[k] == nil || errors.Is(errs[k], ErrUnchanged) {
+			oldPList.markFetched(&newPList[k], now)
 		}
-		cnt++
-		res[newPList[i].Pid] = true
 	}
-	return res
 }
 
-func DownloadProblems(newPList ProblemList, oldPList map[string]string, limit int, getProblem func(*ProblemListItem) error) {
-	rand.Seed(time.Now().Unix())
-	f := func(i *ProblemListItem) (err error) {
-		defer func() {
-			if perr := recover(); perr != nil {
-				log.Println("解析题目时产生异常：", perr)
-				i.Data = nil
-				err = perr.(error)
+// 按 dc.Workers 并发爬取 list 中下标为 tasks 的题目，返回各题目的错误，下标与 list 相同
+func (dc *DownloadConfig) download(list ProblemList, tasks []int, getProblem func(*ProblemListItem) error) []error {
+	workers := dc.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, len(list))
+	ch := make(chan int)
+	wg := sync.WaitGroup{}
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range ch {
+				errs[k] = downloadProblem(&list[k], getProblem)
 			}
 		}()
-		return getProblem(i)
-	}
-	if limit > len(newPList) {
-		limit = len(newPList)
-	}
-	if limit == 0 {
-		return
 	}
-	b := make([]bool, len(newPList))
-	for i := range b {
-		b[i] = true
+	for _, k := range tasks {
+		ch <- k
 	}
-	cnt := 0
-	for k := range newPList {
-		i := &newPList[k]
-		if title, ok := oldPList[i.Pid]; !ok || title != i.Title {
-			b[k] = false
-			cnt++
-			err := f(i)
-			if err != nil {
-				i.Data = nil
-				log.Printf("爬取题目%s时出现错误:%v", i.Pid, err)
+	close(ch)
+	wg.Wait()
+	return errs
+}
+
+// 爬取一道题目，出错或产生异常时将 i.Data 置为 nil 并记录错误
+// 出错时恢复 i.UpstreamHash，以免未归档的原始数据被当作已归档，下次被当作未变化而跳过
+func downloadProblem(i *ProblemListItem, getProblem func(*ProblemListItem) error) error {
+	upstreamHash := i.UpstreamHash
+	err := func() (err error) {
+		defer func() {
+			if perr := recover(); perr != nil {
+				log.Printf("解析题目%s时产生异常：%v", i.Pid, perr)
+				err = fmt.Errorf("%v", perr)
 			}
-		}
-	}
-	for cnt < limit {
-		i := rand.Intn(len(newPList))
-		if !b[i] {
-			continue
-		}
-		b[i] = false
-		cnt++
-		err := f(&newPList[i])
-		if err != nil {
-			newPList[i].Data = nil
-			log.Printf("爬取题目%s时出现错误:%v", newPList[i].Pid, err)
-		}
+		}()
+		return getProblem(i)
+	}()
+	if errors.Is(err, ErrUnchanged) {
+		// 题目未变化，无需更新
+		i.Data = nil
+	} else if err != nil {
+		i.Data = nil
+		i.UpstreamHash = upstreamHash
+		log.Printf("爬取题目%s时出现错误:%v", i.Pid, err)
 	}
+	return err
 }
 
-func InitPList(oldPList map[string]string, info *rpc.Info, client rpc.APIClient) error {
+// 从主服务读取已归档的题目列表及资源索引
+func InitPList(oldPList OldProblemList, info *rpc.Info, client rpc.APIClient) error {
 	req, err := client.GetProblemlist(context.Background(), info)
 	if err != nil {
 		return err
 	}
 	for _, i := range req.Data {
-		oldPList[i.Pid] = i.Title
+		oldPList[i.Pid] = OldProblem{Title: i.Title, Fetched: i.Fetched, Changed: i.Changed, Hash: i.Hash, Updated: i.Updated, UpstreamHash: i.UpstreamHash}
+	}
+	err = loadAssetIndex(info, client)
+	if err != nil {
+		log.Printf("读取题库%s的资源索引时出现错误:%v", info.Id, err)
 	}
 	return nil
 }
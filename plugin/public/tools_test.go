@@ -0,0 +1,118 @@
+package public
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadProblemsWorkers(t *testing.T) {
+	list := make(ProblemList, 20)
+	for k := range list {
+		list[k] = ProblemListItem{Pid: strconv.Itoa(k), Title: "t"}
+	}
+	fileList := NewFileList()
+	mu := sync.Mutex{}
+	running, maxRunning, calls := 0, 0, 0
+	DownloadProblems(&DownloadConfig{Workers: 4}, list, OldProblemList{}, len(list), func(i *ProblemListItem) error {
+		mu.Lock()
+		calls++
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+		i.Data = &Problem{Title: i.Title}
+		switch i.Pid {
+		case "3":
+			panic("bad page")
+		case "5":
+			return errors.New("bad problem")
+		}
+		fileList.Set(i.Pid+"/main.json", []byte(i.Pid))
+		return nil
+	})
+	if calls != len(list) {
+		t.Errorf("getProblem is called %d times, want %d", calls, len(list))
+	}
+	if maxRunning < 2 || maxRunning > 4 {
+		t.Errorf("%d problems are fetched at the same time, want 2~4", maxRunning)
+	}
+	for _, i := range list {
+		if failed := i.Pid == "3" || i.Pid == "5"; failed != (i.Data == nil) {
+			t.Errorf("problem %s: Data = %+v", i.Pid, i.Data)
+		}
+	}
+	if fileList.Len() != len(list)-2 {
+		t.Errorf("got %d files, want %d", fileList.Len(), len(list)-2)
+	}
+}
+
+func TestDownloadProblemsLimit(t *testing.T) {
+	list := ProblemList{{Pid: "1", Title: "a"}, {Pid: "2", Title: "b"}, {Pid: "3", Title: "c"}, {Pid: "4", Title: "d"}}
+	old := OldProblemList{"1": {Title: "a"}, "2": {Title: "x"}, "3": {Title: "c"}, "4": {Title: "d"}}
+	DownloadProblems(nil, list, old, 2, func(i *ProblemListItem) error {
+		i.Data = &Problem{}
+		return nil
+	})
+	cnt := 0
+	for _, i := range list {
+		if i.Data != nil {
+			cnt++
+		}
+	}
+	if list[1].Data == nil || cnt != 2 {
+		t.Errorf("changed problem should be fetched first, and %d problems are fetched: %+v", cnt, list)
+	}
+}
+
+func TestFileList(t *testing.T) {
+	l := NewFileList()
+	wg := sync.WaitGroup{}
+	for k := 0; k < 10; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			l.Set(strconv.Itoa(k), []byte{byte(k)})
+		}(k)
+	}
+	wg.Wait()
+	files := l.Files()
+	if len(files) != 10 || l.Len() != 10 {
+		t.Fatalf("got %d files, want 10", len(files))
+	}
+	delete(files, "1")
+	if b, ok := l.Get("1"); !ok || len(b) != 1 || b[0] != 1 {
+		t.Errorf("Files should return a copy: %v %v", b, ok)
+	}
+}
+
+func TestWriteProblemMath(t *testing.T) {
+	files := NewFileList()
+	i := &ProblemListItem{Pid: "1", Title: "a", Data: &Problem{
+		DescriptionType:     "html",
+		Description:         `<p><script type="math/tex">a<b</script></p>`,
+		OriginalDescription: `<p><script type="math/tex">a<b</script></p>`,
+	}}
+	if err := WriteProblem(i, files, "oj/"); err != nil {
+		t.Fatal(err)
+	}
+	if i.Data.Description != "<p>$a&lt;b$</p>" || i.Data.OriginalDescription != "<p>$a&lt;b$</p>" {
+		t.Errorf("html math is not escaped: %q, %q", i.Data.Description, i.Data.OriginalDescription)
+	}
+	i.Data = &Problem{DescriptionType: "markdown", Description: "<script type=\"math/tex\">a<b</script>"}
+	if err := WriteProblem(i, files, "oj/"); err != nil {
+		t.Fatal(err)
+	}
+	if i.Data.Description != "$a<b$" {
+		t.Errorf("markdown math = %q, want $a<b$", i.Data.Description)
+	}
+}
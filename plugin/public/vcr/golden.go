@@ -0,0 +1,99 @@
+package vcr
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// CheckGolden 比较插件生成的文件与目录 dir 中的预期结果，dir 中的文件路径与 files 的 key 一一对应
+// 录制模式下或设置了环境变量 VCR_GOLDEN=update 时用 files 重写 dir，用于修改夹具或插件之后
+func CheckGolden(t testing.TB, dir string, files map[string][]byte) {
+	t.Helper()
+	if ModeFromEnv() == Record || os.Getenv("VCR_GOLDEN") == "update" {
+		if err := writeGolden(dir, files); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		want[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(files)+len(want))
+	for k := range files {
+		names = append(names, k)
+	}
+	for k := range want {
+		if _, ok := files[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		got, ok1 := files[k]
+		w, ok2 := want[k]
+		switch {
+		case !ok2:
+			t.Errorf("unexpected file %s", k)
+		case !ok1:
+			t.Errorf("missing file %s", k)
+		case !bytes.Equal(got, w):
+			t.Errorf("file %s differs: %s", k, firstDiff(string(got), string(w)))
+		}
+	}
+}
+
+// 返回两段文本第一处不同的行
+func firstDiff(got string, want string) string {
+	a, b := strings.Split(got, "\n"), strings.Split(want, "\n")
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y string
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y || i >= len(a) || i >= len(b) {
+			return fmt.Sprintf("line %d: got %q, want %q", i+1, x, y)
+		}
+	}
+	return ""
+}
+
+func writeGolden(dir string, files map[string][]byte) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for k, v := range files {
+		path := filepath.Join(dir, filepath.FromSlash(k))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, v, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package vcr 录制与回放 http 请求，使插件可以在不访问真实题库的情况下测试
+//
+// 每个请求与其响应保存为夹具目录下的一个 .json 文件；回放时按请求方法、链接与请求体匹配，
+// 未录制的请求返回错误。设置环境变量 VCR_MODE=record 时访问真实网站并重新录制，
+// 设置 VCR_GOLDEN=update 时只根据已有夹具重新生成 CheckGolden 的预期结果。
+package vcr
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type Mode int
+
+const (
+	// Replay 只使用已录制的夹具
+	Replay Mode = iota
+	// Record 发出真实请求，并将结果写入夹具目录
+	Record
+)
+
+// ModeFromEnv 根据环境变量 VCR_MODE 返回模式，未设置时为 Replay
+func ModeFromEnv() Mode {
+	if os.Getenv("VCR_MODE") == "record" {
+		return Record
+	}
+	return Replay
+}
+
+type Request struct {
+	Method string `json:"method"`
+	Url    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	// 响应体依次取 Body、BodyBase64 或 BodyFile 中非空的一项
+	Body       string `json:"body,omitempty"`
+	BodyBase64 string `json:"body_base64,omitempty"`
+	// 相对于夹具目录的文件路径，便于手工编写较大的网页；不能以 .json 结尾
+	BodyFile string `json:"body_file,omitempty"`
+}
+
+// Interaction 为一次录制的请求与响应
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// 录制时不保存的响应头
+var skipHeaders = []string{"Date", "Set-Cookie"}
+
+// Recorder 是录制或回放请求的 http.RoundTripper
+type Recorder struct {
+	Dir  string
+	Mode Mode
+	// 录制时实际发出请求所用的 Transport，为 nil 时使用 http.DefaultTransport
+	Transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions map[string]*Interaction
+}
+
+// New 创建使用夹具目录 dir 的 Recorder，回放模式下会读取目录中的所有夹具
+func New(dir string, mode Mode) (*Recorder, error) {
+	r := &Recorder{Dir: dir, Mode: mode, interactions: make(map[string]*Interaction)}
+	if mode == Record {
+		return r, nil
+	}
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		i := &Interaction{}
+		if err := json.Unmarshal(b, i); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		r.interactions[key(i.Request.Method, i.Request.Url, i.Request.Body)] = i
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Client 返回使用 r 发出请求的 http.Client
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func key(method string, url string, body string) string {
+	return method + " " + url + "\n" + body
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	k := key(req.Method, req.URL.String(), string(body))
+	if r.Mode == Record {
+		return r.record(req, k, body)
+	}
+	r.mu.Lock()
+	i, ok := r.interactions[k]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("vcr: no fixture for %s %s", req.Method, req.URL.String())
+	}
+	return r.response(req, i)
+}
+
+// 根据夹具构造响应
+func (r *Recorder) response(req *http.Request, i *Interaction) (*http.Response, error) {
+	var b []byte
+	switch {
+	case i.Response.Body != "":
+		b = []byte(i.Response.Body)
+	case i.Response.BodyBase64 != "":
+		var err error
+		b, err = base64.StdEncoding.DecodeString(i.Response.BodyBase64)
+		if err != nil {
+			return nil, err
+		}
+	case i.Response.BodyFile != "":
+		var err error
+		b, err = ioutil.ReadFile(filepath.Join(r.Dir, filepath.FromSlash(i.Response.BodyFile)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	status := i.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := http.Header{}
+	for k, v := range i.Response.Header {
+		header[http.CanonicalHeaderKey(k)] = v
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// 发出真实请求并保存为夹具，文件名由域名、路径与请求的哈希组成
+func (r *Recorder) record(req *http.Request, k string, body []byte) (*http.Response, error) {
+	t := r.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	res, err := t.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	i := &Interaction{
+		Request:  Request{Method: req.Method, Url: req.URL.String(), Body: string(body)},
+		Response: Response{Status: res.StatusCode, Header: res.Header.Clone()},
+	}
+	for _, h := range skipHeaders {
+		i.Response.Header.Del(h)
+	}
+	if utf8.Valid(b) {
+		i.Response.Body = string(b)
+	} else {
+		i.Response.BodyBase64 = base64.StdEncoding.EncodeToString(b)
+	}
+	h := md5.Sum([]byte(k))
+	name := strings.Trim(unsafeName.ReplaceAllString(strings.ToLower(req.URL.Path), "_"), "_")
+	if len(name) > 60 {
+		name = name[:60]
+	}
+	if name != "" {
+		name += "-"
+	}
+	path := filepath.Join(r.Dir, unsafeName.ReplaceAllString(req.URL.Host, "_"), name+hex.EncodeToString(h[:])[:8]+".json")
+	out, err := json.MarshalIndent(i, "", "\t")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, append(out, '\n'), 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.interactions[k] = i
+	r.mu.Unlock()
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	res.ContentLength = int64(len(b))
+	return res, nil
+}
@@ -0,0 +1,88 @@
+package vcr
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vcr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Set-Cookie", "session=secret")
+		if r.URL.Path == "/png" {
+			_, _ = w.Write([]byte{0x89, 'P', 'N', 'G', 0xff})
+			return
+		}
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(b)))
+	}))
+
+	rec, err := New(dir, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(c *http.Client, method string, path string, body string) string {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(res.Body)
+		if c.Transport.(*Recorder).Mode == Replay && res.Header.Get("Set-Cookie") != "" {
+			t.Errorf("%s %s: Set-Cookie replayed", method, path)
+		}
+		return string(b)
+	}
+	c := rec.Client()
+	get(c, "GET", "/a", "")
+	get(c, "POST", "/a", "x=1")
+	get(c, "POST", "/a", "x=2")
+	get(c, "GET", "/png", "")
+	server.Close()
+
+	rep, err := New(dir, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = rep.Client()
+	for _, i := range []struct{ method, path, body, want string }{
+		{"GET", "/a", "", "GET /a "},
+		{"POST", "/a", "x=1", "POST /a x=1"},
+		{"POST", "/a", "x=2", "POST /a x=2"},
+		{"GET", "/png", "", "\x89PNG\xff"},
+	} {
+		if got := get(c, i.method, i.path, i.body); got != i.want {
+			t.Errorf("%s %s %q = %q, want %q", i.method, i.path, i.body, got, i.want)
+		}
+	}
+	if _, err := c.Get(server.URL + "/b"); err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("unrecorded request: got %v", err)
+	}
+}
+
+func TestBodyFile(t *testing.T) {
+	rep, err := New("testdata", Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rep.Client().Get("https://example.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != 200 || res.Header.Get("Content-Type") != "text/html" || string(b) != "<p>hello</p>\n" {
+		t.Errorf("got %d %q %q", res.StatusCode, res.Header.Get("Content-Type"), b)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"crawler/rpc"
 	"encoding/json"
 	"fmt"
-	"google.golang.org/grpc"
 	"io/ioutil"
 	"log"
 	"strconv"
@@ -36,10 +35,12 @@ type SYZOJ struct {
 	client    rpc.APIClient
 	homeUrl   string
 	homePath  string
-	fileList  FileList
-	oldPList  map[string]string
+	fileList  *FileList
+	oldPList  OldProblemList
 	debugMode bool
-	conn      *grpc.ClientConn
+	closeConn func() error
+	// 发出请求所用的设置，代理与缓存在 Start 中设置
+	http *HttpConfig
 }
 
 func (c *SYZOJ) Start(info *rpc.Info, hu string) error {
@@ -47,16 +48,22 @@ func (c *SYZOJ) Start(info *rpc.Info, hu string) error {
 	c.homeUrl = hu
 	c.homePath = c.info.Id + "/"
 	var err error
-	c.conn, err = grpc.Dial("127.0.0.1:27381", grpc.WithInsecure())
+	c.client, c.closeConn, err = Connect()
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	c.client = rpc.NewAPIClient(c.conn)
-	c.oldPList = make(map[string]string)
+	c.oldPList = make(OldProblemList)
 	err = InitPList(c.oldPList, c.info, c.client)
 	if err != nil {
 		return err
 	}
+	c.http = &HttpConfig{SleepTime: DefaultHttpConfig.SleepTime}
+	c.http.Proxy, err = LoadProxyConfig(c.info.Id)
+	if err != nil {
+		return err
+	}
+	// export 未变化时服务器返回 304，使用缓存的内容，其 UpstreamHash 与上次归档时相同则跳过该题目
+	c.http.Cache = NewDiskCache(CacheDir + c.info.Id)
 	log.Printf("%s crawler started", c.info.Name)
 	r, err := c.client.Register(context.Background(), &rpc.RegisterRequest{Info: info})
 	if err != nil {
@@ -67,18 +74,43 @@ func (c *SYZOJ) Start(info *rpc.Info, hu string) error {
 	return nil
 }
 
-/* 执行一次题库爬取
+/* 执行一次题库爬取并提交
  * limit: 一次最多爬取题目数
  */
 func (c *SYZOJ) Update(limit int) error {
+	fileList, err := c.Crawl(limit)
+	if err != nil {
+		return err
+	}
+	if BackfillMode {
+		log.Println("Backfill finished")
+		return nil
+	}
+	r, err := c.client.Update(context.Background(), &rpc.UpdateRequest{Info: c.info, File: fileList})
+	if err != nil {
+		log.Printf("Submit update failed: %v", err)
+		return err
+	}
+	if !r.Ok {
+		log.Println("Submit update failed")
+		return err
+	}
+	CommitAssets(c.homePath, fileList)
+	log.Println("Submit update successfully")
+	return nil
+}
+
+// Crawl 执行一次题库爬取，返回需要提交的文件，不与主服务通信
+// 全量回填模式下由 Backfill 分批提交，不返回文件
+func (c *SYZOJ) Crawl(limit int) (map[string][]byte, error) {
 	if c.debugMode {
 		limit = 5
 	}
 	log.Printf("Updating %s", c.info.Name)
-	c.fileList = make(map[string][]byte)
-	problemPage, err := GetDocument(nil, c.homeUrl+"/problems")
+	c.fileList = NewFileList()
+	problemPage, err := GetDocument(c.http, c.homeUrl+"/problems")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	list := problemPage.Find(".ui.pagination.menu")
 	maxPage := 0
@@ -93,16 +125,16 @@ func (c *SYZOJ) Update(limit int) error {
 		}
 	}
 	if maxPage <= 0 || maxPage >= 500 {
-		return fmt.Errorf("maxPage error: %d", maxPage)
+		return nil, fmt.Errorf("maxPage error: %d", maxPage)
 	}
 	if c.debugMode {
 		maxPage = 2
 	}
 	newPList := make([]ProblemListItem, 0)
 	for i := 1; i <= maxPage; i++ {
-		problemListPage, err := GetDocument(nil, fmt.Sprintf("%s/problems?page=%d", c.homeUrl, i))
+		problemListPage, err := GetDocument(c.http, fmt.Sprintf("%s/problems?page=%d", c.homeUrl, i))
 		if err != nil {
-			return err
+			return nil, err
 		}
 		list := problemListPage.Find(`[style^=vertical-align]`)
 		for j := range list.Nodes {
@@ -119,30 +151,20 @@ func (c *SYZOJ) Update(limit int) error {
 		}
 	}
 	log.Println(len(newPList))
-	DownloadProblems(newPList, c.oldPList, limit, c.getProblem)
-	err = WriteFiles(newPList, c.fileList, c.homePath)
-	if err != nil {
-		return err
-	}
-	c.oldPList = make(map[string]string)
-	for _, i := range newPList {
-		c.oldPList[i.Pid] = i.Title
+	if BackfillMode {
+		return nil, NewBackfill(c.info, c.client).Run(c.fileList, newPList, c.oldPList, c.getProblem)
 	}
-	r, err := c.client.Update(context.Background(), &rpc.UpdateRequest{Info: c.info, File: c.fileList})
+	DownloadProblems(nil, newPList, c.oldPList, limit, c.getProblem)
+	err = WriteFiles(newPList, c.fileList, c.homePath)
 	if err != nil {
-		log.Printf("Submit update failed: %v", err)
-		return err
+		return nil, err
 	}
-	if !r.Ok {
-		log.Println("Submit update failed")
-		return err
-	}
-	log.Println("Submit update successfully")
-	return nil
+	c.oldPList = NewOldProblemList(newPList)
+	return c.fileList.Files(), nil
 }
 
 func (c *SYZOJ) Stop() {
-	c.conn.Close()
+	c.closeConn()
 	log.Println(c.info.Name + " crawler stopped")
 }
 
@@ -151,15 +173,15 @@ func (c *SYZOJ) getProblem(i *ProblemListItem) error {
 		log.Println("start getting problem ", i.Pid)
 	}
 	i.Data = nil
-	res, err := SafeGet(nil, fmt.Sprintf("%s/problem/%s/export", c.homeUrl, i.Pid))
+	res, err := SafeGet(c.http, fmt.Sprintf("%s/problem/%s/export", c.homeUrl, i.Pid))
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 	b, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return err
 	}
-	res.Body.Close()
 	data := &syzojExportProblem{}
 	err = json.Unmarshal(b, data)
 	if err != nil {
@@ -168,6 +190,12 @@ func (c *SYZOJ) getProblem(i *ProblemListItem) error {
 	if !data.Success {
 		return err
 	}
+	// export 返回的字段未变化时不再重新生成题面、下载图片
+	h := UpstreamHash(data.Obj)
+	if h == i.UpstreamHash {
+		return ErrUnchanged
+	}
+	i.UpstreamHash = h
 	i.Data = &Problem{}
 	i.Data.DescriptionType = "markdown"
 	i.Data.Title = i.Title
@@ -188,32 +216,27 @@ func (c *SYZOJ) getProblem(i *ProblemListItem) error {
 			break
 		}
 	}
-	i.Data.Description = fmt.Sprintf(
-		`
-# 题目描述
-
-%s
-
-# 输入格式
-
-%s
-
-# 输出格式
-
-%s
-
-# 样例
-
-%s
-
-# 数据范围与提示
-
-%s
-
-`, data.Obj.Description, data.Obj.InputFormat, data.Obj.OutputFormat, data.Obj.Example, data.Obj.LimitAndHint)
-	t, err := DownloadImage(nil, i.Data.Description, c.homePath+i.Pid+"/img/", c.fileList, c.homeUrl+"/problem/"+i.Pid+"/", c.homeUrl)
-	if err == nil {
-		i.Data.Description = t
+	i.Data.Samples = ExtractSamples("# 样例\n\n" + data.Obj.Example)
+	NewStatementBuilder().
+		Add(SectionDescription, data.Obj.Description).
+		Add(SectionInput, data.Obj.InputFormat).
+		Add(SectionOutput, data.Obj.OutputFormat).
+		Add(SectionSamples, data.Obj.Example).
+		Add(SectionHint, data.Obj.LimitAndHint).
+		Build(i.Data)
+	err = DownloadProblemImage(c.http, i.Data, c.homePath, c.fileList, c.homeUrl+"/problem/"+i.Pid+"/", c.homeUrl)
+	if err != nil {
+		log.Printf("下载题目%s的图片时出现错误:%v", i.Pid, err)
+	}
+	err = DownloadAttachments(c.http, nil, i.Data, c.homePath+i.Pid+"/files/", c.fileList, c.homeUrl+"/problem/"+i.Pid+"/", c.homeUrl)
+	if err != nil {
+		log.Printf("下载题目%s的附件时出现错误:%v", i.Pid, err)
+	}
+	if data.Obj.HaveAdditionalFile {
+		_, err = DownloadAttachment(c.http, nil, i.Data, c.homePath+i.Pid+"/files/", c.fileList, c.homeUrl+"/problem/"+i.Pid+"/download/additional_file")
+		if err != nil {
+			log.Printf("下载题目%s的附加文件时出现错误:%v", i.Pid, err)
+		}
 	}
 	return nil
 }
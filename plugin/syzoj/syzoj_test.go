@@ -0,0 +1,178 @@
+package syzoj
+
+import (
+	. "crawler/plugin/public"
+	"crawler/plugin/public/fakeoj"
+	"crawler/plugin/public/testserver"
+	"crawler/plugin/public/vcr"
+	"crawler/rpc"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 将磁盘缓存放在临时目录中
+func useTempCache(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := CacheDir
+	CacheDir = dir + "/"
+	return func() {
+		CacheDir = old
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func useFixtures(t *testing.T) func() {
+	rec, err := vcr.New("testdata/fixtures", vcr.ModeFromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefaultHttpConfig.Client = rec.Client()
+	// 固定爬取时间，使 problemlist.json 中的 fetched 与 golden 一致
+	Now = func() time.Time { return time.Unix(1600000000, 0) }
+	restore := useTempCache(t)
+	return func() {
+		DefaultHttpConfig.Client, Now = nil, time.Now
+		restore()
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	defer useFixtures(t)()
+	c := &SYZOJ{info: &rpc.Info{Id: "loj", Name: "LibreOJ"}, homeUrl: "https://loj.ac", homePath: "loj/", oldPList: make(OldProblemList)}
+	files, err := c.Crawl(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcr.CheckGolden(t, "testdata/golden", files)
+
+	// export 的内容未变化，第二次爬取时不再生成题面
+	files, err = c.Crawl(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range files {
+		if strings.HasSuffix(k, "/main.json") {
+			t.Errorf("unchanged problem is submitted again: %s", k)
+		}
+	}
+}
+
+func TestStartUpdate(t *testing.T) {
+	defer useFixtures(t)()
+	s := testserver.New()
+	s.SetProblemlist("loj", ProblemList{{Pid: "1", Title: "A + B Problem"}})
+	defer s.Use()()
+	c := &SYZOJ{}
+	if err := c.Start(&rpc.Info{Id: "loj", Name: "LibreOJ"}, "https://loj.ac"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(200); err != nil {
+		t.Fatal(err)
+	}
+	c.Stop()
+
+	s.AssertSubmitted(t, "loj/problemlist.json", "loj/1/main.json", "loj/2/main.json", "loj/2/files/checker.zip")
+	if p := s.MainJson(t, "loj", "2"); p.Judge != "传统 Special Judge" || len(p.Attachments) != 1 {
+		t.Errorf("loj/2/main.json = %+v", p)
+	}
+}
+
+func TestFakeOJ(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	problems := []fakeoj.Problem{
+		{Id: "1", Title: "A + B Problem", Description: "输入 $a, b$，输出 $a + b$。", Samples: []fakeoj.Sample{{Input: "1 2", Output: "3"}}, TimeLimit: 1000, MemoryLimit: 256},
+		{Id: "2", Title: "Quine", Description: "输出自身。", SpecialJudge: true, AdditionalFile: []byte("checker")},
+		{Id: "3", Title: "损坏的题目"},
+		{Id: "4", Title: "出错的题目"},
+	}
+	for _, i := range []struct {
+		name         string
+		setup        func(f *fakeoj.Server)
+		err          bool
+		submitted    []string
+		notSubmitted []string
+	}{
+		{
+			name: "problem errors",
+			setup: func(f *fakeoj.Server) {
+				f.Broken["/problem/3/export"] = true
+				f.Errors["/problem/4/export"] = 500
+			},
+			submitted:    []string{"fake/problemlist.json", "fake/1/main.json", "fake/1/samples/1.in", "fake/2/main.json", "fake/2/files/2.zip"},
+			notSubmitted: []string{"fake/3/main.json", "fake/4/main.json"},
+		},
+		{name: "maxPage too large", setup: func(f *fakeoj.Server) { f.MaxPage = 500 }, err: true},
+		{name: "broken pagination", setup: func(f *fakeoj.Server) { f.Broken["/problems"] = true }, err: true},
+		{name: "list page error", setup: func(f *fakeoj.Server) { f.Errors["/problems?page=2"] = 503 }, err: true},
+	} {
+		t.Run(i.name, func(t *testing.T) {
+			defer useTempCache(t)()
+			f := fakeoj.NewSYZOJ(problems...)
+			defer f.Close()
+			f.PerPage = 2
+			i.setup(f)
+			s := testserver.New()
+			defer s.Use()()
+			c := &SYZOJ{}
+			if err := c.Start(&rpc.Info{Id: "fake", Name: "Fake"}, f.URL); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Stop()
+			err := c.Update(200)
+			if i.err {
+				if err == nil || len(s.Updates()) != 0 {
+					t.Errorf("Update = %v with %d submissions, want error", err, len(s.Updates()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.AssertSubmitted(t, i.submitted...)
+			s.AssertNotSubmitted(t, i.notSubmitted...)
+			list, _ := s.File("fake/problemlist.json")
+			if pl := (ProblemList{}); json.Unmarshal(list, &pl) != nil || len(pl) != len(problems) {
+				t.Errorf("problemlist.json = %s", list)
+			}
+			if p := s.MainJson(t, "fake", "2"); p.Judge != "传统 Special Judge" {
+				t.Errorf("fake/2 judge = %q", p.Judge)
+			}
+		})
+	}
+}
+
+// export 未变化时服务器返回 304，已归档的题目不再重新生成
+func TestCache(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	defer useTempCache(t)()
+	f := fakeoj.NewSYZOJ(fakeoj.Problem{Id: "1", Title: "A + B Problem", Description: "输入 $a, b$，输出 $a + b$。", TimeLimit: 1000, MemoryLimit: 256})
+	defer f.Close()
+	f.ETag = true
+	s := testserver.New()
+	defer s.Use()()
+	c := &SYZOJ{}
+	if err := c.Start(&rpc.Info{Id: "fake", Name: "Fake"}, f.URL); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	if err := c.Update(200); err != nil {
+		t.Fatal(err)
+	}
+	s.AssertSubmitted(t, "fake/1/main.json")
+	if err := c.Update(200); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Updates()); n != 2 || f.NotModified() != 1 {
+		t.Fatalf("got %d updates and %d not modified responses, want 2 and 1", n, f.NotModified())
+	}
+	if _, ok := s.Updates()[1].File["fake/1/main.json"]; ok {
+		t.Error("unchanged problem is submitted again")
+	}
+}
@@ -1,134 +1,234 @@
 // 由于 Tsinsen 将(或已经)于 2019.9,1 关闭，本爬虫为一次性爬虫。
+// 爬取进度保存在 ./checkpoint/tsinsen.json 中，中断后重新运行会从中断处继续，并重试失败的题目。
 
 package main
 
 import (
+	"context"
 	. "crawler/plugin/public"
+	"crawler/rpc"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
 	"log"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
-var logger *log.Logger
+var client rpc.APIClient
 
-const homePath = "tsinsen/"
+const PID = "tsinsen"
+const NAME = "Tsinsen"
+const homePath = PID + "/"
 
-var fileList map[string][]byte
+// 题库的网址，测试时可替换为测试服务器的地址
+var baseUrl = "http://www.tsinsen.com"
 
-func Name() string {
-	return "Tsinsen"
-}
+// 要爬取的题号范围，即 A1000 至 A1518
+var firstPid, lastPid = 1000, 1518
+
+var checkpointPath = "./checkpoint/tsinsen.json"
+
+// 每爬取 batchSize 道题目向主服务提交一次
+var batchSize = 50
+
+var info *rpc.Info
+
+// 本组件发出请求所用的设置，代理设置在 Start 中读取
+var httpConfig = &HttpConfig{SleepTime: DefaultHttpConfig.SleepTime}
+var oldPList OldProblemList
 
-func Start(logg *log.Logger) error {
-	logger = logg
-	logger.Println("Tsinsen crawler started")
+func Start() error {
+	oldPList = make(OldProblemList)
+	err := InitPList(oldPList, info, client)
+	if err != nil {
+		return err
+	}
+	httpConfig.Proxy, err = LoadProxyConfig(info.Id)
+	if err != nil {
+		return err
+	}
+	log.Println("Tsinsen crawler started")
 	return nil
 }
 
-func Update(limit int) (FileList, error) {
-	logger.Println("Updating Tsinsen")
-	fileList = make(FileList)
-	pl := make(ProblemList, 0)
-	for i := 1000; i <= 1518; i++ {
-		p := ProblemListItem{}
-		p.Data = &Problem{}
-		p.Pid = "A" + strconv.Itoa(i)
-		p.Data.Url = "http://www.tsinsen.com/" + p.Pid
-		log.Println("start getting problem " + p.Pid)
-		page, err := GetDocument(nil, p.Data.Url)
-		if err != nil {
-			log.Panicln(err)
-		}
-		p.Title = page.Find(`#ptit`).Nodes[0].FirstChild.Data
-		p.Title = p.Title[7:len(p.Title)]
-		p.Data.Title = p.Title
-		t := page.Find(`#pres > div:nth-child(1) > span:nth-child(1)`).Nodes[0].FirstChild.Data
-		t2 := page.Find(`#pres > div:nth-child(1) > span:nth-child(2)`).Nodes[0].FirstChild.Data
-		log.Println(p.Title, t, t2)
-		p.Data.Time, err = strconv.Atoi(strings.Split(t, ".")[0])
-		if err != nil {
-			x := 0
-			for _, i := range t {
-				if i < int32('0') || i > int32('9') {
-					break
-				}
-				x = x*10 + int(i) - int('0')
-			}
-			p.Data.Time = x
-		}
-		if !strings.Contains(t, "ms") {
-			p.Data.Time *= 1000
-		}
-		p.Data.Memory, err = strconv.Atoi(strings.Split(t2, ".")[0])
-		if err != nil {
-			x := 0
-			for _, i := range t {
-				if i < int32('0') || i > int32('9') {
-					break
-				}
-				x = x*10 + int(i) - int('0')
-			}
-			p.Data.Memory = x
+// 返回 page 中第一个匹配 selector 的元素的第一个子节点的文本
+func firstText(page *goquery.Document, selector string) (string, error) {
+	t := page.Find(selector).Nodes
+	if len(t) == 0 || t[0].FirstChild == nil {
+		return "", fmt.Errorf("%s not found", selector)
+	}
+	return t[0].FirstChild.Data, nil
+}
+
+// 解析 "1.5s"、"256MB" 等限制的整数部分
+func parseLimit(x string) int {
+	res := 0
+	for _, i := range x {
+		if i < '0' || i > '9' {
+			break
 		}
-		if strings.Contains(t, "GB") {
-			p.Data.Memory *= 1024
+		res = res*10 + int(i-'0')
+	}
+	return res
+}
+
+func getProblem(p *ProblemListItem, fileList *FileList) error {
+	p.Data = &Problem{}
+	p.Data.Url = baseUrl + "/" + p.Pid
+	page, err := GetDocument(httpConfig, p.Data.Url)
+	if err != nil {
+		return err
+	}
+	title, err := firstText(page, `#ptit`)
+	if err != nil {
+		return err
+	}
+	if len(title) <= 7 {
+		return fmt.Errorf("invalid title: %s", title)
+	}
+	p.Title = title[7:]
+	p.Data.Title = p.Title
+	t, err := firstText(page, `#pres > div:nth-child(1) > span:nth-child(1)`)
+	if err != nil {
+		return err
+	}
+	t2, err := firstText(page, `#pres > div:nth-child(1) > span:nth-child(2)`)
+	if err != nil {
+		return err
+	}
+	p.Data.Time, err = strconv.Atoi(strings.Split(t, ".")[0])
+	if err != nil {
+		p.Data.Time = parseLimit(t)
+	}
+	if !strings.Contains(t, "ms") {
+		p.Data.Time *= 1000
+	}
+	p.Data.Memory, err = strconv.Atoi(strings.Split(t2, ".")[0])
+	if err != nil {
+		p.Data.Memory = parseLimit(t2)
+	}
+	if strings.Contains(t2, "GB") {
+		p.Data.Memory *= 1024
+	}
+	p.Data.Judge = ""
+	p.Data.DescriptionType = "html"
+	content := page.Find(`#pcont1`).Nodes
+	if len(content) == 0 {
+		return errors.New("#pcont1 not found")
+	}
+	html := NodeChildren2html(content[0])
+	rule := regexp.MustCompile(`<div class="pdsec">(.+?)</div>`)
+	cnt := 0
+	html = rule.ReplaceAllStringFunc(html, func(x string) string {
+		cnt++
+		match := rule.FindStringSubmatch(x)[1]
+		return "\n# " + match + "\n\n"
+	})
+	if cnt == 0 {
+		html2 := ""
+		if t5 := page.Find(`#pcont2`).Nodes; len(t5) > 0 {
+			html2 = NodeChildren2html(t5[0])
 		}
-		p.Data.Judge = ""
-		p.Data.DescriptionType = "html"
-		t3 := page.Find(`#pcont1`).Nodes[0]
-		html := NodeChildren2html(t3)
-		rule := regexp.MustCompile(`<div class="pdsec">(.+?)</div>`)
-		cnt := 0
-		html = rule.ReplaceAllStringFunc(html, func(x string) string {
+		rule := regexp.MustCompile(`<p class="subtitle">(.+)</p>`)
+		html2 = rule.ReplaceAllStringFunc(html2, func(x string) string {
+			cnt++
+			match := rule.FindStringSubmatch(x)[1]
+			return "# " + match + "\n\n"
+		})
+		rule = regexp.MustCompile(`<[pb]>【(.+)】</[pb]>`)
+		html2 = rule.ReplaceAllStringFunc(html2, func(x string) string {
 			cnt++
 			match := rule.FindStringSubmatch(x)[1]
-			return "\n# " + match + "\n\n"
+			return "# " + match + "\n\n"
 		})
-		if cnt == 0 {
-			log.Println("Warning!")
-			t5 := page.Find(`#pcont2`).Nodes[0]
-			html2 := NodeChildren2html(t5)
-			rule := regexp.MustCompile(`<p class="subtitle">(.+)</p>`)
-			cnt := 0
-			html2 = rule.ReplaceAllStringFunc(html2, func(x string) string {
-				cnt++
-				match := rule.FindStringSubmatch(x)[1]
-				return "# " + match + "\n\n"
-			})
-			rule = regexp.MustCompile(`<[pb]>【(.+)】</[pb]>`)
-			html2 = rule.ReplaceAllStringFunc(html2, func(x string) string {
-				cnt++
-				match := rule.FindStringSubmatch(x)[1]
-				return "# " + match + "\n\n"
-			})
-			if cnt <= 0 || cnt >= 15 {
-				log.Println("Error! cnt=", cnt)
-				html = "# 题面\n\n"
-				html += NodeChildren2html(t3)
-			} else {
-				html = html2
-				log.Println(cnt)
-			}
+		if cnt <= 0 || cnt >= 15 {
+			log.Printf("题目%s的题面无法分节，cnt=%d", p.Pid, cnt)
+			html = "# 题面\n\n" + NodeChildren2html(content[0])
 		} else {
-			log.Println(cnt)
+			html = html2
+		}
+	}
+	p.Data.Description = html
+	err = DownloadProblemImage(httpConfig, p.Data, homePath, fileList, baseUrl+"/"+p.Pid+"/", baseUrl)
+	if err != nil {
+		log.Printf("下载题目%s的图片时出现错误:%v", p.Pid, err)
+	}
+	return nil
+}
+
+// 爬取尚未完成的题目，每 batchSize 道题目提交一次；有题目爬取失败时保留检查点并返回错误，重新运行时只爬取剩余的题目
+func Update() error {
+	log.Println("Updating Tsinsen")
+	cp, err := OpenCheckpoint(checkpointPath, homePath, oldPList)
+	if err != nil {
+		return err
+	}
+	cp.BatchSize = batchSize
+	cp.Submit = submit
+	if n := cp.Len(); n > 0 {
+		log.Printf("从检查点继续，已完成 %d 道题目", n)
+	}
+	failed := 0
+	for k := firstPid; k <= lastPid; k++ {
+		p := &ProblemListItem{Pid: "A" + strconv.Itoa(k)}
+		if cp.Done(p.Pid) {
+			continue
 		}
-		t4, err := DownloadImage(nil, html, homePath+p.Pid+"/img/", fileList, "http://www.tsinsen.com/"+p.Pid+"/", "http://www.tsinsen.com")
+		log.Println("start getting problem " + p.Pid)
+		err := getProblem(p, cp.Files)
 		if err != nil {
-			log.Println(err)
-		} else {
-			html = t4
+			log.Printf("爬取题目%s时出现错误:%v", p.Pid, err)
+			failed++
+			continue
+		}
+		err = cp.Add(p)
+		if err != nil {
+			return err
 		}
-		p.Data.Description = html
-		pl = append(pl, p)
 	}
-	err := WriteFiles(pl, fileList, homePath)
+	if failed > 0 {
+		err = cp.Flush()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%d 道题目爬取失败，请重新运行以重试", failed)
+	}
+	return cp.Finish()
+}
+
+func submit(files map[string][]byte) error {
+	r, err := client.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: files})
 	if err != nil {
-		log.Panicln(err)
+		return err
 	}
-	return fileList, nil
+	if !r.Ok {
+		return errors.New("submit update failed")
+	}
+	log.Println("Submit update successfully")
+	return nil
 }
 
-func Stop() {
-	logger.Println("UniversalOJ crawler stopped")
+func main() {
+	var err error
+	var closeConn func() error
+	client, closeConn, err = Connect()
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer closeConn()
+	info = &rpc.Info{Id: PID, Name: NAME}
+	err = Start()
+	if err != nil {
+		log.Panicln(err)
+	}
+	_, err = client.Register(context.Background(), &rpc.RegisterRequest{Info: info})
+	if err != nil {
+		log.Fatalf("could not register: %v", err)
+	}
+	err = Update()
+	if err != nil {
+		log.Printf("Update Error: %v", err)
+	}
 }
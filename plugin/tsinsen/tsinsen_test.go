@@ -0,0 +1,78 @@
+package main
+
+import (
+	. "crawler/plugin/public"
+	"crawler/plugin/public/fakeoj"
+	"crawler/plugin/public/testserver"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const problemPage = `<html><body>
+<div id="ptit">%s. %s</div>
+<div id="pres"><div><span>1.0s</span><span>256.0MB</span></div></div>
+<div id="pcont1"><div class="pdsec">问题描述</div><p>输入 a 和 b，输出 a+b。</p></div>
+</body></html>`
+
+// 中断后重新运行时只爬取失败的题目，并在完成后删除检查点
+func TestCheckpoint(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	dir, err := ioutil.TempDir("", "tsinsen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mu := sync.Mutex{}
+	requests := make(map[string]int)
+	broken := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		if r.URL.Path == "/A1001" && broken {
+			http.Error(w, "", 500)
+			return
+		}
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, problemPage, r.URL.Path[1:], "题目"+r.URL.Path[1:])
+	}))
+	defer server.Close()
+	baseUrl, firstPid, lastPid, batchSize = server.URL, 1000, 1003, 2
+	checkpointPath = filepath.Join(dir, "checkpoint", "tsinsen.json")
+	s := testserver.New()
+	defer s.Use()()
+
+	main()
+	if _, err := os.Stat(checkpointPath); err != nil {
+		t.Fatalf("checkpoint is not kept after failure: %v", err)
+	}
+	s.AssertSubmitted(t, "tsinsen/A1000/main.json", "tsinsen/A1002/main.json", "tsinsen/A1003/main.json")
+	s.AssertNotSubmitted(t, "tsinsen/A1001/main.json")
+
+	broken = false
+	main()
+	if requests["/A1000"] != 1 || requests["/A1001"] != 2 {
+		t.Errorf("finished problems are fetched again: %v", requests)
+	}
+	s.AssertSubmitted(t, "tsinsen/A1001/main.json")
+	list := ProblemList{}
+	if b, ok := s.File("tsinsen/problemlist.json"); !ok || json.Unmarshal(b, &list) != nil || len(list) != 4 {
+		t.Errorf("unexpected problemlist.json: %s", b)
+	}
+	if p := s.MainJson(t, PID, "A1001"); p.Title != "题目A1001" || p.Time != 1000 || p.Memory != 256 {
+		t.Errorf("unexpected main.json: %+v", p)
+	}
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Errorf("checkpoint is not removed: %v", err)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	. "crawler/plugin/public"
 	"crawler/rpc"
 	"fmt"
-	"google.golang.org/grpc"
 	"log"
 	"os"
 	"regexp"
@@ -17,36 +16,47 @@ import (
 const PID = "uoj"
 const homePath = PID + "/"
 
+// 题库的网址，测试时可替换为 fakeoj 的地址
+var baseUrl = "http://uoj.ac"
+
 var client rpc.APIClient
 var logger *log.Logger
 
-var fileList map[string][]byte
+var fileList *FileList
 
-var oldPList map[string]string
+var oldPList OldProblemList
 
 var debugMode bool
 
 var info *rpc.Info
 
+// 本组件发出请求所用的设置，代理与缓存在 Start 中设置
+var httpConfig = &HttpConfig{SleepTime: DefaultHttpConfig.SleepTime}
+
 func Start() error {
 	logger = log.New(os.Stdout, "", log.Ldate|log.Ltime)
-	oldPList = make(map[string]string)
+	oldPList = make(OldProblemList)
 	err := InitPList(oldPList, info, client)
 	if err != nil {
 		return err
 	}
+	httpConfig.Proxy, err = LoadProxyConfig(info.Id)
+	if err != nil {
+		return err
+	}
+	httpConfig.Cache = NewDiskCache(CacheDir + info.Id)
 	logger.Println("UniversalOJ crawler started")
 	return nil
 }
 
-func Update() (FileList, error) {
+func Update() (map[string][]byte, error) {
 	limit := 50
 	if debugMode {
 		limit = 5
 	}
 	logger.Println("Updating UniversalOJ")
-	fileList = make(FileList)
-	problemPage, err := GetDocument(nil, "http://uoj.ac/problems")
+	fileList = NewFileList()
+	problemPage, err := GetDocument(httpConfig, baseUrl+"/problems")
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +84,7 @@ func Update() (FileList, error) {
 	}
 	newPList := make([]ProblemListItem, 0)
 	for i := 1; i <= maxPage; i++ {
-		problemListPage, err := GetDocument(nil, fmt.Sprintf("http://uoj.ac/problems?page=%d", i))
+		problemListPage, err := GetDocument(httpConfig, fmt.Sprintf("%s/problems?page=%d", baseUrl, i))
 		if err != nil {
 			return nil, err
 		}
@@ -97,12 +107,15 @@ func Update() (FileList, error) {
 			newPList = append(newPList, p)
 		}
 	}
-	DownloadProblems(newPList, oldPList, limit, func(p *ProblemListItem) error {
+	getProblem := func(p *ProblemListItem) error {
 		if debugMode {
 			logger.Println("开始抓取题目 ", p.Pid)
 		}
 		p.Data = nil
-		page, err := GetDocument(nil, `http://uoj.ac/problem/`+p.Pid)
+		page, err := GetProblemDocument(httpConfig, baseUrl+"/problem/"+p.Pid, p)
+		if err == ErrUnchanged {
+			return err
+		}
 		if err != nil {
 			return fmt.Errorf("下载题面失败: %v", err)
 		}
@@ -114,11 +127,7 @@ func Update() (FileList, error) {
 		html := Node2html(x.Nodes[0])
 		html = strings.Replace(html, `<article class="top-buffer-md">`, "", -1)
 		html = strings.Replace(html, `</article>`, "", -1)
-		rule := regexp.MustCompile(`<h3>.+?</h3>`)
-		html = rule.ReplaceAllStringFunc(html, func(x string) string {
-			return "\n# " + x[4:len(x)-5] + "\n\n"
-		})
-		rule = regexp.MustCompile(`时间限制(?:</strong>)*：(?:</strong>)*\$(.+?)\\texttt{s}\$`)
+		rule := regexp.MustCompile(`时间限制(?:</strong>)*：(?:</strong>)*\$(.+?)\\texttt{s}\$`)
 		match := rule.FindStringSubmatch(html)
 		if len(match) > 0 {
 			t := match[1]
@@ -142,30 +151,53 @@ func Update() (FileList, error) {
 				}
 			}
 		}
-		p.Data.Description = "# 题目描述\n\n" + html
-		t, err := DownloadImage(nil, p.Data.Description, homePath+p.Pid+"/img/", fileList, "http://uoj.ac/problem/"+p.Pid+"/", "http://uoj.ac")
-		if err == nil {
-			p.Data.Description = t
+		p.Data.Samples = ExtractSamples(html)
+		md, err := HTML2Markdown(html)
+		if err != nil {
+			return err
+		}
+		p.Data.OriginalDescription = html
+		b := NewStatementBuilder()
+		titles, contents := SplitSections(md)
+		for k, title := range titles {
+			switch {
+			case title == "":
+				b.Add(SectionDescription, contents[k])
+			case ClassifySection(title) == SectionSamples:
+				b.Add(SectionSamples, "## "+title+"\n\n"+strings.Trim(contents[k], "\r\n"))
+			default:
+				b.AddTitled(title, contents[k])
+			}
+		}
+		b.Build(p.Data)
+		err = DownloadProblemImage(httpConfig, p.Data, homePath, fileList, baseUrl+"/problem/"+p.Pid+"/", baseUrl)
+		if err != nil {
+			logger.Printf("下载题目%s的图片时出现错误:%v", p.Pid, err)
+		}
+		err = DownloadAttachments(httpConfig, nil, p.Data, homePath+p.Pid+"/files/", fileList, baseUrl+"/problem/"+p.Pid+"/", baseUrl)
+		if err != nil {
+			logger.Printf("下载题目%s的附件时出现错误:%v", p.Pid, err)
 		}
 		p.Data.Title = p.Title
-		p.Data.Url = "http://uoj.ac/problem/" + p.Pid
-		p.Data.DescriptionType = "html"
+		p.Data.Url = baseUrl + "/problem/" + p.Pid
+		p.Data.DescriptionType = "markdown"
 		if p.Data.Time == 0 {
 			p.Data.Judge = "提交答案"
 		} else {
 			p.Data.Judge = "传统或交互"
 		}
 		return nil
-	})
+	}
+	if BackfillMode {
+		return nil, NewBackfill(info, client).Run(fileList, newPList, oldPList, getProblem)
+	}
+	DownloadProblems(nil, newPList, oldPList, limit, getProblem)
 	err = WriteFiles(newPList, fileList, homePath)
 	if err != nil {
 		return nil, err
 	}
-	oldPList = make(map[string]string)
-	for _, i := range newPList {
-		oldPList[i.Pid] = i.Title
-	}
-	return fileList, nil
+	oldPList = NewOldProblemList(newPList)
+	return fileList.Files(), nil
 }
 
 func Stop() {
@@ -178,6 +210,10 @@ func runUpdate() {
 		log.Println("Update Error")
 		return
 	}
+	if BackfillMode {
+		log.Println("Backfill finished")
+		return
+	}
 	r, err := client.Update(context.Background(), &rpc.UpdateRequest{Info: info, File: file})
 	if err != nil {
 		log.Printf("Submit update failed: %v", err)
@@ -187,20 +223,23 @@ func runUpdate() {
 		log.Println("Submit update failed")
 		return
 	}
+	CommitAssets(homePath, file)
 	log.Println("Submit update successfully")
 }
 func main() {
-	conn, err := grpc.Dial("127.0.0.1:27381", grpc.WithInsecure())
+	ParseFlags()
+	var err error
+	var closeConn func() error
+	client, closeConn, err = Connect()
 	if err != nil {
 		time.Sleep(time.Second * 10)
-		conn, err = grpc.Dial("127.0.0.1:27381", grpc.WithInsecure())
+		client, closeConn, err = Connect()
 		if err != nil {
 			log.Fatalf("did not connect: %v", err)
 		}
 	}
-	defer conn.Close()
+	defer closeConn()
 	info = &rpc.Info{Id: PID, Name: "UniversalOJ"}
-	client = rpc.NewAPIClient(conn)
 	err = Start()
 	if err != nil {
 		log.Panicln(err)
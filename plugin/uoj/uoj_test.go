@@ -0,0 +1,178 @@
+package main
+
+import (
+	. "crawler/plugin/public"
+	"crawler/plugin/public/fakeoj"
+	"crawler/plugin/public/testserver"
+	"crawler/plugin/public/vcr"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// 将磁盘缓存放在临时目录中
+func useTempCache(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := CacheDir
+	CacheDir = dir + "/"
+	return func() {
+		CacheDir = old
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func useFixtures(t *testing.T) func() {
+	rec, err := vcr.New("testdata/fixtures", vcr.ModeFromEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefaultHttpConfig.Client = rec.Client()
+	// 固定爬取时间，使 problemlist.json 中的 fetched 与 golden 一致
+	Now = func() time.Time { return time.Unix(1600000000, 0) }
+	restore := useTempCache(t)
+	return func() {
+		DefaultHttpConfig.Client, Now = nil, time.Now
+		httpConfig.Cache = nil
+		restore()
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	defer useFixtures(t)()
+	logger = log.New(ioutil.Discard, "", 0)
+	oldPList = make(OldProblemList)
+	files, err := Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcr.CheckGolden(t, "testdata/golden", files)
+}
+
+// 从连接主服务到提交更新完整运行一次组件
+func TestRun(t *testing.T) {
+	defer useFixtures(t)()
+	s := testserver.New()
+	s.SetProblemlist(PID, ProblemList{{Pid: "1", Title: "A + B Problem"}, {Pid: "2", Title: "旧标题"}})
+	defer s.Use()()
+	main()
+
+	if r := s.Registered(); len(r) != 1 || r[0].Id != PID {
+		t.Errorf("registered %v", r)
+	}
+	if n := len(s.Updates()); n != 1 {
+		t.Fatalf("got %d updates, want 1", n)
+	}
+	s.AssertSubmitted(t, "uoj/problemlist.json", "uoj/1/main.json", "uoj/1/samples/1.in", "uoj/1/files/ex_1.zip", "uoj/2/main.json", "uoj/_assets/index.json")
+	if p := s.MainJson(t, PID, "2"); p.Title != "猜数" || p.Judge != "提交答案" {
+		t.Errorf("uoj/2/main.json = %+v", p)
+	}
+	if p := s.MainJson(t, PID, "1"); p.Time != 1000 || p.Memory != 256 || len(p.Samples) != 1 {
+		t.Errorf("uoj/1/main.json = %+v", p)
+	}
+}
+
+func TestFakeOJ(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	logger = log.New(ioutil.Discard, "", 0)
+	problems := []fakeoj.Problem{
+		{Id: "1", Title: "A + B Problem", Description: "<p>输入 $a, b$，输出 $a + b$。</p>", Samples: []fakeoj.Sample{{Input: "1 2", Output: "3"}}, TimeLimit: 1000, MemoryLimit: 256},
+		{Id: "2", Title: "不存在的题目"},
+		{Id: "3", Title: "损坏的题目", TimeLimit: 1000, MemoryLimit: 256},
+		{Id: "4", Title: "猜数", Description: "<p>猜出每个输入文件对应的数。</p>"},
+	}
+	for _, i := range []struct {
+		name    string
+		setup   func(f *fakeoj.Server)
+		err     bool
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "problem errors",
+			setup: func(f *fakeoj.Server) {
+				f.Errors["/problem/2"] = 404
+				f.Broken["/problem/3"] = true
+			},
+			want:    []string{"uoj/problemlist.json", "uoj/1/main.json", "uoj/1/samples/1.in", "uoj/4/main.json"},
+			notWant: []string{"uoj/2/main.json", "uoj/3/main.json"},
+		},
+		{name: "maxPage too large", setup: func(f *fakeoj.Server) { f.MaxPage = 500 }, err: true},
+		{name: "broken list page", setup: func(f *fakeoj.Server) { f.Broken["/problems?page=2"] = true }, err: true},
+	} {
+		t.Run(i.name, func(t *testing.T) {
+			f := fakeoj.NewUOJ(problems...)
+			defer f.Close()
+			f.PerPage = 2
+			i.setup(f)
+			old := baseUrl
+			baseUrl = f.URL
+			defer func() { baseUrl = old }()
+			oldPList = make(OldProblemList)
+			files, err := Update()
+			if i.err {
+				if err == nil {
+					t.Error("Update succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range i.want {
+				if _, ok := files[k]; !ok {
+					t.Errorf("%s missing", k)
+				}
+			}
+			for _, k := range i.notWant {
+				if _, ok := files[k]; ok {
+					t.Errorf("unexpected %s", k)
+				}
+			}
+			p := &Problem{}
+			if err := json.Unmarshal(files["uoj/4/main.json"], p); err != nil || p.Judge != "提交答案" {
+				t.Errorf("uoj/4/main.json = %s", files["uoj/4/main.json"])
+			}
+			if err := json.Unmarshal(files["uoj/1/main.json"], p); err != nil || p.Time != 1000 || p.Memory != 256 {
+				t.Errorf("uoj/1/main.json = %s", files["uoj/1/main.json"])
+			}
+		})
+	}
+}
+
+// 题面页面未变化时服务器返回 304，已归档的题目不再重新生成
+func TestCache(t *testing.T) {
+	defer fakeoj.NoDelay()()
+	defer useTempCache(t)()
+	logger = log.New(ioutil.Discard, "", 0)
+	f := fakeoj.NewUOJ(fakeoj.Problem{Id: "1", Title: "A + B Problem", Description: "<p>输入 $a, b$，输出 $a + b$。</p>", TimeLimit: 1000, MemoryLimit: 256})
+	defer f.Close()
+	f.ETag = true
+	old := baseUrl
+	baseUrl = f.URL
+	httpConfig.Cache = NewDiskCache(CacheDir + PID)
+	defer func() { baseUrl, httpConfig.Cache = old, nil }()
+	oldPList = make(OldProblemList)
+	files, err := Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["uoj/1/main.json"]; !ok {
+		t.Fatal("uoj/1/main.json missing")
+	}
+	files, err = Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.NotModified() != 1 {
+		t.Errorf("got %d not modified responses, want 1", f.NotModified())
+	}
+	if _, ok := files["uoj/1/main.json"]; ok {
+		t.Error("unchanged problem is written again")
+	}
+}
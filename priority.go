@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 全量回填的提交最多等待的时间，超过后与常规更新同等对待，避免在常规更新不断时一直等待
+const backfillMaxWait = 10 * time.Minute
+
+// priorityLock 为区分优先级的互斥锁：有常规更新等待时，全量回填的提交不会取得锁
+type priorityLock struct {
+	mu     sync.Mutex
+	locked bool
+	// 等待中的高优先级请求数
+	high int
+	// 锁的状态变化时关闭并替换，用于唤醒等待者
+	wake chan struct{}
+}
+
+func newPriorityLock() *priorityLock {
+	return &priorityLock{wake: make(chan struct{})}
+}
+
+// 唤醒所有等待者，调用时需持有 l.mu
+func (l *priorityLock) notify() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// Lock 取得锁，high 为 false 时在没有高优先级请求等待（或已等待 maxWait）后才取得；ctx 被取消时返回其错误
+func (l *priorityLock) Lock(ctx context.Context, high bool, maxWait time.Duration) error {
+	var timeout <-chan time.Time
+	if !high && maxWait > 0 {
+		t := time.NewTimer(maxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	l.mu.Lock()
+	if high {
+		l.high++
+	}
+	for {
+		if !l.locked && (high || l.high == 0) {
+			l.locked = true
+			if high {
+				l.high--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+			l.mu.Lock()
+		case <-timeout:
+			timeout = nil
+			l.mu.Lock()
+			high = true
+			l.high++
+		case <-ctx.Done():
+			l.mu.Lock()
+			if high {
+				l.high--
+				l.notify()
+			}
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *priorityLock) Unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.locked = false
+	l.notify()
+}
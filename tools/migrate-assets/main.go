@@ -0,0 +1,179 @@
+/*
+将旧版归档中以链接的 base64 命名、保存在 <题库>/<pid>/img/ 中的图片迁移为按内容哈希命名的 <题库>/_assets/ab/abcdef.ext，
+并改写 description.md、description.html 与 main.json 中的图片路径，同时生成 <题库>/_assets/index.json。
+迁移后需在归档仓库中手动提交。
+*/
+package main
+
+import (
+	. "crawler/plugin/public"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var sourcePath string
+var dryRun bool
+
+// 需要改写图片路径的文件
+var rewriteFiles = []string{"description.md", "description.html", "main.json"}
+
+// 由旧文件名还原图片链接，文件名过长时旧版使用的是哈希，无法还原
+// 链接经 ResolveUrl 规范化，与下载图片时写入 AssetIndex 的键一致
+func decodeName(name string) (string, bool) {
+	if k := strings.IndexByte(name, '.'); k >= 0 {
+		name = name[:k]
+	}
+	b, err := base64.URLEncoding.DecodeString(name)
+	if err != nil {
+		return "", false
+	}
+	u, err := ResolveUrl("", string(b))
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func writeFile(name string, data []byte) error {
+	if dryRun {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// 迁移一道题的图片，返回迁移的图片数
+func migrateProblem(id string, pid string, index *AssetIndex) (int, error) {
+	dir := filepath.Join(sourcePath, id, pid)
+	imgs, err := ioutil.ReadDir(filepath.Join(dir, "img"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	replace := make([]string, 0)
+	for _, i := range imgs {
+		if i.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "img", i.Name()))
+		if err != nil {
+			return 0, err
+		}
+		ext, err := DefaultImageConfig.Check("", data)
+		if err != nil {
+			log.Printf("%s/%s/img/%s: %v", id, pid, i.Name(), err)
+			ext = strings.TrimPrefix(filepath.Ext(i.Name()), ".")
+		}
+		h := CalcMD5(string(data))
+		e := AssetEntry{File: AssetDir + h[:2] + "/" + h}
+		if ext != "" {
+			e.File += "." + ext
+		}
+		err = writeFile(filepath.Join(sourcePath, id, filepath.FromSlash(e.File)), data)
+		if err != nil {
+			return 0, err
+		}
+		if u, ok := decodeName(i.Name()); ok {
+			index.Set(u, e)
+		}
+		replace = append(replace, "/source/"+id+"/"+pid+"/img/"+i.Name(), "/source/"+id+"/"+e.File)
+	}
+	r := strings.NewReplacer(replace...)
+	for _, i := range rewriteFiles {
+		name := filepath.Join(dir, i)
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, err
+		}
+		if s := r.Replace(string(b)); s != string(b) {
+			err = writeFile(name, []byte(s))
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if !dryRun {
+		err = os.RemoveAll(filepath.Join(dir, "img"))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(replace) / 2, nil
+}
+
+// 迁移一个题库
+func migrate(id string) error {
+	b, err := ioutil.ReadFile(filepath.Join(sourcePath, id, "problemlist.json"))
+	if err != nil {
+		return err
+	}
+	list := ProblemList{}
+	err = json.Unmarshal(b, &list)
+	if err != nil {
+		return err
+	}
+	index := GetAssetIndex(id + "/")
+	b, err = ioutil.ReadFile(filepath.Join(sourcePath, id, filepath.FromSlash(AssetIndexFile)))
+	if err == nil {
+		err = json.Unmarshal(b, index)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	cnt := 0
+	for _, i := range list {
+		n, err := migrateProblem(id, i.Pid, index)
+		if err != nil {
+			return err
+		}
+		cnt += n
+	}
+	if index.Len() > 0 {
+		b, err = json.MarshalIndent(index, "", "\t")
+		if err != nil {
+			return err
+		}
+		err = writeFile(filepath.Join(sourcePath, id, filepath.FromSlash(AssetIndexFile)), b)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("%s: 迁移了 %d 张图片", id, cnt)
+	return nil
+}
+
+func main() {
+	flag.StringVar(&sourcePath, "source", "../source", "source repository Path")
+	flag.BoolVar(&dryRun, "dry-run", false, "只输出将要迁移的图片数，不修改文件")
+	flag.Parse()
+	dirs, err := ioutil.ReadDir(sourcePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, i := range dirs {
+		if !i.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(sourcePath, i.Name(), "problemlist.json")); err != nil {
+			continue
+		}
+		err = migrate(i.Name())
+		if err != nil {
+			log.Fatalf("%s: %v", i.Name(), err)
+		}
+	}
+}